@@ -6,12 +6,18 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
 
 	"github.com/tsosunchia/iNetSpeed-CLI/internal/config"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/endpoint"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/exporter"
 	"github.com/tsosunchia/iNetSpeed-CLI/internal/i18n"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/netx"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/output"
 	"github.com/tsosunchia/iNetSpeed-CLI/internal/render"
 	"github.com/tsosunchia/iNetSpeed-CLI/internal/runner"
 )
@@ -45,24 +51,105 @@ func main() {
 		os.Exit(1)
 	}
 
+	netOpts, keyLog, err := netOptions(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "  [\u2717] %s\n", err)
+		os.Exit(1)
+	}
+	endpoint.SetNetOptions(netOpts)
+	provider, err := endpoint.NewProvider(endpoint.ProviderOptions{
+		Name:   cfg.MetadataProvider,
+		Token:  cfg.MetadataToken,
+		Fields: cfg.MetadataFields,
+		MMDB:   cfg.MMDBPaths,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "  [\u2717] %s\n", err)
+		os.Exit(1)
+	}
+	endpoint.SetProvider(provider)
+	// Local databases answer instantly, so only remote lookups are cached.
+	if !cfg.NoMetadata && provider.Name() != "mmdb" {
+		endpoint.SetMetadataCache(cachePath(cfg, "metadata.json"), cfg.MetadataTTL)
+	}
+	endpoint.SetDiscoveryCache(cachePath(cfg, "discovery.json"), cfg.DiscoveryTTL)
+
+	if cfg.Command == config.CommandExporter {
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		defer stop()
+		err := exporter.Serve(ctx, cfg, netOpts)
+		keyLog.Close()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "  [\u2717] %s\n", err)
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+
 	var r render.Renderer
+	var dashboard *render.DashboardRenderer
 	isTTY := render.IsTTY()
-	if cfg.OutputJSON {
+	if cfg.StdoutOutput() {
 		r = render.NewPlainRenderer(io.Discard)
 		isTTY = false
+	} else if isTTY && cfg.Dashboard {
+		dashboard = render.NewDashboardRenderer()
+		r = dashboard
 	} else if isTTY {
 		r = render.NewTTYRenderer()
 	} else {
 		r = render.NewPlainRenderer(os.Stderr)
 	}
 
+	var streams []*render.NDJSONRenderer
+	for _, o := range cfg.Outputs {
+		if o.Format != config.OutputNDJSON {
+			continue
+		}
+		w, _, err := output.Open(o.Path, cfg.OutputAppend)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "  [\u2717] %s\n", err)
+			os.Exit(1)
+		}
+		defer w.Close()
+		stream := render.NewNDJSONRenderer(w)
+		streams = append(streams, stream)
+		r = render.Tee(r, stream)
+	}
+
 	bus := render.NewBus(r)
 
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
-	result := runner.Run(ctx, cfg, bus, isTTY)
+	result := runner.Run(ctx, cfg, netOpts, bus, isTTY)
+	keyLog.Close()
 	bus.Close()
+	if dashboard != nil {
+		dashboard.Close()
+	}
+	exitCode := result.ExitCode
+	for _, stream := range streams {
+		if err := stream.Finish(result); err != nil {
+			fmt.Fprintf(os.Stderr, "  [\u2717] %s: %s\n", config.OutputNDJSON, err)
+			exitCode = 1
+		}
+	}
+	for _, o := range cfg.Outputs {
+		if o.Format == config.OutputNDJSON {
+			continue
+		}
+		if err := output.Write(cfg, o, result); err != nil {
+			fmt.Fprintf(os.Stderr, "  [\u2717] %s: %s\n", o.Format, err)
+			exitCode = 1
+		}
+	}
+	if cfg.Report != "" {
+		if err := output.WriteHTMLReport(cfg.Report, result); err != nil {
+			fmt.Fprintf(os.Stderr, "  [\u2717] %s\n", err)
+			exitCode = 1
+		}
+	}
 	if cfg.OutputJSON {
 		enc := json.NewEncoder(os.Stdout)
 		enc.SetEscapeHTML(false)
@@ -71,7 +158,68 @@ func main() {
 			os.Exit(1)
 		}
 	}
-	os.Exit(result.ExitCode)
+	os.Exit(exitCode)
+}
+
+// parseProxy turns a validated proxy setting into a URL, nil for direct.
+func parseProxy(raw string) *url.URL {
+	if raw == "" {
+		return nil
+	}
+	u, _ := url.Parse(raw)
+	return u
+}
+
+// cachePath is name in the cache directory, or "" to cache in memory when
+// there is none.
+func cachePath(cfg *config.Config, name string) string {
+	if cfg.CacheDir == "" {
+		return ""
+	}
+	return filepath.Join(cfg.CacheDir, name)
+}
+
+// netOptions collects the bind, proxy, TLS and socket flags into the
+// connection settings shared by every client. The closer releases the TLS
+// key log file.
+func netOptions(cfg *config.Config) (netx.Options, io.Closer, error) {
+	tlsCfg, keyLog, err := netx.LoadTLS(netx.TLS{
+		CAFile:       cfg.CAFile,
+		CertFile:     cfg.CertFile,
+		KeyFile:      cfg.KeyFile,
+		MinVersion:   cfg.TLSMin,
+		MaxVersion:   cfg.TLSMax,
+		CipherSuites: cfg.TLSCiphers,
+		KeyLogFile:   cfg.KeyLogFile,
+	})
+	if err != nil {
+		return netx.Options{}, nil, err
+	}
+	opts := netx.Options{
+		Bind:    netx.Bind{Interface: cfg.Interface, Source: cfg.Source},
+		Proxies: netx.Proxies{Metadata: parseProxy(cfg.MetadataProxy), Measurement: parseProxy(cfg.MeasureProxy)},
+		TLS:     tlsCfg,
+		Socket:  socketOptions(cfg),
+	}
+	if cfg.DSCP != "" {
+		opts.DSCP = cfg.DSCPValue
+	}
+	return opts, keyLog, nil
+}
+
+// socketOptions maps the socket tuning flags onto netx.SocketOptions.
+func socketOptions(cfg *config.Config) netx.SocketOptions {
+	o := netx.SocketOptions{
+		RcvBuf:       cfg.RcvBuf,
+		SndBuf:       cfg.SndBuf,
+		NotSentLowat: cfg.NotSentLowat,
+		MPTCP:        cfg.MPTCP,
+	}
+	if cfg.TCPNoDelay != "" {
+		noDelay := cfg.TCPNoDelay == "on"
+		o.NoDelay = &noDelay
+	}
+	return o
 }
 
 func isVersionRequest(args []string) bool {
@@ -63,7 +63,7 @@ func TestIntegrationDownloadSingleThread(t *testing.T) {
 	defer bus.Close()
 
 	res := transfer.Run(context.Background(), srv.Client(), cfg,
-		transfer.Download, 1, srv.URL+"/large", bus)
+		transfer.Download, 1, srv.URL+"/large", nil, bus)
 
 	if res.TotalBytes == 0 {
 		t.Error("downloaded 0 bytes")
@@ -88,7 +88,7 @@ func TestIntegrationUploadSingleThread(t *testing.T) {
 	defer bus.Close()
 
 	res := transfer.Run(context.Background(), srv.Client(), cfg,
-		transfer.Upload, 1, srv.URL+"/slurp", bus)
+		transfer.Upload, 1, srv.URL+"/slurp", nil, bus)
 
 	if res.TotalBytes == 0 {
 		t.Error("uploaded 0 bytes")
@@ -110,7 +110,7 @@ func TestIntegrationMultiThreadDownload(t *testing.T) {
 	defer bus.Close()
 
 	res := transfer.Run(context.Background(), srv.Client(), cfg,
-		transfer.Download, 4, srv.URL+"/large", bus)
+		transfer.Download, 4, srv.URL+"/large", nil, bus)
 
 	if res.TotalBytes == 0 {
 		t.Error("downloaded 0 bytes with 4 threads")
@@ -294,7 +294,7 @@ func TestStreamingProgress(t *testing.T) {
 	bus := render.NewBus(collector)
 
 	transfer.Run(context.Background(), slowSrv.Client(), cfg,
-		transfer.Download, 1, slowSrv.URL, bus)
+		transfer.Download, 1, slowSrv.URL, nil, bus)
 	bus.Close()
 
 	// Check that progress events were emitted during execution, not just at the end
@@ -335,7 +335,7 @@ func TestSmokeAllPhases(t *testing.T) {
 	// Run all four transfer tests
 	for _, dir := range []transfer.Direction{transfer.Download, transfer.Upload} {
 		for _, threads := range []int{1, 2} {
-			transfer.Run(context.Background(), srv.Client(), cfg, dir, threads, srv.URL+"/large", bus)
+			transfer.Run(context.Background(), srv.Client(), cfg, dir, threads, srv.URL+"/large", nil, bus)
 		}
 	}
 
@@ -388,7 +388,7 @@ func TestContextCancellation(t *testing.T) {
 	}()
 
 	start := time.Now()
-	transfer.Run(ctx, srv.Client(), cfg, transfer.Download, 1, srv.URL, bus)
+	transfer.Run(ctx, srv.Client(), cfg, transfer.Download, 1, srv.URL, nil, bus)
 	elapsed := time.Since(start)
 
 	if elapsed > 3*time.Second {
@@ -416,7 +416,7 @@ func TestUploadBadStatusCode(t *testing.T) {
 	defer bus.Close()
 
 	res := transfer.Run(context.Background(), srv.Client(), cfg,
-		transfer.Upload, 1, srv.URL, bus)
+		transfer.Upload, 1, srv.URL, nil, bus)
 
 	if res.TotalBytes != 0 {
 		t.Errorf("expected 0 bytes from 403 upload, got %d", res.TotalBytes)
@@ -442,7 +442,7 @@ func TestDownloadBadStatusCode(t *testing.T) {
 	defer bus.Close()
 
 	res := transfer.Run(context.Background(), srv.Client(), cfg,
-		transfer.Download, 1, srv.URL, bus)
+		transfer.Download, 1, srv.URL, nil, bus)
 
 	if res.TotalBytes != 0 {
 		t.Errorf("expected 0 bytes from 403 server, got %d", res.TotalBytes)
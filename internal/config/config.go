@@ -1,15 +1,23 @@
 package config
 
 import (
+	"cmp"
+	"crypto/tls"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
+	"math"
 	"net"
+	"net/netip"
+	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/tsosunchia/iNetSpeed-CLI/internal/i18n"
 )
@@ -22,7 +30,22 @@ const (
 	DefaultTimeout      = 10
 	DefaultThreads      = 4
 	DefaultLatencyCount = 20
-	UserAgent           = "networkQuality/194.80.3 CFNetwork/3860.400.51 Darwin/25.3.0"
+	DefaultListen       = ":9516"
+	DefaultMetadataTTL  = 24 * time.Hour
+	// DefaultExporterDiscoveryTTL keeps scheduled runs on one endpoint so
+	// trends reflect the network rather than CDN node churn.
+	DefaultExporterDiscoveryTTL = time.Hour
+	UserAgent                   = "networkQuality/194.80.3 CFNetwork/3860.400.51 Darwin/25.3.0"
+)
+
+const CommandExporter = "exporter"
+
+const (
+	OutputPromTextfile = "prom-textfile"
+	OutputNDJSON       = "ndjson"
+	OutputCSV          = "csv"
+	OutputTSV          = "tsv"
+	OutputMarkdown     = "markdown"
 )
 
 var ErrHelp = errors.New("help requested")
@@ -40,12 +63,171 @@ type Config struct {
 	NonInteractive bool
 	EndpointIP     string
 	NoMetadata     bool
+	Command        string
+	Listen         string
+	Interval       time.Duration
+	Outputs        []Output
+	OutputAppend   bool
+	NoHeader       bool
+	Report         string
+	Dashboard      bool
+
+	// EndpointIPs holds every IP passed to --endpoint when it lists more
+	// than one; EndpointIP is then empty.
+	EndpointIPs      []string
+	CompareEndpoints bool
+	// Resolvers lists the DoH URLs and tls://, udp:// or tcp:// DNS servers
+	// used for endpoint discovery instead of the built-in Cloudflare and
+	// AliDNS lookups.
+	Resolvers []string
+	// ECS is sent as EDNS Client Subnet in discovery queries; ECSMap lists
+	// subnets whose CDN mapping is reported before the test. Both hold
+	// masked CIDR prefixes.
+	ECS    string
+	ECSMap []string
+	// Prefer ranks matching healthy candidates first; Exclude keeps
+	// matching candidates from being probed or chosen.
+	Prefer  Match
+	Exclude Match
+	// Family is 4 or 6 when -4 or -6 restricts the run to one address
+	// family, and 0 otherwise.
+	Family    int
+	DualStack bool
+	// Interface and Source bind every outgoing connection to a network
+	// device and to a local address.
+	Interface string
+	Source    string
+	// MetadataProxy carries DoH, DNS-over-TCP/TLS and metadata lookups and
+	// MeasureProxy the probes and transfers; empty means a direct
+	// connection. --proxy sets both unless overridden.
+	MetadataProxy string
+	MeasureProxy  string
+	// TLS settings for every connection: CAFile adds roots to the system
+	// pool, CertFile and KeyFile are an mTLS client certificate, and
+	// KeyLogFile receives session secrets (defaults to $SSLKEYLOGFILE).
+	// Zero versions and nil ciphers keep the Go defaults.
+	CAFile     string
+	CertFile   string
+	KeyFile    string
+	TLSMin     uint16
+	TLSMax     uint16
+	TLSCiphers []uint16
+	KeyLogFile string
+	// DSCP is the --dscp code point name or number as given, upper-cased,
+	// and DSCPValue its numeric value; measurement traffic is only marked
+	// when DSCP is set.
+	DSCP      string
+	DSCPValue int
+	// Socket tuning for measurement connections, in bytes; zero keeps the
+	// system default. TCPNoDelay is "on", "off" or empty for Go's default
+	// (on), and MPTCP asks for Multipath TCP where the kernel supports it.
+	RcvBuf       int
+	SndBuf       int
+	NotSentLowat int
+	TCPNoDelay   string
+	MPTCP        bool
+	// MetadataProvider answers client, server and candidate lookups:
+	// ip-api (default), ipinfo, ripestat or an http(s) URL template with an
+	// {ip} placeholder, whose reply fields MetadataFields maps.
+	// MetadataToken authenticates ipinfo (defaults to $IPINFO_TOKEN). The
+	// mmdb provider reads the MaxMind DB files in MMDBPaths; --mmdb alone
+	// selects it.
+	MetadataProvider string
+	MetadataToken    string
+	MetadataFields   map[string]string
+	MMDBPaths        []string
+	// MetadataTTL is how long lookups of explicit addresses are reused from
+	// the cache in CacheDir; zero disables caching. An empty CacheDir keeps
+	// the cache in memory for the life of the process.
+	MetadataTTL time.Duration
+	CacheDir    string
+	// DiscoveryTTL is how long a discovered endpoint is reused across runs
+	// while it probes healthy before DNS discovery runs again; zero
+	// discovers on every run.
+	DiscoveryTTL time.Duration
+}
+
+// Match selects discovered endpoint candidates. A candidate matches when any
+// value of any field applies to it. Desc is a regular expression on the
+// metadata description; ASNs, Countries and Desc need metadata lookup.
+type Match struct {
+	Families  []int
+	CIDRs     []netip.Prefix
+	ASNs      []int
+	Countries []string
+	Desc      string
+}
+
+func (m Match) NeedsMetadata() bool {
+	return len(m.ASNs) > 0 || len(m.Countries) > 0 || m.Desc != ""
+}
+
+// Empty reports whether m has no rules at all.
+func (m Match) Empty() bool {
+	return len(m.Families) == 0 && len(m.CIDRs) == 0 && !m.NeedsMetadata()
+}
+
+// Output is one --output FORMAT[=PATH] destination. An empty Path means
+// stdout.
+type Output struct {
+	Format string
+	Path   string
+}
+
+// StdoutOutput reports whether a structured document or stream is written to
+// stdout, in which case human-readable output and prompts are suppressed.
+func (c *Config) StdoutOutput() bool {
+	if c.OutputJSON {
+		return true
+	}
+	for _, o := range c.Outputs {
+		if o.Path == "" {
+			return true
+		}
+	}
+	return false
+}
+
+type outputList []Output
+
+func (l *outputList) String() string {
+	parts := make([]string, 0, len(*l))
+	for _, o := range *l {
+		if o.Path == "" {
+			parts = append(parts, o.Format)
+			continue
+		}
+		parts = append(parts, o.Format+"="+o.Path)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (l *outputList) Set(v string) error {
+	format, path, _ := strings.Cut(v, "=")
+	*l = append(*l, Output{Format: strings.ToLower(strings.TrimSpace(format)), Path: strings.TrimSpace(path)})
+	return nil
+}
+
+// stringList collects a repeatable flag whose values may also be
+// comma-separated.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(v string) error {
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
 }
 
 func Usage() string {
 	if i18n.IsZH() {
 		return fmt.Sprintf(`用法:
   speedtest [选项]
+  speedtest exporter [选项]
   speedtest help
 
 选项:
@@ -61,17 +243,74 @@ func Usage() string {
   --latency-count N             延迟采样次数，范围 1-100（默认取 LATENCY_COUNT 或 %d）
   --json                        输出单个 JSON 文档到 stdout
   --non-interactive             禁用节点交互选择并自动选点
-  --endpoint IP                 指定固定节点 IP，跳过发现流程
+  --endpoint IP[,IP...]         指定固定节点 IP，跳过发现流程；列出多个 IP 时逐一测速并对比
+  --compare-endpoints           对发现的每个候选节点完整测速，输出排名对比表
+  --interface NAME              所有连接绑定到指定网卡（Linux 使用 SO_BINDTODEVICE）
+  --source IP                   所有连接使用指定本地源地址
+  --proxy URL                   所有流量经代理（http://、https://、socks5://，可带 用户:密码@）
+  --metadata-proxy URL          节点发现与元数据查询使用的代理，覆盖 --proxy；direct 为直连
+  --measure-proxy URL           探测与测速流量使用的代理，覆盖 --proxy；direct 为直连
+  --ca-file PATH                追加信任的 CA 证书（PEM），用于内部 PKI 的自建测速服务器
+  --cert PATH, --key PATH       mTLS 客户端证书与私钥（PEM）
+  --tls-min VER, --tls-max VER  TLS 版本范围：1.0、1.1、1.2、1.3（默认最低 1.2）
+  --tls-ciphers NAME[,NAME...]  TLS 1.2 及以下允许使用的密码套件（顺序无效，不含 TLS 1.3 套件），如 TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+  --keylog-file PATH            以 NSS 格式写入 TLS 会话密钥，用于解密抓包（默认取 SSLKEYLOGFILE）
+  --dscp EF|AF41|CS1|N          以指定 DSCP 标记探测、延迟与测速流量（IP_TOS / IPV6_TCLASS），用于验证 QoS 策略
+  --rcvbuf SIZE, --sndbuf SIZE  测速连接的套接字接收/发送缓冲区（SO_RCVBUF / SO_SNDBUF），如 16M
+  --tcp-nodelay on|off          测速连接的 TCP_NODELAY（默认 on）
+  --notsent-lowat SIZE          测速连接的 TCP_NOTSENT_LOWAT（Linux、macOS）
+  --mptcp                       测速连接尝试使用 Multipath TCP（Linux 5.6+）
+  -4, -6                        只使用 IPv4 / IPv6（节点发现、连接固定与延迟探测）
+  --dual-stack                  分别以 IPv4 和 IPv6 完整测速并输出两者差异
   --no-metadata                 跳过客户端/服务端 ASN 与地理信息查询
+  --metadata-provider NAME|URL  元数据来源：ip-api（默认，明文 HTTP）、ipinfo、ripestat、mmdb，
+                                或含 {ip} 占位符的 JSON 接口 URL 模板
+  --mmdb PATH[,PATH...]         离线查询使用的 MaxMind / DB-IP 数据库（City、Country、ASN），可重复；
+                                单独指定时即使用 mmdb 来源
+  --metadata-token TOKEN        ipinfo 访问令牌（默认取 IPINFO_TOKEN）
+  --metadata-fields KEY=PATH[,KEY=PATH...]
+                                URL 模板接口的字段映射，KEY 为 ip、asn、isp、org、city、region、
+                                country、country_code，PATH 为以点分隔的 JSON 路径
+  --metadata-ttl DURATION       元数据查询结果的缓存时长，0 表示不缓存（默认 24h）
+  --cache-dir DIR               缓存目录（默认为系统用户缓存目录下的 inetspeed-cli）
+  --discovery-ttl DURATION      在此时长内沿用上次发现的节点（健康探测通过时），不重新发现；
+                                交互选择与 --compare-endpoints 时不生效（默认 0，exporter 为 1h）
+  --resolver URL[,URL...]       使用指定的解析服务器发现节点，可重复，替代内置的 Cloudflare/AliDNS；
+                                支持 https:// (RFC 8484 DoH)、tls://HOST[:853] (DoT)、udp://HOST[:53]、tcp://HOST[:53]
+  --ecs SUBNET                  发现节点时携带 EDNS Client Subnet，如 203.0.113.0/24；单个 IP 按 /24（IPv6 为 /56）处理
+  --ecs-map SUBNET[,SUBNET...]  测速前逐个子网查询并列出解析到的 CDN 节点，可重复
+  --prefer-family|--exclude-family 4|6
+  --prefer-cidr|--exclude-cidr CIDR[,CIDR...]
+  --prefer-asn|--exclude-asn ASN[,ASN...]
+  --prefer-country|--exclude-country CC[,CC...]
+  --prefer-desc|--exclude-desc REGEX
+                                按地址族、网段、ASN、国家代码或描述正则筛选发现的候选节点：
+                                prefer 使匹配的健康节点优先，exclude 使匹配的节点不参与探测与自动选择；
+                                ASN、国家与描述规则依赖元数据查询
+  --output FORMAT[=PATH]        额外输出格式，可重复，省略 PATH 时写到 stdout；
+                                ndjson 逐行输出事件流（阶段、进度、结果），最后一行为完整结果
+                                csv / tsv 每轮一行，便于表格处理
+                                markdown 输出 GitHub 风格 Markdown 汇总表格，便于贴到 issue 或 CI
+                                prom-textfile=PATH 原子写入 node_exporter 文本文件
+  --append                      追加写入 --output 文件；csv/tsv 在文件已存在时跳过表头
+  --no-header                   csv/tsv 不输出表头
+  --report PATH                 生成自包含 HTML 报告（含候选节点、连接信息、延迟分布与吞吐曲线）
+  --dashboard                   终端全屏仪表盘：实时吞吐曲线、各连接进度、负载延迟与候选节点
+
+Exporter 选项:
+  --listen ADDR                 Prometheus 指标监听地址（默认 %q）
+  --interval DURATION           定时测速间隔，如 30m；0 表示仅在 /probe 时测速（默认 0）
 
 环境变量:
   DL_URL, UL_URL, LATENCY_URL, MAX, TIMEOUT, THREADS, LATENCY_COUNT
   SPEEDTEST_LANG, LC_ALL, LC_MESSAGES, LANGUAGE, LANG
-`, DefaultDLURL, DefaultULURL, DefaultLatencyURL, DefaultMax, DefaultTimeout, DefaultThreads, DefaultLatencyCount)
+  SSLKEYLOGFILE, IPINFO_TOKEN
+`, DefaultDLURL, DefaultULURL, DefaultLatencyURL, DefaultMax, DefaultTimeout, DefaultThreads, DefaultLatencyCount, DefaultListen)
 	}
 
 	return fmt.Sprintf(`Usage:
   speedtest [options]
+  speedtest exporter [options]
   speedtest help
 
 Options:
@@ -87,13 +326,79 @@ Options:
   --latency-count N             Latency sample count, 1-100 (default from LATENCY_COUNT or %d)
   --json                        Output a single JSON document to stdout
   --non-interactive             Disable endpoint prompt and auto-select
-  --endpoint IP                 Force a specific endpoint IP and skip discovery
+  --endpoint IP[,IP...]         Force a specific endpoint IP and skip discovery; several IPs are compared
+  --compare-endpoints           Run the full test against every candidate and rank them
+  --interface NAME              Bind every connection to a network interface (SO_BINDTODEVICE on Linux)
+  --source IP                   Bind every connection to a local source address
+  --proxy URL                   Send all traffic through a proxy (http://, https://, socks5://, optional user:pass@)
+  --metadata-proxy URL          Proxy for discovery and metadata lookups, overrides --proxy; "direct" disables
+  --measure-proxy URL           Proxy for probes and transfers, overrides --proxy; "direct" disables
+  --ca-file PATH                Trust extra CA certificates (PEM), e.g. for self-hosted servers on an internal PKI
+  --cert PATH, --key PATH       mTLS client certificate and key (PEM)
+  --tls-min VER, --tls-max VER  TLS version bounds: 1.0, 1.1, 1.2, 1.3 (minimum 1.2 by default)
+  --tls-ciphers NAME[,NAME...]  Cipher suites allowed for TLS 1.2 and below (order is ignored, TLS 1.3 suites are not configurable), e.g. TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256
+  --keylog-file PATH            Write TLS session secrets in NSS key log format to decrypt captures (default from SSLKEYLOGFILE)
+  --dscp EF|AF41|CS1|N          Mark probe, latency and transfer traffic with this DSCP (IP_TOS / IPV6_TCLASS) to verify QoS policy
+  --rcvbuf SIZE, --sndbuf SIZE  Socket receive/send buffer for measurement connections (SO_RCVBUF / SO_SNDBUF), e.g. 16M
+  --tcp-nodelay on|off          TCP_NODELAY for measurement connections (default on)
+  --notsent-lowat SIZE          TCP_NOTSENT_LOWAT for measurement connections (Linux, macOS)
+  --mptcp                       Try Multipath TCP for measurement connections (Linux 5.6+)
+  -4, -6                        Use only IPv4 / IPv6 for discovery, pinning and latency probes
+  --dual-stack                  Run the full test over IPv4 and over IPv6 and report the difference
   --no-metadata                 Skip client/server ASN and location lookup
+  --metadata-provider NAME|URL  Metadata source: ip-api (default, plain HTTP), ipinfo, ripestat, mmdb,
+                                or a JSON API URL template containing {ip}
+  --mmdb PATH[,PATH...]         MaxMind / DB-IP databases (City, Country, ASN) for offline lookups, repeatable;
+                                implies --metadata-provider mmdb
+  --metadata-token TOKEN        ipinfo access token (default from IPINFO_TOKEN)
+  --metadata-fields KEY=PATH[,KEY=PATH...]
+                                Field mapping for a URL template: KEY is ip, asn, isp, org, city, region,
+                                country or country_code, PATH a dot-separated JSON path
+  --metadata-ttl DURATION       Reuse cached metadata lookups for this long; 0 disables the cache (default 24h)
+  --cache-dir DIR               Cache directory (default inetspeed-cli under the user cache directory)
+  --discovery-ttl DURATION      Keep the previously discovered endpoint for this long while it probes healthy;
+                                not used with the interactive prompt or --compare-endpoints (default 0, exporter 1h)
+  --resolver URL[,URL...]       Discover endpoints via these resolvers instead of Cloudflare/AliDNS, repeatable:
+                                https:// (RFC 8484 DoH), tls://HOST[:853] (DoT), udp://HOST[:53], tcp://HOST[:53]
+  --ecs SUBNET                  Send EDNS Client Subnet in discovery queries, e.g. 203.0.113.0/24; a bare IP means /24 (/56 for IPv6)
+  --ecs-map SUBNET[,SUBNET...]  Before the test, list the CDN nodes returned for each subnet; repeatable
+  --prefer-family|--exclude-family 4|6
+  --prefer-cidr|--exclude-cidr CIDR[,CIDR...]
+  --prefer-asn|--exclude-asn ASN[,ASN...]
+  --prefer-country|--exclude-country CC[,CC...]
+  --prefer-desc|--exclude-desc REGEX
+                                Filter discovered candidates by family, prefix, ASN, country code or description:
+                                prefer ranks matching healthy candidates first, exclude skips matching ones;
+                                ASN, country and description rules need metadata lookup
+  --output FORMAT[=PATH]        Extra output, repeatable; writes to stdout when PATH is omitted:
+                                ndjson streams phase/progress/result events, ending with the full result
+                                csv / tsv write one row per round for spreadsheets
+                                markdown writes GitHub-flavoured summary tables for issues and CI
+                                prom-textfile=PATH atomically writes a node_exporter textfile
+  --append                      Append to --output files; csv/tsv skip the header if the file exists
+  --no-header                   Omit the csv/tsv header row
+  --report PATH                 Write a self-contained HTML report with candidates, connection info and charts
+  --dashboard                   Full-screen terminal dashboard with live throughput, connections and latency
+
+Exporter options:
+  --listen ADDR                 Prometheus metrics listen address (default %q)
+  --interval DURATION           Scheduled run interval, e.g. 30m; 0 runs only on /probe (default 0)
 
 Environment variables:
   DL_URL, UL_URL, LATENCY_URL, MAX, TIMEOUT, THREADS, LATENCY_COUNT
   SPEEDTEST_LANG, LC_ALL, LC_MESSAGES, LANGUAGE, LANG
-`, DefaultDLURL, DefaultULURL, DefaultLatencyURL, DefaultMax, DefaultTimeout, DefaultThreads, DefaultLatencyCount)
+  SSLKEYLOGFILE, IPINFO_TOKEN
+`, DefaultDLURL, DefaultULURL, DefaultLatencyURL, DefaultMax, DefaultTimeout, DefaultThreads, DefaultLatencyCount, DefaultListen)
+}
+
+// defaultCacheDir is inetspeed-cli under the user cache directory, or empty
+// when the platform has none.
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "inetspeed-cli")
 }
 
 func Load(args ...string) (*Config, error) {
@@ -107,6 +412,12 @@ func Load(args ...string) (*Config, error) {
 		return nil, ErrHelp
 	}
 
+	command := ""
+	if len(args) > 0 && args[0] == CommandExporter {
+		command = CommandExporter
+		args = args[1:]
+	}
+
 	dlURL := envOr("DL_URL", DefaultDLURL)
 	ulURL := envOr("UL_URL", DefaultULURL)
 	latencyURL := envOr("LATENCY_URL", DefaultLatencyURL)
@@ -118,6 +429,39 @@ func Load(args ...string) (*Config, error) {
 	nonInteractive := false
 	endpointIP := ""
 	noMetadata := false
+	listen := DefaultListen
+	var interval time.Duration
+	var outputs outputList
+	outputAppend := false
+	noHeader := false
+	report := ""
+	dashboard := false
+	compareEndpoints := false
+	var resolvers stringList
+	ecs := ""
+	var ecsMap stringList
+	var prefer, exclude matchFlags
+	ipv4, ipv6, dualStack := false, false, false
+	iface, source := "", ""
+	proxyURL, metadataProxy, measureProxy := "", "", ""
+	caFile, certFile, keyFile := "", "", ""
+	tlsMin, tlsMax := "", ""
+	var tlsCiphers stringList
+	keyLogFile := os.Getenv("SSLKEYLOGFILE")
+	dscp := ""
+	rcvBuf, sndBuf, notSentLowat := "", "", ""
+	tcpNoDelay := ""
+	mptcp := false
+	metadataProvider := ""
+	metadataToken := os.Getenv("IPINFO_TOKEN")
+	var metadataFields stringList
+	var mmdbPaths stringList
+	metadataTTL := DefaultMetadataTTL
+	cacheDir := defaultCacheDir()
+	var discoveryTTL time.Duration
+	if command == CommandExporter {
+		discoveryTTL = DefaultExporterDiscoveryTTL
+	}
 
 	if len(args) > 0 {
 		fs := flag.NewFlagSet("speedtest", flag.ContinueOnError)
@@ -136,8 +480,51 @@ func Load(args ...string) (*Config, error) {
 		fs.IntVar(&latencyCount, "latency-count", latencyCount, "latency sample count")
 		fs.BoolVar(&outputJSON, "json", outputJSON, "output JSON")
 		fs.BoolVar(&nonInteractive, "non-interactive", nonInteractive, "disable interactive endpoint selection")
-		fs.StringVar(&endpointIP, "endpoint", endpointIP, "force endpoint IP")
+		fs.StringVar(&endpointIP, "endpoint", endpointIP, "force endpoint IP, or a comma-separated list to compare")
+		fs.BoolVar(&compareEndpoints, "compare-endpoints", compareEndpoints, "measure every candidate endpoint")
+		fs.BoolVar(&ipv4, "4", ipv4, "use IPv4 only")
+		fs.BoolVar(&ipv6, "6", ipv6, "use IPv6 only")
+		fs.BoolVar(&dualStack, "dual-stack", dualStack, "test IPv4 and IPv6 separately")
+		fs.StringVar(&iface, "interface", iface, "bind to network interface")
+		fs.StringVar(&source, "source", source, "bind to local address")
+		fs.StringVar(&proxyURL, "proxy", proxyURL, "proxy for all traffic")
+		fs.StringVar(&metadataProxy, "metadata-proxy", metadataProxy, "proxy for discovery and metadata")
+		fs.StringVar(&measureProxy, "measure-proxy", measureProxy, "proxy for measurement")
+		fs.StringVar(&caFile, "ca-file", caFile, "extra CA bundle")
+		fs.StringVar(&certFile, "cert", certFile, "client certificate")
+		fs.StringVar(&keyFile, "key", keyFile, "client key")
+		fs.StringVar(&tlsMin, "tls-min", tlsMin, "minimum TLS version")
+		fs.StringVar(&tlsMax, "tls-max", tlsMax, "maximum TLS version")
+		fs.Var(&tlsCiphers, "tls-ciphers", "allowed TLS 1.2 cipher suites, repeatable")
+		fs.StringVar(&keyLogFile, "keylog-file", keyLogFile, "write TLS key log")
+		fs.StringVar(&dscp, "dscp", dscp, "DSCP marking for measurement traffic")
+		fs.StringVar(&rcvBuf, "rcvbuf", rcvBuf, "socket receive buffer")
+		fs.StringVar(&sndBuf, "sndbuf", sndBuf, "socket send buffer")
+		fs.StringVar(&notSentLowat, "notsent-lowat", notSentLowat, "TCP_NOTSENT_LOWAT")
+		fs.StringVar(&tcpNoDelay, "tcp-nodelay", tcpNoDelay, "TCP_NODELAY on or off")
+		fs.BoolVar(&mptcp, "mptcp", mptcp, "use Multipath TCP")
 		fs.BoolVar(&noMetadata, "no-metadata", noMetadata, "skip metadata lookup")
+		fs.StringVar(&metadataProvider, "metadata-provider", metadataProvider, "metadata provider")
+		fs.StringVar(&metadataToken, "metadata-token", metadataToken, "ipinfo token")
+		fs.Var(&metadataFields, "metadata-fields", "template field mapping, repeatable")
+		fs.Var(&mmdbPaths, "mmdb", "MaxMind DB files, repeatable")
+		fs.DurationVar(&metadataTTL, "metadata-ttl", metadataTTL, "metadata cache TTL")
+		fs.StringVar(&cacheDir, "cache-dir", cacheDir, "cache directory")
+		fs.DurationVar(&discoveryTTL, "discovery-ttl", discoveryTTL, "reuse the discovered endpoint for this long")
+		fs.Var(&resolvers, "resolver", "DoH resolver URL, repeatable")
+		fs.StringVar(&ecs, "ecs", ecs, "EDNS Client Subnet for discovery")
+		fs.Var(&ecsMap, "ecs-map", "subnets to map, repeatable")
+		prefer.register(fs, "prefer")
+		exclude.register(fs, "exclude")
+		fs.Var(&outputs, "output", "extra output FORMAT[=PATH]")
+		fs.BoolVar(&outputAppend, "append", outputAppend, "append to output files")
+		fs.BoolVar(&noHeader, "no-header", noHeader, "omit csv/tsv header row")
+		fs.StringVar(&report, "report", report, "write HTML report")
+		fs.BoolVar(&dashboard, "dashboard", dashboard, "full-screen dashboard")
+		if command == CommandExporter {
+			fs.StringVar(&listen, "listen", listen, "exporter listen address")
+			fs.DurationVar(&interval, "interval", interval, "scheduled run interval")
+		}
 
 		if err := fs.Parse(args); err != nil {
 			return nil, err
@@ -155,17 +542,68 @@ func Load(args ...string) (*Config, error) {
 	}
 
 	c := &Config{
-		DLURL:          dlURL,
-		ULURL:          ulURL,
-		LatencyURL:     latencyURL,
-		Max:            maxValue,
-		Timeout:        timeout,
-		Threads:        threads,
-		LatencyCount:   latencyCount,
-		OutputJSON:     outputJSON,
-		NonInteractive: nonInteractive,
-		EndpointIP:     endpointIP,
-		NoMetadata:     noMetadata,
+		DLURL:            dlURL,
+		ULURL:            ulURL,
+		LatencyURL:       latencyURL,
+		Max:              maxValue,
+		Timeout:          timeout,
+		Threads:          threads,
+		LatencyCount:     latencyCount,
+		OutputJSON:       outputJSON,
+		NonInteractive:   nonInteractive,
+		EndpointIP:       endpointIP,
+		NoMetadata:       noMetadata,
+		Command:          command,
+		Outputs:          outputs,
+		OutputAppend:     outputAppend,
+		NoHeader:         noHeader,
+		Report:           report,
+		Dashboard:        dashboard,
+		CompareEndpoints: compareEndpoints,
+		Resolvers:        resolvers,
+		DualStack:        dualStack,
+		Interface:        iface,
+		Source:           source,
+		MetadataProxy:    cmp.Or(metadataProxy, proxyURL),
+		MeasureProxy:     cmp.Or(measureProxy, proxyURL),
+		CAFile:           caFile,
+		CertFile:         certFile,
+		KeyFile:          keyFile,
+		KeyLogFile:       keyLogFile,
+		DSCP:             strings.ToUpper(strings.TrimSpace(dscp)),
+		TCPNoDelay:       strings.ToLower(strings.TrimSpace(tcpNoDelay)),
+		MPTCP:            mptcp,
+		MetadataProvider: strings.TrimSpace(metadataProvider),
+		MetadataToken:    metadataToken,
+		MMDBPaths:        mmdbPaths,
+		MetadataTTL:      metadataTTL,
+		CacheDir:         cacheDir,
+		DiscoveryTTL:     discoveryTTL,
+	}
+	if ipv4 {
+		c.Family = 4
+	}
+	if ipv6 {
+		c.Family = 6
+	}
+	if strings.Contains(c.EndpointIP, ",") {
+		for _, ip := range strings.Split(c.EndpointIP, ",") {
+			if ip = strings.TrimSpace(ip); ip != "" {
+				c.EndpointIPs = append(c.EndpointIPs, ip)
+			}
+		}
+		c.EndpointIP = ""
+		if len(c.EndpointIPs) == 1 {
+			c.EndpointIP = c.EndpointIPs[0]
+			c.EndpointIPs = nil
+		} else {
+			c.CompareEndpoints = true
+		}
+	}
+	if command == CommandExporter {
+		c.Listen = listen
+		c.Interval = interval
+		c.NonInteractive = true
 	}
 
 	var err error
@@ -197,11 +635,222 @@ func Load(args ...string) (*Config, error) {
 	if c.LatencyCount > 100 {
 		return nil, errors.New(i18n.Text("LATENCY_COUNT must be <= 100", "LATENCY_COUNT 必须小于等于 100"))
 	}
-	if c.EndpointIP != "" && net.ParseIP(c.EndpointIP) == nil {
+	if c.Interface != "" {
+		if _, err := net.InterfaceByName(c.Interface); err != nil {
+			if i18n.IsZH() {
+				return nil, fmt.Errorf("无效的 --interface %q: %v", c.Interface, err)
+			}
+			return nil, fmt.Errorf("invalid --interface %q: %v", c.Interface, err)
+		}
+	}
+	if c.Source != "" {
+		addr, err := netip.ParseAddr(c.Source)
+		if err != nil || addr.Zone() != "" {
+			if i18n.IsZH() {
+				return nil, fmt.Errorf("无效的 --source 地址: %q", c.Source)
+			}
+			return nil, fmt.Errorf("invalid --source address: %q", c.Source)
+		}
+		c.Source = addr.Unmap().String()
+		if c.DualStack {
+			return nil, errors.New(i18n.Text("--source cannot be combined with --dual-stack", "--source 不能与 --dual-stack 同时使用"))
+		}
+		if c.Family != 0 && addr.Unmap().Is4() != (c.Family == 4) {
+			if i18n.IsZH() {
+				return nil, fmt.Errorf("--source %q 与 -%d 不符", c.Source, c.Family)
+			}
+			return nil, fmt.Errorf("--source %q does not match -%d", c.Source, c.Family)
+		}
+	}
+	for _, p := range []*string{&c.MetadataProxy, &c.MeasureProxy} {
+		if *p == "direct" {
+			*p = ""
+		}
+		if err := validateProxy(*p); err != nil {
+			return nil, err
+		}
+	}
+	if c.DSCP != "" {
+		v, err := ParseDSCP(c.DSCP)
+		if err != nil {
+			return nil, err
+		}
+		c.DSCPValue = v
+	}
+	for _, v := range []struct {
+		flag  string
+		value string
+		dst   *int
+	}{{"--rcvbuf", rcvBuf, &c.RcvBuf}, {"--sndbuf", sndBuf, &c.SndBuf}, {"--notsent-lowat", notSentLowat, &c.NotSentLowat}} {
+		if v.value == "" {
+			continue
+		}
+		n, err := ParseSize(v.value)
+		if err != nil || n <= 0 || n > math.MaxInt32 {
+			if i18n.IsZH() {
+				return nil, fmt.Errorf("无效的 %s %q：需要 1 字节到 2GiB 之间的大小", v.flag, v.value)
+			}
+			return nil, fmt.Errorf("invalid %s %q: expected a size between 1 byte and 2GiB", v.flag, v.value)
+		}
+		*v.dst = int(n)
+	}
+	if len(c.MMDBPaths) > 0 {
+		if c.MetadataProvider == "" {
+			c.MetadataProvider = "mmdb"
+		}
+		if c.MetadataProvider != "mmdb" {
+			return nil, errors.New(i18n.Text("--mmdb needs --metadata-provider mmdb", "--mmdb 只能与 --metadata-provider mmdb 同时使用"))
+		}
+	}
+	for _, field := range metadataFields {
+		key, path, ok := strings.Cut(field, "=")
+		if !ok || key == "" || path == "" {
+			if i18n.IsZH() {
+				return nil, fmt.Errorf("无效的 --metadata-fields %q：需要 KEY=PATH", field)
+			}
+			return nil, fmt.Errorf("invalid --metadata-fields %q: expected KEY=PATH", field)
+		}
+		if c.MetadataFields == nil {
+			c.MetadataFields = map[string]string{}
+		}
+		c.MetadataFields[key] = path
+	}
+	if c.MetadataTTL < 0 {
+		return nil, errors.New(i18n.Text("--metadata-ttl must be >= 0", "--metadata-ttl 必须大于等于 0"))
+	}
+	if c.DiscoveryTTL < 0 {
+		return nil, errors.New(i18n.Text("--discovery-ttl must be >= 0", "--discovery-ttl 必须大于等于 0"))
+	}
+	if c.TCPNoDelay != "" && c.TCPNoDelay != "on" && c.TCPNoDelay != "off" {
 		if i18n.IsZH() {
-			return nil, fmt.Errorf("节点 IP 无效 %q", c.EndpointIP)
+			return nil, fmt.Errorf("无效的 --tcp-nodelay %q：可选 on 或 off", tcpNoDelay)
+		}
+		return nil, fmt.Errorf("invalid --tcp-nodelay %q: expected on or off", tcpNoDelay)
+	}
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return nil, errors.New(i18n.Text("--cert and --key must be given together", "--cert 与 --key 必须同时指定"))
+	}
+	for _, v := range []struct {
+		flag  string
+		value string
+		dst   *uint16
+	}{{"--tls-min", tlsMin, &c.TLSMin}, {"--tls-max", tlsMax, &c.TLSMax}} {
+		if v.value == "" {
+			continue
+		}
+		version, ok := tlsVersions[v.value]
+		if !ok {
+			if i18n.IsZH() {
+				return nil, fmt.Errorf("无效的 %s %q：可选 1.0、1.1、1.2、1.3", v.flag, v.value)
+			}
+			return nil, fmt.Errorf("invalid %s %q: expected 1.0, 1.1, 1.2 or 1.3", v.flag, v.value)
+		}
+		*v.dst = version
+	}
+	if c.TLSMin != 0 && c.TLSMax != 0 && c.TLSMin > c.TLSMax {
+		return nil, errors.New(i18n.Text("--tls-min must not exceed --tls-max", "--tls-min 不能高于 --tls-max"))
+	}
+	for _, name := range tlsCiphers {
+		suite := cipherSuite(name)
+		if suite == nil {
+			if i18n.IsZH() {
+				return nil, fmt.Errorf("未知的密码套件 %q", name)
+			}
+			return nil, fmt.Errorf("unknown cipher suite %q", name)
+		}
+		// Go always negotiates its own TLS 1.3 suites and would silently
+		// ignore these.
+		if slices.Equal(suite.SupportedVersions, []uint16{tls.VersionTLS13}) {
+			if i18n.IsZH() {
+				return nil, fmt.Errorf("%s 是 TLS 1.3 密码套件，不可配置；--tls-ciphers 只限定 TLS 1.2 及以下的套件", suite.Name)
+			}
+			return nil, fmt.Errorf("%s is a TLS 1.3 cipher suite, which cannot be configured; --tls-ciphers only restricts TLS 1.2 and below", suite.Name)
+		}
+		c.TLSCiphers = append(c.TLSCiphers, suite.ID)
+	}
+	if c.MetadataProxy != "" {
+		for _, resolver := range c.Resolvers {
+			if strings.HasPrefix(resolver, "udp://") {
+				return nil, errors.New(i18n.Text("udp:// resolvers cannot be reached through a proxy; use tcp://, tls:// or https://", "udp:// 解析服务器无法经代理访问，请改用 tcp://、tls:// 或 https://"))
+			}
 		}
-		return nil, fmt.Errorf("invalid endpoint IP %q", c.EndpointIP)
+	}
+	for _, ip := range append([]string{c.EndpointIP}, c.EndpointIPs...) {
+		if ip != "" && net.ParseIP(ip) == nil {
+			if i18n.IsZH() {
+				return nil, fmt.Errorf("节点 IP 无效 %q", ip)
+			}
+			return nil, fmt.Errorf("invalid endpoint IP %q", ip)
+		}
+	}
+	for _, resolver := range c.Resolvers {
+		if err := validateResolver(resolver); err != nil {
+			return nil, err
+		}
+	}
+	if ecs != "" {
+		if c.ECS, err = parseSubnet(ecs); err != nil {
+			return nil, err
+		}
+	}
+	for _, subnet := range ecsMap {
+		prefix, err := parseSubnet(subnet)
+		if err != nil {
+			return nil, err
+		}
+		c.ECSMap = append(c.ECSMap, prefix)
+	}
+	if c.Prefer, err = prefer.parse("prefer"); err != nil {
+		return nil, err
+	}
+	if c.Exclude, err = exclude.parse("exclude"); err != nil {
+		return nil, err
+	}
+	if c.NoMetadata && (c.Prefer.NeedsMetadata() || c.Exclude.NeedsMetadata()) {
+		return nil, errors.New(i18n.Text("ASN, country and description rules need metadata; remove --no-metadata", "ASN、国家与描述规则依赖元数据查询，请去掉 --no-metadata"))
+	}
+	if ipv4 && ipv6 {
+		return nil, errors.New(i18n.Text("-4 and -6 are mutually exclusive", "-4 与 -6 不能同时使用"))
+	}
+	if c.DualStack && (c.Family != 0 || c.CompareEndpoints || c.EndpointIP != "") {
+		return nil, errors.New(i18n.Text("--dual-stack cannot be combined with -4, -6, --endpoint or --compare-endpoints", "--dual-stack 不能与 -4、-6、--endpoint 或 --compare-endpoints 同时使用"))
+	}
+	if c.DualStack && c.Command == CommandExporter {
+		return nil, errors.New(i18n.Text("--dual-stack is not supported by the exporter", "exporter 不支持 --dual-stack"))
+	}
+	for _, ip := range append([]string{c.EndpointIP}, c.EndpointIPs...) {
+		if addr, err := netip.ParseAddr(ip); err == nil && c.Family != 0 && addr.Unmap().Is4() != (c.Family == 4) {
+			if i18n.IsZH() {
+				return nil, fmt.Errorf("节点 IP %q 与 -%d 不符", ip, c.Family)
+			}
+			return nil, fmt.Errorf("endpoint IP %q does not match -%d", ip, c.Family)
+		}
+	}
+	if c.CompareEndpoints && c.Command == CommandExporter {
+		return nil, errors.New(i18n.Text("--compare-endpoints is not supported by the exporter", "exporter 不支持 --compare-endpoints"))
+	}
+	if c.Command == CommandExporter {
+		if c.Listen == "" {
+			return nil, errors.New(i18n.Text("--listen must not be empty", "--listen 不能为空"))
+		}
+		if c.Interval < 0 {
+			return nil, errors.New(i18n.Text("--interval must be >= 0", "--interval 必须大于等于 0"))
+		}
+	}
+	stdoutUsers := 0
+	if c.OutputJSON {
+		stdoutUsers++
+	}
+	for _, o := range c.Outputs {
+		if err := validateOutput(o); err != nil {
+			return nil, err
+		}
+		if o.Path == "" {
+			stdoutUsers++
+		}
+	}
+	if stdoutUsers > 1 {
+		return nil, errors.New(i18n.Text("Only one of --json and --output without a path may write to stdout", "--json 与未指定路径的 --output 只能有一个输出到 stdout"))
 	}
 	for _, u := range []struct{ name, val string }{
 		{"DL_URL", c.DLURL},
@@ -218,6 +867,197 @@ func Load(args ...string) (*Config, error) {
 	return c, nil
 }
 
+func validateOutput(o Output) error {
+	switch o.Format {
+	case OutputNDJSON, OutputCSV, OutputTSV, OutputMarkdown:
+	case OutputPromTextfile:
+		if o.Path == "" {
+			if i18n.IsZH() {
+				return fmt.Errorf("--output %s 需要指定路径，如 %s=/path/speedtest.prom", o.Format, o.Format)
+			}
+			return fmt.Errorf("--output %s requires a path, e.g. %s=/path/speedtest.prom", o.Format, o.Format)
+		}
+	default:
+		if i18n.IsZH() {
+			return fmt.Errorf("不支持的输出格式 %q", o.Format)
+		}
+		return fmt.Errorf("unsupported output format %q", o.Format)
+	}
+	return nil
+}
+
+func validateResolver(spec string) error {
+	u, err := url.Parse(spec)
+	valid := err == nil && u.Hostname() != ""
+	if valid {
+		switch u.Scheme {
+		case "https", "http":
+		case "udp", "tcp", "tls":
+			valid = u.Path == "" || u.Path == "/"
+		default:
+			valid = false
+		}
+	}
+	if !valid {
+		if i18n.IsZH() {
+			return fmt.Errorf("解析服务器无效 %q：需要 https:// DoH 地址，或 tls://、udp://、tcp:// 加主机[:端口]", spec)
+		}
+		return fmt.Errorf("invalid resolver %q: expected an https:// DoH URL or tls://, udp://, tcp:// HOST[:PORT]", spec)
+	}
+	return nil
+}
+
+// dscpNames maps the standard per-hop behaviour names to code points.
+var dscpNames = map[string]int{
+	"CS0": 0, "CS1": 8, "CS2": 16, "CS3": 24, "CS4": 32, "CS5": 40, "CS6": 48, "CS7": 56,
+	"AF11": 10, "AF12": 12, "AF13": 14,
+	"AF21": 18, "AF22": 20, "AF23": 22,
+	"AF31": 26, "AF32": 28, "AF33": 30,
+	"AF41": 34, "AF42": 36, "AF43": 38,
+	"EF": 46, "VA": 44, "LE": 1, "BE": 0, "DF": 0,
+}
+
+// ParseDSCP accepts a PHB name such as EF, AF41 or CS1, or a code point
+// from 0 to 63.
+func ParseDSCP(s string) (int, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if v, ok := dscpNames[s]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < 0 || v > 63 {
+		if i18n.IsZH() {
+			return 0, fmt.Errorf("无效的 --dscp %q：需要 EF、AF11–AF43、CS0–CS7、LE 等名称或 0–63", s)
+		}
+		return 0, fmt.Errorf("invalid --dscp %q: expected a name such as EF, AF11-AF43, CS0-CS7, LE or 0-63", s)
+	}
+	return v, nil
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// cipherSuite looks up a cipher suite by its IANA name, e.g.
+// TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256, including the insecure ones.
+func cipherSuite(name string) *tls.CipherSuite {
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		if strings.EqualFold(suite.Name, name) {
+			return suite
+		}
+	}
+	return nil
+}
+
+// validateProxy accepts an http, https, socks5 or socks5h proxy URL with
+// optional credentials, or an empty string.
+func validateProxy(spec string) error {
+	if spec == "" {
+		return nil
+	}
+	u, err := url.Parse(spec)
+	valid := err == nil && u.Hostname() != "" && (u.Path == "" || u.Path == "/")
+	if valid {
+		switch u.Scheme {
+		case "http", "https", "socks5", "socks5h":
+		default:
+			valid = false
+		}
+	}
+	if !valid {
+		if i18n.IsZH() {
+			return fmt.Errorf("代理地址无效 %q：需要 http://、https://、socks5:// 或 socks5h:// 加 [用户:密码@]主机[:端口]，或 direct", spec)
+		}
+		return fmt.Errorf("invalid proxy %q: expected http://, https://, socks5:// or socks5h:// [USER:PASS@]HOST[:PORT], or direct", spec)
+	}
+	return nil
+}
+
+// matchFlags collects the raw --prefer-* or --exclude-* values.
+type matchFlags struct {
+	families, cidrs, asns, countries stringList
+	desc                             string
+}
+
+func (m *matchFlags) register(fs *flag.FlagSet, kind string) {
+	fs.Var(&m.families, kind+"-family", "address family 4 or 6")
+	fs.Var(&m.cidrs, kind+"-cidr", "address prefixes")
+	fs.Var(&m.asns, kind+"-asn", "AS numbers")
+	fs.Var(&m.countries, kind+"-country", "ISO country codes")
+	fs.StringVar(&m.desc, kind+"-desc", "", "description regular expression")
+}
+
+func (m *matchFlags) parse(kind string) (Match, error) {
+	invalid := func(name, value string) error {
+		if i18n.IsZH() {
+			return fmt.Errorf("--%s-%s 值无效 %q", kind, name, value)
+		}
+		return fmt.Errorf("invalid --%s-%s %q", kind, name, value)
+	}
+	var out Match
+	for _, v := range m.families {
+		switch strings.TrimPrefix(strings.ToLower(v), "ipv") {
+		case "4":
+			out.Families = append(out.Families, 4)
+		case "6":
+			out.Families = append(out.Families, 6)
+		default:
+			return Match{}, invalid("family", v)
+		}
+	}
+	for _, v := range m.cidrs {
+		prefix, err := netip.ParsePrefix(v)
+		if err != nil {
+			return Match{}, invalid("cidr", v)
+		}
+		out.CIDRs = append(out.CIDRs, prefix.Masked())
+	}
+	for _, v := range m.asns {
+		n, err := strconv.Atoi(strings.TrimPrefix(strings.ToUpper(v), "AS"))
+		if err != nil || n <= 0 {
+			return Match{}, invalid("asn", v)
+		}
+		out.ASNs = append(out.ASNs, n)
+	}
+	for _, v := range m.countries {
+		if len(v) != 2 {
+			return Match{}, invalid("country", v)
+		}
+		out.Countries = append(out.Countries, strings.ToUpper(v))
+	}
+	if m.desc != "" {
+		if _, err := regexp.Compile(m.desc); err != nil {
+			return Match{}, invalid("desc", m.desc)
+		}
+		out.Desc = m.desc
+	}
+	return out, nil
+}
+
+// parseSubnet returns the masked CIDR form of s. A bare address is widened
+// to /24 or /56, the prefix lengths RFC 7871 recommends for privacy.
+func parseSubnet(s string) (string, error) {
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		addr, addrErr := netip.ParseAddr(s)
+		if addrErr != nil {
+			if i18n.IsZH() {
+				return "", fmt.Errorf("子网无效 %q", s)
+			}
+			return "", fmt.Errorf("invalid subnet %q", s)
+		}
+		bits := 24
+		if addr.Is6() {
+			bits = 56
+		}
+		prefix = netip.PrefixFrom(addr, bits)
+	}
+	return prefix.Masked().String(), nil
+}
+
 func (c *Config) Summary() string {
 	if i18n.IsZH() {
 		return fmt.Sprintf("超时=%ds  上限=%s  线程=%d  延迟采样=%d  JSON=%t  无交互=%t  元数据=%t",
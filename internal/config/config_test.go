@@ -1,9 +1,13 @@
 package config
 
 import (
+	"crypto/tls"
 	"errors"
+	"net"
 	"os"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/tsosunchia/iNetSpeed-CLI/internal/i18n"
 )
@@ -336,3 +340,376 @@ func TestLoadInvalidEndpointIP(t *testing.T) {
 		t.Fatal("expected invalid endpoint IP to fail")
 	}
 }
+
+func TestLoadExporterCommand(t *testing.T) {
+	cfg, err := Load("exporter", "--listen", "127.0.0.1:9999", "--interval", "30m", "--threads", "2")
+	if err != nil {
+		t.Fatalf("Load() should succeed: %v", err)
+	}
+	if cfg.Command != CommandExporter {
+		t.Fatalf("Command = %q", cfg.Command)
+	}
+	if cfg.Listen != "127.0.0.1:9999" || cfg.Interval.Minutes() != 30 {
+		t.Fatalf("Listen/Interval = %q/%v", cfg.Listen, cfg.Interval)
+	}
+	if cfg.Threads != 2 || !cfg.NonInteractive {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+
+	cfg, err = Load("exporter")
+	if err != nil {
+		t.Fatalf("Load(exporter) should succeed: %v", err)
+	}
+	if cfg.Listen != DefaultListen {
+		t.Fatalf("Listen = %q, want %q", cfg.Listen, DefaultListen)
+	}
+}
+
+func TestLoadListenRequiresExporter(t *testing.T) {
+	if _, err := Load("--listen", ":9516"); err == nil {
+		t.Fatal("expected --listen outside exporter mode to fail")
+	}
+}
+
+func TestLoadOutputs(t *testing.T) {
+	cfg, err := Load("--output", "prom-textfile=/var/lib/node_exporter/speedtest.prom")
+	if err != nil {
+		t.Fatalf("Load() should succeed: %v", err)
+	}
+	want := []Output{{Format: OutputPromTextfile, Path: "/var/lib/node_exporter/speedtest.prom"}}
+	if len(cfg.Outputs) != 1 || cfg.Outputs[0] != want[0] {
+		t.Fatalf("Outputs = %+v, want %+v", cfg.Outputs, want)
+	}
+
+	for _, args := range [][]string{
+		{"--output", "prom-textfile"},
+		{"--output", "yaml"},
+	} {
+		if _, err := Load(args...); err == nil {
+			t.Errorf("Load(%v) should fail", args)
+		}
+	}
+}
+
+func TestLoadStdoutOutputConflict(t *testing.T) {
+	cfg, err := Load("--output", "ndjson")
+	if err != nil {
+		t.Fatalf("Load() should succeed: %v", err)
+	}
+	if !cfg.StdoutOutput() {
+		t.Fatal("expected ndjson without path to write to stdout")
+	}
+	if _, err := Load("--json", "--output", "ndjson"); err == nil {
+		t.Fatal("expected --json and stdout ndjson to conflict")
+	}
+	cfg, err = Load("--json", "--output", "ndjson=events.ndjson")
+	if err != nil {
+		t.Fatalf("Load() with ndjson file should succeed: %v", err)
+	}
+	if len(cfg.Outputs) != 1 || cfg.Outputs[0].Path != "events.ndjson" {
+		t.Fatalf("Outputs = %+v", cfg.Outputs)
+	}
+}
+
+func TestLoadEndpointList(t *testing.T) {
+	cfg, err := Load("--endpoint", "17.253.85.205, 2403:300:a0c:f000::1")
+	if err != nil {
+		t.Fatalf("Load() should succeed: %v", err)
+	}
+	if cfg.EndpointIP != "" || len(cfg.EndpointIPs) != 2 || !cfg.CompareEndpoints {
+		t.Fatalf("expected list to enable comparison, got EndpointIP=%q EndpointIPs=%v compare=%t", cfg.EndpointIP, cfg.EndpointIPs, cfg.CompareEndpoints)
+	}
+
+	cfg, err = Load("--endpoint", "17.253.85.205,")
+	if err != nil {
+		t.Fatalf("Load() should succeed: %v", err)
+	}
+	if cfg.EndpointIP != "17.253.85.205" || cfg.EndpointIPs != nil || cfg.CompareEndpoints {
+		t.Fatalf("single entry should stay a forced endpoint, got %+v", cfg)
+	}
+
+	if _, err := Load("--endpoint", "17.253.85.205,bad"); err == nil {
+		t.Fatal("expected invalid IP in list to fail")
+	}
+	if _, err := Load("exporter", "--compare-endpoints"); err == nil {
+		t.Fatal("expected exporter to reject --compare-endpoints")
+	}
+}
+
+func TestLoadResolvers(t *testing.T) {
+	cfg, err := Load("--resolver", "https://dns.google/dns-query,https://dns.quad9.net/dns-query", "--resolver", "https://doh.example.com/q")
+	if err != nil {
+		t.Fatalf("Load() should succeed: %v", err)
+	}
+	want := []string{"https://dns.google/dns-query", "https://dns.quad9.net/dns-query", "https://doh.example.com/q"}
+	if !reflect.DeepEqual(cfg.Resolvers, want) {
+		t.Fatalf("Resolvers = %v, want %v", cfg.Resolvers, want)
+	}
+
+	cfg, err = Load("--resolver", "tls://1.1.1.1,udp://192.168.1.1:5353,tcp://[2001:db8::1]")
+	if err != nil {
+		t.Fatalf("Load() should accept DoT/UDP/TCP resolvers: %v", err)
+	}
+	if len(cfg.Resolvers) != 3 {
+		t.Fatalf("Resolvers = %v", cfg.Resolvers)
+	}
+
+	for _, bad := range []string{"8.8.8.8", "ftp://dns.example.com", "udp://8.8.8.8/dns-query", "tls://"} {
+		if _, err := Load("--resolver", bad); err == nil {
+			t.Fatalf("expected resolver %q to fail", bad)
+		}
+	}
+}
+
+func TestLoadECS(t *testing.T) {
+	cfg, err := Load("--ecs", "203.0.113.77", "--ecs-map", "198.51.100.9/24,2001:db8::1", "--ecs-map", "192.0.2.0/25")
+	if err != nil {
+		t.Fatalf("Load() should succeed: %v", err)
+	}
+	if cfg.ECS != "203.0.113.0/24" {
+		t.Fatalf("ECS = %q, want 203.0.113.0/24", cfg.ECS)
+	}
+	want := []string{"198.51.100.0/24", "2001:db8::/56", "192.0.2.0/25"}
+	if !reflect.DeepEqual(cfg.ECSMap, want) {
+		t.Fatalf("ECSMap = %v, want %v", cfg.ECSMap, want)
+	}
+
+	if _, err := Load("--ecs", "not-a-subnet"); err == nil {
+		t.Fatal("expected invalid --ecs to fail")
+	}
+	if _, err := Load("--ecs-map", "203.0.113.0/33"); err == nil {
+		t.Fatal("expected invalid --ecs-map entry to fail")
+	}
+}
+
+func TestLoadCandidateRules(t *testing.T) {
+	cfg, err := Load("--prefer-asn", "AS714,6185", "--exclude-cidr", "17.253.0.0/16", "--exclude-family", "6", "--prefer-country", "jp", "--prefer-desc", "(?i)tokyo")
+	if err != nil {
+		t.Fatalf("Load() should succeed: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.Prefer.ASNs, []int{714, 6185}) || !reflect.DeepEqual(cfg.Prefer.Countries, []string{"JP"}) || cfg.Prefer.Desc != "(?i)tokyo" {
+		t.Fatalf("unexpected Prefer %+v", cfg.Prefer)
+	}
+	if len(cfg.Exclude.CIDRs) != 1 || cfg.Exclude.CIDRs[0].String() != "17.253.0.0/16" || !reflect.DeepEqual(cfg.Exclude.Families, []int{6}) {
+		t.Fatalf("unexpected Exclude %+v", cfg.Exclude)
+	}
+
+	for _, args := range [][]string{
+		{"--prefer-family", "5"},
+		{"--exclude-cidr", "17.253.0.0"},
+		{"--prefer-asn", "apple"},
+		{"--exclude-country", "JPN"},
+		{"--prefer-desc", "("},
+		{"--prefer-asn", "714", "--no-metadata"},
+	} {
+		if _, err := Load(args...); err == nil {
+			t.Fatalf("expected %v to fail", args)
+		}
+	}
+}
+
+func TestLoadFamily(t *testing.T) {
+	cfg, err := Load("-6", "--endpoint", "2001:db8::1")
+	if err != nil {
+		t.Fatalf("Load() should succeed: %v", err)
+	}
+	if cfg.Family != 6 || cfg.DualStack {
+		t.Fatalf("Family = %d, DualStack = %v", cfg.Family, cfg.DualStack)
+	}
+	cfg, err = Load("--dual-stack")
+	if err != nil || !cfg.DualStack || cfg.Family != 0 {
+		t.Fatalf("Load(--dual-stack) = %+v, %v", cfg, err)
+	}
+
+	for _, args := range [][]string{
+		{"-4", "-6"},
+		{"-4", "--endpoint", "2001:db8::1"},
+		{"-6", "--endpoint", "17.253.85.205"},
+		{"--dual-stack", "-4"},
+		{"--dual-stack", "--compare-endpoints"},
+		{"--dual-stack", "--endpoint", "17.253.85.205"},
+		{"exporter", "--dual-stack"},
+	} {
+		if _, err := Load(args...); err == nil {
+			t.Fatalf("expected %v to fail", args)
+		}
+	}
+}
+
+func TestLoadBind(t *testing.T) {
+	ifaces, err := net.Interfaces()
+	if err != nil || len(ifaces) == 0 {
+		t.Skip("no network interfaces")
+	}
+	cfg, err := Load("--interface", ifaces[0].Name, "--source", "::ffff:192.0.2.10", "-4")
+	if err != nil {
+		t.Fatalf("Load() should succeed: %v", err)
+	}
+	if cfg.Interface != ifaces[0].Name || cfg.Source != "192.0.2.10" {
+		t.Fatalf("Interface = %q, Source = %q", cfg.Interface, cfg.Source)
+	}
+
+	for _, args := range [][]string{
+		{"--interface", "no-such-if0"},
+		{"--source", "eth0"},
+		{"--source", "192.0.2.10", "-6"},
+		{"--source", "192.0.2.10", "--dual-stack"},
+	} {
+		if _, err := Load(args...); err == nil {
+			t.Fatalf("expected %v to fail", args)
+		}
+	}
+}
+
+func TestLoadProxy(t *testing.T) {
+	cfg, err := Load("--proxy", "http://u:p@proxy.example:3128", "--measure-proxy", "direct")
+	if err != nil {
+		t.Fatalf("Load() should succeed: %v", err)
+	}
+	if cfg.MetadataProxy != "http://u:p@proxy.example:3128" || cfg.MeasureProxy != "" {
+		t.Fatalf("MetadataProxy = %q, MeasureProxy = %q", cfg.MetadataProxy, cfg.MeasureProxy)
+	}
+	cfg, err = Load("--measure-proxy", "socks5h://127.0.0.1:1080")
+	if err != nil || cfg.MetadataProxy != "" || cfg.MeasureProxy != "socks5h://127.0.0.1:1080" {
+		t.Fatalf("Load(--measure-proxy) = %+v, %v", cfg, err)
+	}
+
+	for _, args := range [][]string{
+		{"--proxy", "ftp://proxy.example"},
+		{"--proxy", "proxy.example:3128"},
+		{"--metadata-proxy", "http://proxy.example/path"},
+		{"--proxy", "socks5://127.0.0.1:1080", "--resolver", "udp://192.0.2.53"},
+	} {
+		if _, err := Load(args...); err == nil {
+			t.Fatalf("expected %v to fail", args)
+		}
+	}
+}
+
+func TestLoadTLS(t *testing.T) {
+	t.Setenv("SSLKEYLOGFILE", "/tmp/keys.log")
+	cfg, err := Load("--tls-min", "1.2", "--tls-max", "1.3", "--tls-ciphers", "tls_ecdhe_rsa_with_aes_128_gcm_sha256", "--cert", "c.pem", "--key", "c.key")
+	if err != nil {
+		t.Fatalf("Load() should succeed: %v", err)
+	}
+	if cfg.TLSMin != tls.VersionTLS12 || cfg.TLSMax != tls.VersionTLS13 {
+		t.Fatalf("TLSMin = %x, TLSMax = %x", cfg.TLSMin, cfg.TLSMax)
+	}
+	if !reflect.DeepEqual(cfg.TLSCiphers, []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}) {
+		t.Fatalf("TLSCiphers = %v", cfg.TLSCiphers)
+	}
+	if cfg.KeyLogFile != "/tmp/keys.log" {
+		t.Fatalf("KeyLogFile = %q, want SSLKEYLOGFILE", cfg.KeyLogFile)
+	}
+
+	for _, args := range [][]string{
+		{"--tls-min", "1.4"},
+		{"--tls-min", "1.3", "--tls-max", "1.2"},
+		{"--tls-ciphers", "TLS_NOPE"},
+		{"--tls-ciphers", "TLS_AES_128_GCM_SHA256"},
+		{"--cert", "c.pem"},
+	} {
+		if _, err := Load(args...); err == nil {
+			t.Fatalf("expected %v to fail", args)
+		}
+	}
+}
+
+func TestParseDSCP(t *testing.T) {
+	tests := map[string]int{"EF": 46, "af41": 34, "CS1": 8, "le": 1, "0": 0, "63": 63}
+	for in, want := range tests {
+		got, err := ParseDSCP(in)
+		if err != nil || got != want {
+			t.Errorf("ParseDSCP(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"64", "-1", "AF44", "fast"} {
+		if _, err := ParseDSCP(in); err == nil {
+			t.Errorf("ParseDSCP(%q) should fail", in)
+		}
+	}
+
+	cfg, err := Load("--dscp", "af41")
+	if err != nil || cfg.DSCP != "AF41" || cfg.DSCPValue != 34 {
+		t.Fatalf("Load(--dscp af41) = %+v, %v", cfg, err)
+	}
+}
+
+func TestLoadSocketOptions(t *testing.T) {
+	cfg, err := Load("--rcvbuf", "16MiB", "--sndbuf", "4M", "--notsent-lowat", "128K", "--tcp-nodelay", "OFF", "--mptcp")
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.RcvBuf != 16<<20 || cfg.SndBuf != 4000000 || cfg.NotSentLowat != 128000 || cfg.TCPNoDelay != "off" || !cfg.MPTCP {
+		t.Fatalf("socket options = %d %d %d %q %t", cfg.RcvBuf, cfg.SndBuf, cfg.NotSentLowat, cfg.TCPNoDelay, cfg.MPTCP)
+	}
+
+	for _, args := range [][]string{
+		{"--rcvbuf", "0"},
+		{"--sndbuf", "3G"},
+		{"--notsent-lowat", "lots"},
+		{"--tcp-nodelay", "maybe"},
+	} {
+		if _, err := Load(args...); err == nil {
+			t.Errorf("Load(%q) should fail", args)
+		}
+	}
+}
+
+func TestLoadMetadataProvider(t *testing.T) {
+	t.Setenv("IPINFO_TOKEN", "from-env")
+	cfg, err := Load("--metadata-provider", "ipinfo")
+	if err != nil || cfg.MetadataProvider != "ipinfo" || cfg.MetadataToken != "from-env" {
+		t.Fatalf("Load(ipinfo) = %+v, %v", cfg, err)
+	}
+
+	cfg, err = Load("--metadata-provider", "https://geo.example/{ip}", "--metadata-fields", "asn=network.asn,city=location.city", "--metadata-fields", "ip=address")
+	if err != nil {
+		t.Fatalf("Load(template): %v", err)
+	}
+	want := map[string]string{"asn": "network.asn", "city": "location.city", "ip": "address"}
+	if !reflect.DeepEqual(cfg.MetadataFields, want) {
+		t.Fatalf("MetadataFields = %v, want %v", cfg.MetadataFields, want)
+	}
+
+	if _, err := Load("--metadata-fields", "asn"); err == nil {
+		t.Fatal("field without a path should fail")
+	}
+
+	cfg, err = Load("--mmdb", "city.mmdb,asn.mmdb")
+	if err != nil || cfg.MetadataProvider != "mmdb" || !reflect.DeepEqual(cfg.MMDBPaths, []string{"city.mmdb", "asn.mmdb"}) {
+		t.Fatalf("Load(--mmdb) = %+v, %v", cfg, err)
+	}
+	if _, err := Load("--metadata-provider", "ipinfo", "--mmdb", "city.mmdb"); err == nil {
+		t.Fatal("--mmdb with another provider should fail")
+	}
+}
+
+func TestLoadMetadataCache(t *testing.T) {
+	cfg, err := Load()
+	if err != nil || cfg.MetadataTTL != DefaultMetadataTTL {
+		t.Fatalf("Load() = %+v, %v", cfg, err)
+	}
+	cfg, err = Load("--metadata-ttl", "0", "--cache-dir", "/tmp/st-cache")
+	if err != nil || cfg.MetadataTTL != 0 || cfg.CacheDir != "/tmp/st-cache" {
+		t.Fatalf("Load(--metadata-ttl 0) = %+v, %v", cfg, err)
+	}
+	if _, err := Load("--metadata-ttl", "-1h"); err == nil {
+		t.Fatal("negative --metadata-ttl should fail")
+	}
+}
+
+func TestLoadDiscoveryTTL(t *testing.T) {
+	if cfg, err := Load(); err != nil || cfg.DiscoveryTTL != 0 {
+		t.Fatalf("Load() = %+v, %v", cfg, err)
+	}
+	if cfg, err := Load("exporter"); err != nil || cfg.DiscoveryTTL != DefaultExporterDiscoveryTTL {
+		t.Fatalf("Load(exporter) = %+v, %v", cfg, err)
+	}
+	if cfg, err := Load("--discovery-ttl", "6h"); err != nil || cfg.DiscoveryTTL != 6*time.Hour {
+		t.Fatalf("Load(--discovery-ttl 6h) = %+v, %v", cfg, err)
+	}
+	if _, err := Load("--discovery-ttl", "-1m"); err == nil {
+		t.Fatal("negative --discovery-ttl should fail")
+	}
+}
@@ -0,0 +1,129 @@
+package endpoint
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/fsx"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/i18n"
+)
+
+// metadataCache keeps successful lookups of explicit addresses on disk so
+// repeated and scheduled runs do not query the provider again until ttl has
+// passed. Entries are keyed by provider, language and address; lookups of
+// the caller's own address are never cached, as it may change.
+type metadataCache struct {
+	path string
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+	dirty   bool
+}
+
+type cacheEntry struct {
+	Info    IPInfo    `json:"info"`
+	Fetched time.Time `json:"fetched"`
+}
+
+type cacheFile struct {
+	Entries map[string]cacheEntry `json:"entries"`
+}
+
+var (
+	metaCache atomic.Pointer[metadataCache]
+	nowFn     = time.Now
+)
+
+// SetMetadataCache caches metadata lookups in the file at path for ttl. An
+// empty path keeps the cache in memory only; a ttl of 0 turns caching off.
+// A missing or unreadable file starts an empty cache.
+func SetMetadataCache(path string, ttl time.Duration) {
+	if ttl <= 0 {
+		metaCache.Store(nil)
+		return
+	}
+	c := &metadataCache{path: path, ttl: ttl, entries: map[string]cacheEntry{}}
+	if path != "" {
+		if data, err := os.ReadFile(path); err == nil {
+			var f cacheFile
+			if json.Unmarshal(data, &f) == nil && f.Entries != nil {
+				c.entries = f.Entries
+			}
+		}
+	}
+	metaCache.Store(c)
+}
+
+func cacheKey(ip string) string {
+	return CurrentProvider().Name() + "|" + i18n.Lang() + "|" + ip
+}
+
+// cachedInfo returns a fresh cached lookup of ip.
+func cachedInfo(ip string) (IPInfo, bool) {
+	c := metaCache.Load()
+	if c == nil || ip == "" {
+		return IPInfo{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[cacheKey(ip)]
+	if !ok || nowFn().Sub(e.Fetched) >= c.ttl {
+		return IPInfo{}, false
+	}
+	return e.Info, true
+}
+
+func storeInfo(ip string, info IPInfo) {
+	c := metaCache.Load()
+	if c == nil || ip == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[cacheKey(ip)] = cacheEntry{Info: info, Fetched: nowFn()}
+	c.dirty = true
+}
+
+// saveMetadataCache writes new entries to disk, dropping expired ones.
+func saveMetadataCache() {
+	c := metaCache.Load()
+	if c == nil || c.path == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return
+	}
+	now := nowFn()
+	for key, e := range c.entries {
+		if now.Sub(e.Fetched) >= c.ttl {
+			delete(c.entries, key)
+		}
+	}
+	if writeJSONAtomic(c.path, cacheFile{Entries: c.entries}) == nil {
+		c.dirty = false
+	}
+}
+
+// writeJSONAtomic replaces the file at path with v encoded as JSON, through
+// a temporary file so concurrent runs never read a partial one.
+func writeJSONAtomic(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return fsx.WriteAtomic(path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
@@ -0,0 +1,207 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/config"
+)
+
+// countingProvider answers every lookup itself and counts the calls.
+type countingProvider struct {
+	calls *atomic.Int32
+}
+
+func (countingProvider) Name() string { return "counting" }
+
+func (p countingProvider) Lookup(_ context.Context, ip string) (IPInfo, error) {
+	p.calls.Add(1)
+	return IPInfo{Status: "success", Query: ip, City: "City of " + ip, AS: "AS64500 Example"}, nil
+}
+
+func TestMetadataCache(t *testing.T) {
+	oldProvider := CurrentProvider()
+	oldNow := nowFn
+	t.Cleanup(func() {
+		SetProvider(oldProvider)
+		SetMetadataCache("", 0)
+		nowFn = oldNow
+	})
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	nowFn = func() time.Time { return now }
+	var calls atomic.Int32
+	SetProvider(countingProvider{&calls})
+	path := filepath.Join(t.TempDir(), "cache", "metadata.json")
+
+	SetMetadataCache(path, time.Hour)
+	metas := fetchIPMetas(context.Background(), []string{"192.0.2.1", "192.0.2.2", "192.0.2.1"})
+	if calls.Load() != 2 || metas["192.0.2.2"].ASN != 64500 {
+		t.Fatalf("first run: %d lookups, metas %+v", calls.Load(), metas)
+	}
+	if info, _ := fetchInfo(context.Background(), ""); info.Query != "" || calls.Load() != 3 {
+		t.Fatalf("self lookup: %+v after %d lookups", info, calls.Load())
+	}
+	// The caller's own address is never cached.
+	fetchInfo(context.Background(), "")
+	if calls.Load() != 4 {
+		t.Fatalf("self lookup was cached: %d lookups", calls.Load())
+	}
+
+	// A new run reads the file and needs no lookups until the TTL passes.
+	now = now.Add(59 * time.Minute)
+	SetMetadataCache(path, time.Hour)
+	if info, _ := fetchInfo(context.Background(), "192.0.2.1"); info.City != "City of 192.0.2.1" || calls.Load() != 4 {
+		t.Fatalf("cached lookup = %+v after %d lookups", info, calls.Load())
+	}
+	now = now.Add(2 * time.Minute)
+	fetchIPMetas(context.Background(), []string{"192.0.2.1"})
+	if calls.Load() != 5 {
+		t.Fatalf("expired entry was used: %d lookups", calls.Load())
+	}
+
+	SetMetadataCache(path, 0)
+	fetchIPMetas(context.Background(), []string{"192.0.2.1"})
+	if calls.Load() != 6 {
+		t.Fatalf("disabled cache was used: %d lookups", calls.Load())
+	}
+}
+
+func TestIPAPIBatch(t *testing.T) {
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		var ips []string
+		body, _ := io.ReadAll(r.Body)
+		if r.Method != http.MethodPost || json.Unmarshal(body, &ips) != nil || r.URL.Query().Get("fields") == "" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		infos := make([]IPInfo, 0, len(ips))
+		for _, ip := range ips {
+			if ip == "10.0.0.1" {
+				infos = append(infos, IPInfo{Status: "fail", Query: ip})
+				continue
+			}
+			infos = append(infos, IPInfo{Status: "success", Query: ip, AS: "AS714 Apple Inc.", City: "Tokyo", CountryCode: "JP"})
+		}
+		json.NewEncoder(w).Encode(infos)
+	}))
+	defer srv.Close()
+	oldURL := ipAPIBatchURL
+	t.Cleanup(func() { ipAPIBatchURL = oldURL })
+	ipAPIBatchURL = srv.URL + "/batch"
+
+	ips := make([]string, 0, 150)
+	for i := range 150 {
+		ips = append(ips, fmt.Sprintf("17.253.%d.%d", i/100, i%100))
+	}
+	infos, err := ipAPIProvider{}.LookupBatch(context.Background(), append(ips, "10.0.0.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests.Load() != 2 || len(infos) != 150 || infos["17.253.1.49"].City != "Tokyo" {
+		t.Fatalf("%d requests, %d results", requests.Load(), len(infos))
+	}
+}
+
+func TestDiscoverStickyEndpoint(t *testing.T) {
+	oldResolveDoH := resolveDoHFn
+	oldProbe := probeEndpointFn
+	oldNow := nowFn
+	t.Cleanup(func() {
+		resolveDoHFn = oldResolveDoH
+		probeEndpointFn = oldProbe
+		nowFn = oldNow
+		SetDiscoveryCache("", 0)
+	})
+	now := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	nowFn = func() time.Time { return now }
+	resolves := 0
+	resolveDoHFn = func(context.Context, string) ([]string, bool, bool) {
+		resolves++
+		return []string{"1.1.1.1", "2.2.2.2"}, false, false
+	}
+	down := map[string]bool{}
+	probeEndpointFn = func(_ context.Context, _, _, ip string) ([]float64, int, error) {
+		if down[ip] {
+			return nil, 1, errors.New("connection refused")
+		}
+		if ip == "2.2.2.2" {
+			return []float64{10}, 1, nil
+		}
+		return []float64{30}, 1, nil
+	}
+	path := filepath.Join(t.TempDir(), "discovery.json")
+	opts := DiscoveryOptions{ProbeURL: "https://example.com/probe", Sticky: true}
+
+	SetDiscoveryCache(path, time.Hour)
+	res := Discover(context.Background(), "example.com", opts)
+	if resolves != 1 || res.Cached || res.Selected.IP != "2.2.2.2" {
+		t.Fatalf("first run: %d resolves, %+v", resolves, res)
+	}
+
+	// A later run loads the file and keeps the endpoint without resolving.
+	now = now.Add(30 * time.Minute)
+	SetDiscoveryCache(path, time.Hour)
+	res = Discover(context.Background(), "example.com", opts)
+	if resolves != 1 || !res.Cached || res.Selected.IP != "2.2.2.2" || res.Selected.Source != "cache" ||
+		!res.DiscoveredAt.Equal(now.Add(-30*time.Minute)) || len(res.Candidates) != 1 {
+		t.Fatalf("sticky run: %d resolves, %+v", resolves, res)
+	}
+	// Other discovery settings do not share the entry.
+	if res := Discover(context.Background(), "example.com", DiscoveryOptions{ProbeURL: opts.ProbeURL, Sticky: true, Family: 4}); resolves != 2 || res.Cached {
+		t.Fatalf("-4 run: %d resolves, %+v", resolves, res)
+	}
+	if res := Discover(context.Background(), "example.com", DiscoveryOptions{ProbeURL: "https://example.com/other", Sticky: true}); resolves != 3 || res.Cached {
+		t.Fatalf("other probe URL: %d resolves, %+v", resolves, res)
+	}
+
+	// A failing endpoint triggers discovery again.
+	down["2.2.2.2"] = true
+	res = Discover(context.Background(), "example.com", opts)
+	if resolves != 4 || res.Cached || res.Selected.IP != "1.1.1.1" || len(res.Warnings) != 1 || res.Warnings[0].Code != "sticky_endpoint_failed" {
+		t.Fatalf("failed endpoint: %d resolves, %+v", resolves, res)
+	}
+	down["2.2.2.2"] = false
+
+	// So does an expired entry.
+	now = now.Add(2 * time.Hour)
+	if res := Discover(context.Background(), "example.com", opts); resolves != 5 || res.Cached {
+		t.Fatalf("expired entry: %d resolves, %+v", resolves, res)
+	}
+	opts.Sticky = false
+	if res := Discover(context.Background(), "example.com", opts); resolves != 6 || res.Cached {
+		t.Fatalf("non-sticky run: %d resolves, %+v", resolves, res)
+	}
+}
+
+func TestDiscoveryKeyCoversSettings(t *testing.T) {
+	base := DiscoveryOptions{ProbeURL: "https://example.com/probe", Sticky: true}
+	key := discoveryKey("example.com", base)
+	for name, change := range map[string]func(*DiscoveryOptions){
+		"probe URL":     func(o *DiscoveryOptions) { o.ProbeURL = "https://example.com/other" },
+		"metadata":      func(o *DiscoveryOptions) { o.Metadata = true },
+		"family":        func(o *DiscoveryOptions) { o.Family = 6 },
+		"resolvers":     func(o *DiscoveryOptions) { o.Resolvers = []string{"udp://192.0.2.53"} },
+		"client subnet": func(o *DiscoveryOptions) { o.ClientSubnet = "203.0.113.0/24" },
+		"exclude":       func(o *DiscoveryOptions) { o.Exclude = config.Match{Desc: "akamai"} },
+	} {
+		opts := base
+		change(&opts)
+		if discoveryKey("example.com", opts) == key {
+			t.Errorf("changing the %s should change the discovery key", name)
+		}
+	}
+	if discoveryKey("example.com", DiscoveryOptions{ProbeURL: base.ProbeURL}) != key {
+		t.Error("--sticky itself should not be part of the key")
+	}
+}
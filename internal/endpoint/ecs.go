@@ -0,0 +1,137 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/binary"
+	"net/netip"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const ecsOptionCode = 8
+
+// ecsResolvers are queried when a client subnet is requested without
+// --resolver. Cloudflare strips EDNS Client Subnet, so the built-in dual
+// lookup cannot be used; Google and AliDNS both forward it.
+var ecsResolvers = []string{
+	"https://dns.google/dns-query",
+	"https://dns.alidns.com/dns-query",
+}
+
+// SubnetMapping lists the endpoints the resolvers return for a client in
+// Subnet. Scope is the largest ECS scope prefix echoed back, or -1 when no
+// resolver honoured the option.
+type SubnetMapping struct {
+	Subnet    string
+	Endpoints []Endpoint
+	Scope     int
+	Error     string
+}
+
+// MapClientSubnets resolves host once per subnet, sending each as EDNS
+// Client Subnet, to show which CDN nodes the resolvers map that region to.
+func MapClientSubnets(ctx context.Context, host string, resolvers, subnets []string, metadata bool) []SubnetMapping {
+	if len(resolvers) == 0 {
+		resolvers = ecsResolvers
+	}
+	out := make([]SubnetMapping, 0, len(subnets))
+	for _, subnet := range subnets {
+		if ctx.Err() != nil {
+			break
+		}
+		mapping := SubnetMapping{Subnet: subnet, Scope: -1}
+		prefix, err := netip.ParsePrefix(subnet)
+		if err != nil {
+			mapping.Error = err.Error()
+			out = append(out, mapping)
+			continue
+		}
+
+		var lists [][]string
+		var lastErr error
+		for _, r := range lookupAll(ctx, host, resolvers, prefix.Masked()) {
+			if r.err != nil {
+				lastErr = r.err
+				continue
+			}
+			lists = append(lists, r.ips)
+			mapping.Scope = max(mapping.Scope, r.ecsScope)
+		}
+		for _, ip := range mergeIPLists(lists...) {
+			mapping.Endpoints = append(mapping.Endpoints, Endpoint{IP: ip, Source: "ecs", Status: "ok"})
+		}
+		if len(mapping.Endpoints) == 0 && lastErr != nil {
+			mapping.Error = lastErr.Error()
+		}
+		out = append(out, mapping)
+	}
+	if metadata {
+		var ips []string
+		for _, mapping := range out {
+			for _, ep := range mapping.Endpoints {
+				ips = append(ips, ep.IP)
+			}
+		}
+		metas := fetchIPMetasFn(ctx, ips)
+		for _, mapping := range out {
+			for i := range mapping.Endpoints {
+				mapping.Endpoints[i].Desc = metas[mapping.Endpoints[i].IP].Desc
+			}
+		}
+	}
+	return out
+}
+
+// ecsOPT builds the OPT record carrying subnet as an RFC 7871 Client Subnet
+// option. Only the significant bytes of the address are sent.
+func ecsOPT(subnet netip.Prefix) (dnsmessage.Resource, error) {
+	subnet = subnet.Masked()
+	family := uint16(1)
+	if subnet.Addr().Is6() {
+		family = 2
+	}
+	addr := subnet.Addr().AsSlice()
+	data := make([]byte, 4, 4+len(addr))
+	binary.BigEndian.PutUint16(data, family)
+	data[2] = byte(subnet.Bits())
+	data = append(data, addr[:(subnet.Bits()+7)/8]...)
+
+	var rh dnsmessage.ResourceHeader
+	if err := rh.SetEDNS0(1232, dnsmessage.RCodeSuccess, false); err != nil {
+		return dnsmessage.Resource{}, err
+	}
+	return dnsmessage.Resource{
+		Header: rh,
+		Body:   &dnsmessage.OPTResource{Options: []dnsmessage.Option{{Code: ecsOptionCode, Data: data}}},
+	}, nil
+}
+
+// replyECSScope reads the scope prefix of the Client Subnet option in the
+// additional section, continuing a parser positioned after the answers.
+func replyECSScope(p *dnsmessage.Parser) int {
+	if err := p.SkipAllAuthorities(); err != nil {
+		return -1
+	}
+	for {
+		rh, err := p.AdditionalHeader()
+		if err != nil {
+			return -1
+		}
+		if rh.Type != dnsmessage.TypeOPT {
+			if err := p.SkipAdditional(); err != nil {
+				return -1
+			}
+			continue
+		}
+		opt, err := p.OPTResource()
+		if err != nil {
+			return -1
+		}
+		for _, o := range opt.Options {
+			if o.Code == ecsOptionCode && len(o.Data) >= 4 {
+				return int(o.Data[3])
+			}
+		}
+		return -1
+	}
+}
@@ -0,0 +1,149 @@
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"testing"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+func TestECSOPTEncoding(t *testing.T) {
+	tests := []struct {
+		subnet string
+		want   []byte
+	}{
+		{"203.0.113.77/24", []byte{0, 1, 24, 0, 203, 0, 113}},
+		{"10.1.2.3/12", []byte{0, 1, 12, 0, 10, 0}},
+		{"2001:db8:1234::/48", []byte{0, 2, 48, 0, 0x20, 0x01, 0x0d, 0xb8, 0x12, 0x34}},
+		{"0.0.0.0/0", []byte{0, 1, 0, 0}},
+	}
+	for _, tt := range tests {
+		opt, err := ecsOPT(netip.MustParsePrefix(tt.subnet))
+		if err != nil {
+			t.Fatalf("ecsOPT(%s): %v", tt.subnet, err)
+		}
+		options := opt.Body.(*dnsmessage.OPTResource).Options
+		if len(options) != 1 || options[0].Code != ecsOptionCode || !bytes.Equal(options[0].Data, tt.want) {
+			t.Errorf("ecsOPT(%s) = %+v, want data %v", tt.subnet, options, tt.want)
+		}
+	}
+}
+
+// newECSDoHServer answers with the IPs listed for the client subnet in the
+// query and echoes the option with the source prefix as scope. Queries
+// without ECS get no answer and no option.
+func newECSDoHServer(t *testing.T, bySubnet map[string]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var msg dnsmessage.Message
+		if err := msg.Unpack(query); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		msg.Header.Response = true
+		q := msg.Questions[0]
+		var additionals []dnsmessage.Resource
+		for _, extra := range msg.Additionals {
+			opt, ok := extra.Body.(*dnsmessage.OPTResource)
+			if !ok || len(opt.Options) == 0 || q.Type != dnsmessage.TypeA {
+				continue
+			}
+			data := opt.Options[0].Data
+			addr := make([]byte, 4)
+			copy(addr, data[4:])
+			subnet := netip.PrefixFrom(netip.AddrFrom4([4]byte(addr)), int(data[2])).String()
+			if ip, ok := bySubnet[subnet]; ok {
+				msg.Answers = append(msg.Answers, dnsmessage.Resource{
+					Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+					Body:   &dnsmessage.AResource{A: netip.MustParseAddr(ip).As4()},
+				})
+			}
+			echoed := append([]byte(nil), data...)
+			echoed[3] = data[2]
+			additionals = append(additionals, dnsmessage.Resource{
+				Header: extra.Header,
+				Body:   &dnsmessage.OPTResource{Options: []dnsmessage.Option{{Code: ecsOptionCode, Data: echoed}}},
+			})
+		}
+		msg.Additionals = additionals
+		packet, err := msg.Pack()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", dnsMessageType)
+		w.Write(packet)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestMapClientSubnets(t *testing.T) {
+	srv := newECSDoHServer(t, map[string]string{
+		"203.0.113.0/24":  "17.253.85.205",
+		"198.51.100.0/24": "17.253.85.206",
+	})
+
+	mappings := MapClientSubnets(context.Background(), "mensura.cdn-apple.com", []string{srv.URL}, []string{"203.0.113.0/24", "198.51.100.0/24", "bogus"}, false)
+	if len(mappings) != 3 {
+		t.Fatalf("expected 3 mappings, got %+v", mappings)
+	}
+	for i, want := range []string{"17.253.85.205", "17.253.85.206"} {
+		m := mappings[i]
+		if len(m.Endpoints) != 1 || m.Endpoints[0].IP != want || m.Scope != 24 || m.Error != "" {
+			t.Fatalf("mapping %d = %+v, want %s with scope 24", i, m, want)
+		}
+	}
+	if mappings[2].Error == "" || len(mappings[2].Endpoints) != 0 {
+		t.Fatalf("expected invalid subnet to report an error, got %+v", mappings[2])
+	}
+}
+
+func TestParseDNSAnswerWithoutECS(t *testing.T) {
+	srv := newECSDoHServer(t, nil)
+	res := queryResolver(context.Background(), srv.URL, "example.com", dnsmessage.TypeA, netip.Prefix{})
+	if res.err != nil || len(res.ips) != 0 || res.ecsScope != -1 {
+		t.Fatalf("expected empty answer without ECS scope, got %+v", res)
+	}
+}
+
+func TestDiscoverSendsClientSubnet(t *testing.T) {
+	oldResolvers := resolveResolversFn
+	oldProbe := probeEndpointFn
+	t.Cleanup(func() {
+		resolveResolversFn = oldResolvers
+		probeEndpointFn = oldProbe
+	})
+
+	var gotResolvers []string
+	var gotSubnet netip.Prefix
+	resolveResolversFn = func(_ context.Context, _ string, resolvers []string, subnet netip.Prefix) ([]string, bool) {
+		gotResolvers, gotSubnet = resolvers, subnet
+		return []string{"17.253.85.205"}, false
+	}
+	probeEndpointFn = func(context.Context, string, string, string) ([]float64, int, error) {
+		return []float64{10}, 1, nil
+	}
+
+	Discover(context.Background(), "example.com", DiscoveryOptions{
+		ProbeURL:     "https://example.com/probe",
+		ClientSubnet: "203.0.113.0/24",
+	})
+	if !reflect.DeepEqual(gotResolvers, ecsResolvers) {
+		t.Fatalf("expected ECS-capable default resolvers, got %v", gotResolvers)
+	}
+	if gotSubnet != netip.MustParsePrefix("203.0.113.0/24") {
+		t.Fatalf("subnet = %v", gotSubnet)
+	}
+}
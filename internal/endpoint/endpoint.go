@@ -4,10 +4,12 @@ import (
 	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"net/http"
+	"net/netip"
 	"net/url"
 	"os"
 	"regexp"
@@ -19,6 +21,7 @@ import (
 
 	"github.com/tsosunchia/iNetSpeed-CLI/internal/config"
 	"github.com/tsosunchia/iNetSpeed-CLI/internal/i18n"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/latency"
 	"github.com/tsosunchia/iNetSpeed-CLI/internal/netx"
 	"github.com/tsosunchia/iNetSpeed-CLI/internal/render"
 )
@@ -33,16 +36,52 @@ var (
 	aliDoHAAAAURLTemplate = "https://dns.alidns.com/resolve?name=%s&type=AAAA&short=1"
 
 	dohTimeout         = 1 * time.Second
-	dohHTTPClient      = netx.NewClient(netx.Options{Timeout: 4 * time.Second})
-	metadataHTTPClient = netx.NewClient(netx.Options{Timeout: 5 * time.Second})
+	discoveryTimeout   = 12 * time.Second
+	metadataTimeout    = 6 * time.Second
+	discoveryWorkers   = 4
+	probeSamples       = 4
 	resolveDoHFn       = resolveDoHDual
+	resolveResolversFn = resolveWithResolvers
 	resolveSystemFn    = resolveSystem
-	fetchIPDescFn      = fetchIPDesc
+	fetchIPMetaFn      = fetchIPMeta
+	fetchIPMetasFn     = fetchIPMetas
 	fetchInfoFn        = fetchInfo
 	probeEndpointFn    = probeEndpoint
 	openPromptInputFn  = openPromptInput
 )
 
+// netOpts holds the connection settings of every client and dial in this
+// package. dohHTTPClient and metadataHTTPClient are built from it by
+// SetNetOptions; until then they connect directly with default settings.
+var (
+	netOpts            netx.Options
+	dohHTTPClient      = metadataClient(netOpts, 4*time.Second)
+	metadataHTTPClient = metadataClient(netOpts, 5*time.Second)
+)
+
+// SetNetOptions makes this package connect with the bind, proxy, TLS and
+// socket settings in opts and rebuilds its DoH and metadata clients with
+// them. Per-client fields such as Purpose, Timeout and PinIP are ignored.
+func SetNetOptions(opts netx.Options) {
+	netOpts = opts
+	dohHTTPClient = metadataClient(opts, 4*time.Second)
+	metadataHTTPClient = metadataClient(opts, 5*time.Second)
+}
+
+// metadataClient returns a client for DoH queries and metadata lookups.
+func metadataClient(opts netx.Options, timeout time.Duration) *http.Client {
+	opts.Timeout = timeout
+	opts.Purpose = netx.Metadata
+	return netx.NewClient(opts)
+}
+
+// metadataOptions returns netOpts for dials with the Metadata purpose.
+func metadataOptions() netx.Options {
+	opts := netOpts
+	opts.Purpose = netx.Metadata
+	return opts
+}
+
 type Endpoint struct {
 	IP     string
 	Desc   string
@@ -51,13 +90,25 @@ type Endpoint struct {
 	Status string
 }
 
+// Candidate RTTMs is the median of the probe samples; Loss is the share of
+// probe requests that failed.
 type Candidate struct {
-	IP     string
-	Desc   string
-	RTTMs  float64
-	Source string
-	Status string
-	Error  string
+	IP       string
+	Desc     string
+	ASN      int
+	Country  string
+	RTTMs    float64
+	MinRTTMs float64
+	Samples  int
+	Loss     float64
+	Source   string
+	Status   string
+	Error    string
+	// Preferred is set when the candidate matches a --prefer-* rule.
+	Preferred bool
+	// MetadataFailed is set when the metadata lookup failed, leaving Desc
+	// a placeholder that the rules must not match against.
+	MetadataFailed bool
 }
 
 type Warning struct {
@@ -66,17 +117,42 @@ type Warning struct {
 }
 
 type DiscoveryOptions struct {
-	ProbeURL   string
-	EndpointIP string
-	Metadata   bool
+	ProbeURL    string
+	EndpointIP  string
+	EndpointIPs []string
+	Metadata    bool
+	// Resolvers replaces the built-in Cloudflare/AliDNS lookup with queries
+	// to these DoH URLs or tls://, udp:// and tcp:// DNS servers.
+	Resolvers []string
+	// ClientSubnet is sent as EDNS Client Subnet, e.g. 203.0.113.0/24. It
+	// needs wire-format queries, so the ECS-capable defaults replace the
+	// built-in lookup when Resolvers is empty.
+	ClientSubnet string
+	// Prefer and Exclude apply to DNS-discovered candidates only; endpoints
+	// the user listed are always measured.
+	Prefer  config.Match
+	Exclude config.Match
+	// Family limits candidates to IPv4 (4) or IPv6 (6); 0 allows both.
+	Family int
+	// Sticky reuses the endpoint selected by an earlier discovery with the
+	// same settings while it probes healthy; see SetDiscoveryCache.
+	Sticky bool
 }
 
+// DiscoveryResult is what Discover found. Cached is set when Selected was
+// kept from the discovery run at DiscoveredAt instead of a new one.
 type DiscoveryResult struct {
-	Host       string
-	Candidates []Candidate
-	Selected   Endpoint
-	Warnings   []Warning
-	DefaultDNS bool
+	Host         string
+	Candidates   []Candidate
+	Selected     Endpoint
+	Warnings     []Warning
+	DefaultDNS   bool
+	Cached       bool
+	DiscoveredAt time.Time
+	// Error is set when the --exclude-* rules leave no endpoint to measure.
+	// Falling back to default DNS could reach an excluded address, so the
+	// run must stop instead.
+	Error string
 }
 
 type IPInfo struct {
@@ -88,12 +164,33 @@ type IPInfo struct {
 	City       string `json:"city"`
 	RegionName string `json:"regionName"`
 	Country    string `json:"country"`
+	// CountryCode is the ISO 3166-1 alpha-2 code, which unlike Country is
+	// not localised.
+	CountryCode string `json:"countryCode"`
+}
+
+// ipMeta is what candidate metadata lookup yields: a display description
+// plus the fields candidate rules match on.
+type ipMeta struct {
+	Desc    string
+	ASN     int
+	Country string
+	// Failed is set when the lookup failed and Desc is only a placeholder.
+	Failed bool
+}
+
+// failedMeta is the metadata of an address whose lookup failed.
+func failedMeta() ipMeta {
+	return ipMeta{Desc: i18n.Text("lookup failed", "查询失败"), Failed: true}
 }
 
 type dohResult struct {
 	ips      []string
 	timedOut bool
 	err      error
+	// ecsScope is the EDNS Client Subnet scope prefix of a wire-format
+	// reply, or -1 when the resolver did not echo the option.
+	ecsScope int
 }
 
 type dohResponse struct {
@@ -127,14 +224,48 @@ func Discover(ctx context.Context, host string, opts DiscoveryOptions) Discovery
 		return res
 	}
 
-	ips, cfTimedOut, aliTimedOut := resolveDoHFn(ctx, host)
-	if len(ips) > 0 {
-		original := make([]Candidate, 0, len(ips))
-		for _, ip := range ips {
-			original = append(original, buildCandidate(ctx, host, ip, "doh", opts))
+	if len(opts.EndpointIPs) > 0 {
+		original := buildCandidates(ctx, host, opts.EndpointIPs, "user", opts, &res)
+		res.Candidates = orderCandidates(original)
+		res.Selected = chooseAuto(original, res.Candidates)
+		return res
+	}
+
+	sticky, ok := stickyDiscovery(ctx, host, opts)
+	if ok {
+		return sticky
+	}
+	res.Warnings = append(res.Warnings, sticky.Warnings...)
+
+	var ips []string
+	timeoutWarning := ""
+	subnet, _ := netip.ParsePrefix(opts.ClientSubnet)
+	if len(opts.Resolvers) > 0 || subnet.IsValid() {
+		resolvers := opts.Resolvers
+		if len(resolvers) == 0 {
+			resolvers = ecsResolvers
 		}
+		var timedOut bool
+		ips, timedOut = resolveResolversFn(ctx, host, resolvers, subnet.Masked())
+		if timedOut {
+			timeoutWarning = i18n.Text("All configured resolvers timed out. Fallback to system DNS.", "所有指定的解析服务器均超时，回退系统 DNS。")
+		}
+	} else {
+		var cfTimedOut, aliTimedOut bool
+		ips, cfTimedOut, aliTimedOut = resolveDoHFn(ctx, host)
+		if cfTimedOut && aliTimedOut {
+			timeoutWarning = i18n.Text("Dual DoH (CF + Ali) both timed out. Fallback to system DNS.", "双 DoH（CF + Ali）均超时，回退系统 DNS。")
+		}
+	}
+	ips = filterFamily(ips, opts.Family)
+	if len(ips) > 0 {
+		original := buildCandidates(ctx, host, ips, "doh", opts, &res)
 		res.Candidates = orderCandidates(original)
 		res.Selected = chooseAuto(original, res.Candidates)
+		if res.Selected.IP == "" && !opts.Exclude.Empty() {
+			return noEligibleEndpoint(res, i18n.Text("Every discovered endpoint is excluded by the --exclude-* rules.",
+				"所有发现的节点均被 --exclude-* 规则排除。"))
+		}
 		if res.Selected.IP == "" {
 			res.Selected = Endpoint{Source: "default_dns", Status: "degraded"}
 			res.DefaultDNS = true
@@ -143,22 +274,31 @@ func Discover(ctx context.Context, host string, opts DiscoveryOptions) Discovery
 				Message: i18n.Text("No healthy endpoint candidate. Continue with default DNS.", "没有健康的候选节点，继续使用默认 DNS。"),
 			})
 		}
+		rememberDiscovery(host, opts, res)
 		return res
 	}
 
-	if cfTimedOut && aliTimedOut {
+	if timeoutWarning != "" {
 		res.Warnings = append(res.Warnings, Warning{
 			Code:    "system_dns_fallback",
-			Message: i18n.Text("Dual DoH (CF + Ali) both timed out. Fallback to system DNS.", "双 DoH（CF + Ali）均超时，回退系统 DNS。"),
+			Message: timeoutWarning,
 		})
-		if ip := resolveSystemFn(host); ip != "" {
+		if ip := resolveSystemFn(host, opts.Family); ip != "" {
 			candidate := buildCandidate(ctx, host, ip, "system_dns", opts)
 			res.Candidates = []Candidate{candidate}
+			if candidate.Status == "excluded" {
+				return noEligibleEndpoint(res, fmt.Sprintf(i18n.Text("The system DNS answer %s is excluded: %s.", "系统 DNS 解析结果 %s 被排除：%s。"),
+					ip, candidate.Error))
+			}
 			res.Selected = endpointFromCandidate(candidate)
 			return res
 		}
 	}
 
+	if !opts.Exclude.Empty() {
+		return noEligibleEndpoint(res, i18n.Text("Could not resolve an endpoint to check against the --exclude-* rules.",
+			"无法解析出可按 --exclude-* 规则检查的节点。"))
+	}
 	res.DefaultDNS = true
 	res.Selected = Endpoint{Source: "default_dns", Status: "degraded"}
 	res.Warnings = append(res.Warnings, Warning{
@@ -168,6 +308,14 @@ func Discover(ctx context.Context, host string, opts DiscoveryOptions) Discovery
 	return res
 }
 
+// noEligibleEndpoint ends discovery without an endpoint rather than letting
+// default DNS pick one the exclude rules might reject.
+func noEligibleEndpoint(res DiscoveryResult, reason string) DiscoveryResult {
+	res.Selected = Endpoint{}
+	res.Error = reason + i18n.Text(" Refusing to fall back to default DNS.", "拒绝回退默认 DNS。")
+	return res
+}
+
 func Choose(ctx context.Context, host string, bus *render.Bus, isTTY bool) Endpoint {
 	bus.Header(i18n.Text("Endpoint Selection", "节点选择"))
 	res := Discover(ctx, host, DiscoveryOptions{Metadata: true})
@@ -209,12 +357,41 @@ func HostFromURL(rawURL string) string {
 	return u.Hostname()
 }
 
-func ResolveHost(host string) string {
-	return resolveSystem(host)
+// ResolveHost returns an address of host from the system resolver,
+// preferring IPv4 unless family is 6.
+func ResolveHost(host string, family int) string {
+	return resolveSystem(host, family)
 }
 
 func FetchInfo(ctx context.Context, target string) IPInfo {
-	return fetchInfoFn(ctx, target)
+	info, _ := fetchInfoFn(ctx, target)
+	return info
+}
+
+// FetchClientInfo describes the caller's own address as seen over the given
+// family (4 or 6; 0 lets the system choose), so that an IPv6 run reports
+// its IPv6 address rather than the IPv4 one. A provider that cannot be
+// reached over that family reports the client as unavailable. The error is
+// that of the last attempt.
+func FetchClientInfo(ctx context.Context, family int) (IPInfo, error) {
+	return fetchInfoFn(withFamily(ctx, family), "")
+}
+
+type familyKey struct{}
+
+// withFamily restricts the metadata lookups made under ctx to one address
+// family; 0 leaves ctx unchanged.
+func withFamily(ctx context.Context, family int) context.Context {
+	if family == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, familyKey{}, family)
+}
+
+// familyOf returns the family set by withFamily, or 0.
+func familyOf(ctx context.Context) int {
+	family, _ := ctx.Value(familyKey{}).(int)
+	return family
 }
 
 func PromptChoice(ctx context.Context, count int, bus *render.Bus) (int, bool) {
@@ -352,24 +529,17 @@ func extractIPsFromBody(body []byte) []string {
 }
 
 func mergeIPs(first, second []string) []string {
-	seen := map[string]bool{}
-	var out []string
-	for _, list := range [][]string{first, second} {
-		for _, ip := range list {
-			if net.ParseIP(ip) == nil || seen[ip] {
-				continue
-			}
-			seen[ip] = true
-			out = append(out, ip)
-		}
-	}
-	return out
+	return mergeIPLists(first, second)
 }
 
 func mergeIPs4(a, b, c, d []string) []string {
+	return mergeIPLists(a, b, c, d)
+}
+
+func mergeIPLists(lists ...[]string) []string {
 	seen := map[string]bool{}
 	var out []string
-	for _, list := range [][]string{a, b, c, d} {
+	for _, list := range lists {
 		for _, ip := range list {
 			if net.ParseIP(ip) == nil || seen[ip] {
 				continue
@@ -397,8 +567,15 @@ func isTimeoutErr(err error) bool {
 	return false
 }
 
-func resolveSystem(host string) string {
-	addrs, err := net.LookupIP(host)
+func resolveSystem(host string, family int) string {
+	network := "ip"
+	switch family {
+	case 4:
+		network = "ip4"
+	case 6:
+		network = "ip6"
+	}
+	addrs, err := netOpts.Resolver().LookupIP(context.Background(), network, host)
 	if err != nil {
 		return ""
 	}
@@ -415,80 +592,145 @@ func resolveSystem(host string) string {
 	return ""
 }
 
-func fetchIPDesc(ctx context.Context, ip string) string {
+// filterFamily keeps the addresses of family, or all of them when family
+// is 0.
+func filterFamily(ips []string, family int) []string {
+	if family == 0 {
+		return ips
+	}
+	var out []string
+	for _, ip := range ips {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			continue
+		}
+		if addr.Unmap().Is4() == (family == 4) {
+			out = append(out, ip)
+		}
+	}
+	return out
+}
+
+// fetchIPMetas describes every address in ips, answering from the metadata
+// cache where it can and asking the provider for the rest in one batch when
+// it supports that. Whatever is still missing is looked up one address at a
+// time on up to discoveryWorkers goroutines.
+func fetchIPMetas(ctx context.Context, ips []string) map[string]ipMeta {
+	out := make(map[string]ipMeta, len(ips))
+	var missing []string
+	for _, ip := range ips {
+		if _, seen := out[ip]; seen {
+			continue
+		}
+		if info, ok := cachedInfo(ip); ok {
+			out[ip] = metaFromInfo(info)
+			continue
+		}
+		out[ip] = ipMeta{}
+		missing = append(missing, ip)
+	}
+	if bp, ok := CurrentProvider().(BatchProvider); ok && len(missing) > 1 {
+		ctx2, cancel := context.WithTimeout(ctx, 5*time.Second)
+		infos, _ := bp.LookupBatch(ctx2, missing)
+		cancel()
+		rest := missing[:0]
+		for _, ip := range missing {
+			if info, ok := infos[ip]; ok {
+				storeInfo(ip, info)
+				out[ip] = metaFromInfo(info)
+				continue
+			}
+			rest = append(rest, ip)
+		}
+		missing = rest
+	}
+
+	var mu sync.Mutex
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for w := 0; w < min(discoveryWorkers, len(missing)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ip := range jobs {
+				meta := fetchIPMetaFn(ctx, ip)
+				mu.Lock()
+				out[ip] = meta
+				mu.Unlock()
+			}
+		}()
+	}
+	for _, ip := range missing {
+		jobs <- ip
+	}
+	close(jobs)
+	wg.Wait()
+	saveMetadataCache()
+	return out
+}
+
+func fetchIPMeta(ctx context.Context, ip string) ipMeta {
+	if info, ok := cachedInfo(ip); ok {
+		return metaFromInfo(info)
+	}
 	for attempt := 0; attempt < 3; attempt++ {
 		if attempt > 0 {
 			select {
 			case <-ctx.Done():
-				return i18n.Text("lookup failed", "查询失败")
+				return failedMeta()
 			case <-time.After(time.Duration(attempt) * 500 * time.Millisecond):
 			}
 		}
-		desc, err := doFetchIPDesc(ctx, ip)
+		meta, err := doFetchIPMeta(ctx, ip)
 		if err == nil {
-			return desc
+			return meta
 		}
 	}
-	return i18n.Text("lookup failed", "查询失败")
+	return failedMeta()
 }
 
-func fetchInfo(ctx context.Context, target string) IPInfo {
+func fetchInfo(ctx context.Context, target string) (IPInfo, error) {
+	if info, ok := cachedInfo(target); ok {
+		return info, nil
+	}
+	var err error
 	for attempt := 0; attempt < 3; attempt++ {
 		if attempt > 0 {
 			select {
 			case <-ctx.Done():
-				return IPInfo{}
+				return IPInfo{}, ctx.Err()
 			case <-time.After(time.Duration(attempt) * 500 * time.Millisecond):
 			}
 		}
-		info, err := doFetchInfo(ctx, target)
+		var info IPInfo
+		info, err = doFetchInfo(ctx, target)
 		if err == nil {
-			return info
+			storeInfo(target, info)
+			saveMetadataCache()
+			return info, nil
+		}
+		// Asking again will not make a private address public.
+		var noPublic *NoPublicAddrError
+		if errors.As(err, &noPublic) {
+			break
 		}
 	}
-	return IPInfo{}
-}
-
-func ipAPILangSuffix() string {
-	if i18n.IsZH() {
-		return "&lang=zh-CN"
-	}
-	return ""
-}
-
-func buildIPAPIURL(target, fields string) string {
-	if target == "" {
-		return fmt.Sprintf("http://ip-api.com/json/?fields=%s%s", fields, ipAPILangSuffix())
-	}
-	return fmt.Sprintf("http://ip-api.com/json/%s?fields=%s%s", target, fields, ipAPILangSuffix())
+	return IPInfo{}, err
 }
 
-func doFetchIPDesc(ctx context.Context, ip string) (string, error) {
+func doFetchIPMeta(ctx context.Context, ip string) (ipMeta, error) {
 	ctx2, cancel := context.WithTimeout(ctx, 4*time.Second)
 	defer cancel()
 
-	req, err := http.NewRequestWithContext(ctx2, http.MethodGet, buildIPAPIURL(ip, "status,city,regionName,country,as,org"), nil)
-	if err != nil {
-		return "", err
-	}
-	req.Header.Set("User-Agent", "iNetSpeed-CLI")
-	resp, err := metadataHTTPClient.Do(req)
+	info, err := CurrentProvider().Lookup(ctx2, ip)
 	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("HTTP %d", resp.StatusCode)
-	}
-
-	var info IPInfo
-	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
-		return "", err
-	}
-	if info.Status != "success" {
-		return "", fmt.Errorf("ip-api status: %s", info.Status)
+		return ipMeta{}, err
 	}
+	storeInfo(ip, info)
+	return metaFromInfo(info), nil
+}
 
+func metaFromInfo(info IPInfo) ipMeta {
 	loc := info.City
 	if info.RegionName != "" && info.RegionName != info.City {
 		if loc != "" {
@@ -512,51 +754,62 @@ func doFetchIPDesc(ctx context.Context, ip string) (string, error) {
 	if asn != "" {
 		loc += " (" + asn + ")"
 	}
-	return loc, nil
+	return ipMeta{Desc: loc, ASN: parseASN(info.AS), Country: info.CountryCode}
+}
+
+// parseASN extracts the number from the "AS714 Apple Inc." form that every
+// Provider reports.
+func parseASN(as string) int {
+	field, _, _ := strings.Cut(as, " ")
+	n, err := strconv.Atoi(strings.TrimPrefix(strings.ToUpper(field), "AS"))
+	if err != nil {
+		return 0
+	}
+	return n
 }
 
 func doFetchInfo(ctx context.Context, target string) (IPInfo, error) {
 	ctx2, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	fields := "status,query,as,isp,city,regionName,country"
-	if target != "" {
-		fields = "status,query,as,isp,org,city,regionName,country"
-	}
-	req, err := http.NewRequestWithContext(ctx2, http.MethodGet, buildIPAPIURL(target, fields), nil)
-	if err != nil {
-		return IPInfo{}, err
-	}
-	req.Header.Set("User-Agent", "iNetSpeed-CLI")
-	resp, err := metadataHTTPClient.Do(req)
-	if err != nil {
-		return IPInfo{}, err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode != http.StatusOK {
-		return IPInfo{}, fmt.Errorf("HTTP %d", resp.StatusCode)
-	}
-
-	var info IPInfo
-	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
-		return IPInfo{}, err
-	}
-	if info.Status != "" && info.Status != "success" {
-		return IPInfo{}, fmt.Errorf("ip-api status: %s", info.Status)
-	}
-	return info, nil
+	return CurrentProvider().Lookup(ctx2, target)
 }
 
-func probeEndpoint(ctx context.Context, host, probeURL, ip string) (float64, error) {
+// probeEndpoint times probeSamples requests over one pinned client. The
+// first pays for TCP and TLS setup and the rest reuse that connection. If
+// the first request fails the endpoint is treated as unreachable; later
+// failures only count towards loss. sent is the number of requests made.
+func probeEndpoint(ctx context.Context, host, probeURL, ip string) (samples []float64, sent int, err error) {
 	if host == "" || probeURL == "" || ip == "" {
-		return 0, fmt.Errorf("probe unavailable")
+		return nil, 0, fmt.Errorf("probe unavailable")
+	}
+
+	opts := netOpts
+	opts.PinHost = host
+	opts.PinIP = ip
+	opts.Timeout = 3 * time.Second
+	opts.Purpose = netx.Measurement
+	client := netx.NewClient(opts)
+	defer client.CloseIdleConnections()
+
+	for sent < probeSamples && ctx.Err() == nil {
+		rtt, err := probeOnce(ctx, client, probeURL)
+		sent++
+		if err != nil {
+			if len(samples) == 0 && sent == 1 {
+				return nil, sent, err
+			}
+			continue
+		}
+		samples = append(samples, rtt)
+	}
+	if len(samples) == 0 {
+		return nil, sent, ctx.Err()
 	}
+	return samples, sent, nil
+}
 
-	client := netx.NewClient(netx.Options{
-		PinHost: host,
-		PinIP:   ip,
-		Timeout: 3 * time.Second,
-	})
+func probeOnce(ctx context.Context, client *http.Client, probeURL string) (float64, error) {
 	ctx2, cancel := context.WithTimeout(ctx, 3*time.Second)
 	defer cancel()
 
@@ -654,28 +907,123 @@ func parseChoice(line string, count int) (int, bool) {
 	return n - 1, true
 }
 
+// buildCandidate probes ip and applies the candidate rules to it once its
+// metadata is known, as buildCandidates does for a single address.
 func buildCandidate(ctx context.Context, host, ip, source string, opts DiscoveryOptions) Candidate {
-	candidate := Candidate{
-		IP:     ip,
-		Source: source,
-		Status: "degraded",
-	}
-	if opts.Metadata {
-		candidate.Desc = fetchIPDescFn(ctx, ip)
-	}
+	return buildCandidates(ctx, host, []string{ip}, source, opts, &DiscoveryResult{})[0]
+}
+
+// probeCandidate probes ip without applying any rules.
+func probeCandidate(ctx context.Context, host, ip, source string, opts DiscoveryOptions) Candidate {
+	candidate := Candidate{IP: ip, Source: source, Status: "degraded"}
 	if opts.ProbeURL == "" {
 		return candidate
 	}
-	rtt, err := probeEndpointFn(ctx, host, opts.ProbeURL, ip)
+	samples, sent, err := probeEndpointFn(ctx, host, opts.ProbeURL, ip)
 	if err != nil {
 		candidate.Error = err.Error()
 		return candidate
 	}
-	candidate.RTTMs = rtt
+	stats := latency.Compute(samples)
+	candidate.RTTMs = stats.Median
+	candidate.MinRTTMs = stats.Min
+	candidate.Samples = stats.N
+	if sent > 0 {
+		candidate.Loss = float64(sent-stats.N) / float64(sent)
+	}
 	candidate.Status = "ok"
 	return candidate
 }
 
+// applyRules fills in the candidate's metadata and applies the prefer and
+// exclude rules, which do not cover addresses the user named.
+func applyRules(candidate *Candidate, meta ipMeta, opts DiscoveryOptions) {
+	candidate.Desc = meta.Desc
+	candidate.ASN = meta.ASN
+	candidate.Country = meta.Country
+	candidate.MetadataFailed = meta.Failed
+	if candidate.Source == "user" {
+		return
+	}
+	if rule := matchRule(opts.Exclude, "exclude", *candidate); rule != "" {
+		candidate.Status = "excluded"
+		candidate.Error = fmt.Sprintf(i18n.Text("excluded by %s", "已被 %s 排除"), rule)
+		return
+	}
+	if rule := uncheckedExclude(opts.Exclude, *candidate); rule != "" {
+		candidate.Status = "excluded"
+		candidate.Error = fmt.Sprintf(i18n.Text("metadata unavailable, cannot check %s", "元数据不可用，无法检查 %s"), rule)
+		return
+	}
+	candidate.Preferred = matchRule(opts.Prefer, "prefer", *candidate) != ""
+}
+
+// buildCandidates probes ips concurrently on at most discoveryWorkers
+// goroutines, all sharing the discoveryTimeout deadline, while their
+// metadata is looked up alongside under its own metadataTimeout so that a
+// slow provider cannot starve the probes. The rules are applied once both
+// are done; addresses an exclude rule rejects on address alone are not
+// probed. The result keeps the order of ips so orderCandidates stays
+// deterministic; candidates the deadline cut off are kept as degraded.
+func buildCandidates(ctx context.Context, host string, ips []string, source string, opts DiscoveryOptions, res *DiscoveryResult) []Candidate {
+	metas := make(chan map[string]ipMeta, 1)
+	if opts.Metadata {
+		go func() {
+			metaCtx, cancel := context.WithTimeout(ctx, metadataTimeout)
+			defer cancel()
+			metas <- fetchIPMetasFn(metaCtx, ips)
+		}()
+	} else {
+		metas <- nil
+	}
+
+	ctx2, cancel := context.WithTimeout(ctx, discoveryTimeout)
+	defer cancel()
+
+	out := make([]Candidate, len(ips))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(discoveryWorkers, len(ips)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				out[i] = Candidate{IP: ips[i], Source: source, Status: "degraded"}
+				if source == "user" || matchRule(opts.Exclude, "exclude", out[i]) == "" {
+					out[i] = probeCandidate(ctx2, host, ips[i], source, opts)
+				}
+			}
+		}()
+	}
+	for i := range ips {
+		if ctx2.Err() != nil {
+			out[i] = Candidate{IP: ips[i], Source: source, Status: "degraded", Error: ctx2.Err().Error()}
+			continue
+		}
+		select {
+		case jobs <- i:
+		case <-ctx2.Done():
+			out[i] = Candidate{IP: ips[i], Source: source, Status: "degraded", Error: ctx2.Err().Error()}
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	meta := <-metas
+	for i := range out {
+		applyRules(&out[i], meta[ips[i]], opts)
+	}
+
+	if ctx.Err() == nil && ctx2.Err() != nil {
+		res.Warnings = append(res.Warnings, Warning{
+			Code: "discovery_timeout",
+			Message: fmt.Sprintf(i18n.Text("Endpoint discovery hit the %s deadline; unprobed candidates are marked degraded.",
+				"节点发现超过 %s 时限，未完成探测的候选节点标记为降级（degraded）。"), discoveryTimeout),
+		})
+	}
+	return out
+}
+
 func chooseAuto(original, ordered []Candidate) Endpoint {
 	for _, candidate := range ordered {
 		if candidate.Status == "ok" {
@@ -683,13 +1031,15 @@ func chooseAuto(original, ordered []Candidate) Endpoint {
 		}
 	}
 	for _, candidate := range original {
-		if candidate.IP != "" {
+		if candidate.IP != "" && candidate.Status != "excluded" {
 			return endpointFromCandidate(candidate)
 		}
 	}
 	return Endpoint{}
 }
 
+// orderCandidates ranks healthy candidates first, preferred ones ahead of
+// the rest, then by RTT and loss; excluded candidates go last.
 func orderCandidates(candidates []Candidate) []Candidate {
 	ordered := append([]Candidate(nil), candidates...)
 	sort.SliceStable(ordered, func(i, j int) bool {
@@ -698,9 +1048,20 @@ func orderCandidates(candidates []Candidate) []Candidate {
 		if leftOK != rightOK {
 			return leftOK
 		}
+		leftExcluded := ordered[i].Status == "excluded"
+		rightExcluded := ordered[j].Status == "excluded"
+		if leftExcluded != rightExcluded {
+			return rightExcluded
+		}
+		if leftOK && rightOK && ordered[i].Preferred != ordered[j].Preferred {
+			return ordered[i].Preferred
+		}
 		if leftOK && rightOK && ordered[i].RTTMs != ordered[j].RTTMs {
 			return ordered[i].RTTMs < ordered[j].RTTMs
 		}
+		if leftOK && rightOK && ordered[i].Loss != ordered[j].Loss {
+			return ordered[i].Loss < ordered[j].Loss
+		}
 		return false
 	})
 	return ordered
@@ -723,9 +1084,17 @@ func candidateLabel(candidate Candidate) string {
 	}
 	if candidate.RTTMs > 0 {
 		parts = append(parts, fmt.Sprintf("%.2f ms", candidate.RTTMs))
+		if candidate.Loss > 0 {
+			parts = append(parts, fmt.Sprintf(i18n.Text("loss %.0f%%", "丢失 %.0f%%"), candidate.Loss*100))
+		}
+	} else if candidate.Status == "excluded" {
+		parts = append(parts, candidate.Error)
 	} else if candidate.Error != "" {
 		parts = append(parts, i18n.Text("probe unavailable", "探测不可用"))
 	}
+	if candidate.Preferred && candidate.Status == "ok" {
+		parts = append(parts, i18n.Text("preferred", "优先"))
+	}
 	if len(parts) == 0 {
 		return i18n.Text("unavailable", "不可用")
 	}
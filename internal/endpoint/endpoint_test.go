@@ -9,10 +9,13 @@ import (
 	"net/http/httptest"
 	"os"
 	"reflect"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/config"
 	"github.com/tsosunchia/iNetSpeed-CLI/internal/i18n"
 	"github.com/tsosunchia/iNetSpeed-CLI/internal/render"
 )
@@ -21,6 +24,17 @@ func newTestBus() *render.Bus {
 	return render.NewBus(render.NewPlainRenderer(&strings.Builder{}))
 }
 
+// eachIP adapts a per-address metadata stub to fetchIPMetasFn.
+func eachIP(fn func(ip string) ipMeta) func(context.Context, []string) map[string]ipMeta {
+	return func(_ context.Context, ips []string) map[string]ipMeta {
+		out := make(map[string]ipMeta, len(ips))
+		for _, ip := range ips {
+			out[ip] = fn(ip)
+		}
+		return out
+	}
+}
+
 func TestHostFromURL(t *testing.T) {
 	tests := []struct {
 		input, want string
@@ -97,19 +111,17 @@ func TestResolveDoHFallbackRegex(t *testing.T) {
 	}
 }
 
-func TestDoFetchIPDescStatusCode(t *testing.T) {
+func TestDoFetchIPMetaStatusCode(t *testing.T) {
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusTooManyRequests)
 	}))
 	defer srv.Close()
+	old := ipAPIBaseURL
+	ipAPIBaseURL = srv.URL + "/json/"
+	t.Cleanup(func() { ipAPIBaseURL = old })
 
-	resp, err := http.Get(srv.URL)
-	if err != nil {
-		t.Fatal(err)
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode == http.StatusOK {
-		t.Error("expected non-200 status code from rate-limited server")
+	if meta, err := doFetchIPMeta(context.Background(), "192.0.2.1"); err == nil {
+		t.Fatalf("expected a rate-limited lookup to fail, got %+v", meta)
 	}
 }
 
@@ -172,7 +184,7 @@ func TestChooseSystemDNSFallback(t *testing.T) {
 	resolveDoHFn = func(ctx context.Context, host string) ([]string, bool, bool) {
 		return nil, true, true
 	}
-	resolveSystemFn = func(host string) string {
+	resolveSystemFn = func(host string, _ int) string {
 		return "9.9.9.9"
 	}
 
@@ -199,7 +211,7 @@ func TestChooseNoFallbackWhenDualDoHNoIPs(t *testing.T) {
 		return nil, false, false
 	}
 	resolveSystemCalled := false
-	resolveSystemFn = func(host string) string {
+	resolveSystemFn = func(host string, _ int) string {
 		resolveSystemCalled = true
 		return "8.8.8.8"
 	}
@@ -217,23 +229,23 @@ func TestChooseNoFallbackWhenDualDoHNoIPs(t *testing.T) {
 
 func TestDiscoverAutoSelectsFastestCandidate(t *testing.T) {
 	oldResolveDoH := resolveDoHFn
-	oldFetchIPDesc := fetchIPDescFn
+	oldFetchIPMetas := fetchIPMetasFn
 	oldProbe := probeEndpointFn
 	t.Cleanup(func() {
 		resolveDoHFn = oldResolveDoH
-		fetchIPDescFn = oldFetchIPDesc
+		fetchIPMetasFn = oldFetchIPMetas
 		probeEndpointFn = oldProbe
 	})
 
 	resolveDoHFn = func(_ context.Context, _ string) ([]string, bool, bool) {
 		return []string{"1.1.1.1", "2.2.2.2"}, false, false
 	}
-	fetchIPDescFn = func(_ context.Context, ip string) string { return "desc-" + ip }
-	probeEndpointFn = func(_ context.Context, _ string, _ string, ip string) (float64, error) {
+	fetchIPMetasFn = eachIP(func(ip string) ipMeta { return ipMeta{Desc: "desc-" + ip} })
+	probeEndpointFn = func(_ context.Context, _ string, _ string, ip string) ([]float64, int, error) {
 		if ip == "1.1.1.1" {
-			return 35, nil
+			return []float64{35}, 1, nil
 		}
-		return 10, nil
+		return []float64{10}, 1, nil
 	}
 
 	res := Discover(context.Background(), "example.com", DiscoveryOptions{
@@ -251,17 +263,204 @@ func TestDiscoverAutoSelectsFastestCandidate(t *testing.T) {
 	}
 }
 
+func TestDiscoverFiltersFamily(t *testing.T) {
+	oldResolveDoH := resolveDoHFn
+	oldProbe := probeEndpointFn
+	t.Cleanup(func() {
+		resolveDoHFn = oldResolveDoH
+		probeEndpointFn = oldProbe
+	})
+
+	resolveDoHFn = func(_ context.Context, _ string) ([]string, bool, bool) {
+		return []string{"17.253.85.205", "2001:db8::1", "::ffff:17.253.85.206"}, false, false
+	}
+	probeEndpointFn = func(context.Context, string, string, string) ([]float64, int, error) {
+		return []float64{10}, 1, nil
+	}
+
+	for family, want := range map[int][]string{
+		4: {"17.253.85.205", "::ffff:17.253.85.206"},
+		6: {"2001:db8::1"},
+	} {
+		res := Discover(context.Background(), "example.com", DiscoveryOptions{
+			ProbeURL: "https://example.com/probe",
+			Family:   family,
+		})
+		var got []string
+		for _, c := range res.Candidates {
+			got = append(got, c.IP)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, want) {
+			t.Fatalf("family %d: candidates = %v, want %v", family, got, want)
+		}
+	}
+}
+
+func TestDiscoverProbesCandidatesConcurrently(t *testing.T) {
+	oldResolveDoH := resolveDoHFn
+	oldProbe := probeEndpointFn
+	oldWorkers := discoveryWorkers
+	t.Cleanup(func() {
+		resolveDoHFn = oldResolveDoH
+		probeEndpointFn = oldProbe
+		discoveryWorkers = oldWorkers
+	})
+
+	discoveryWorkers = 3
+	ips := []string{"1.1.1.1", "2.2.2.2", "3.3.3.3", "4.4.4.4", "5.5.5.5", "6.6.6.6", "7.7.7.7"}
+	resolveDoHFn = func(_ context.Context, _ string) ([]string, bool, bool) {
+		return ips, false, false
+	}
+	var mu sync.Mutex
+	running, peak := 0, 0
+	probeEndpointFn = func(_ context.Context, _ string, _ string, ip string) ([]float64, int, error) {
+		mu.Lock()
+		running++
+		peak = max(peak, running)
+		mu.Unlock()
+		time.Sleep(20 * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		return []float64{10}, 1, nil
+	}
+
+	res := Discover(context.Background(), "example.com", DiscoveryOptions{ProbeURL: "https://example.com/probe"})
+	if peak < 2 || peak > 3 {
+		t.Fatalf("expected between 2 and 3 concurrent probes, got %d", peak)
+	}
+	if len(res.Candidates) != len(ips) {
+		t.Fatalf("expected %d candidates, got %d", len(ips), len(res.Candidates))
+	}
+	for i, candidate := range res.Candidates {
+		if candidate.IP != ips[i] || candidate.Status != "ok" {
+			t.Fatalf("equal RTTs should keep DoH order, got %+v", res.Candidates)
+		}
+	}
+}
+
+func TestDiscoverDeadlineMarksSlowCandidates(t *testing.T) {
+	oldResolveDoH := resolveDoHFn
+	oldProbe := probeEndpointFn
+	oldWorkers := discoveryWorkers
+	oldTimeout := discoveryTimeout
+	t.Cleanup(func() {
+		resolveDoHFn = oldResolveDoH
+		probeEndpointFn = oldProbe
+		discoveryWorkers = oldWorkers
+		discoveryTimeout = oldTimeout
+	})
+
+	discoveryWorkers = 1
+	discoveryTimeout = 50 * time.Millisecond
+	resolveDoHFn = func(_ context.Context, _ string) ([]string, bool, bool) {
+		return []string{"1.1.1.1", "2.2.2.2", "3.3.3.3"}, false, false
+	}
+	probeEndpointFn = func(ctx context.Context, _ string, _ string, ip string) ([]float64, int, error) {
+		if ip == "1.1.1.1" {
+			return []float64{10}, 1, nil
+		}
+		<-ctx.Done()
+		return nil, 1, ctx.Err()
+	}
+
+	start := time.Now()
+	res := Discover(context.Background(), "example.com", DiscoveryOptions{ProbeURL: "https://example.com/probe"})
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("discovery should stop at the deadline, took %s", elapsed)
+	}
+	if res.Selected.IP != "1.1.1.1" {
+		t.Fatalf("expected the probed candidate to be selected, got %+v", res.Selected)
+	}
+	for _, candidate := range res.Candidates[1:] {
+		if candidate.Status != "degraded" || candidate.Error == "" {
+			t.Fatalf("expected cut-off candidates to be degraded, got %+v", res.Candidates)
+		}
+	}
+	found := false
+	for _, warning := range res.Warnings {
+		found = found || (warning.Code == "discovery_timeout" && strings.Contains(warning.Message, "marked "+res.Candidates[1].Status))
+	}
+	if !found {
+		t.Fatalf("expected discovery_timeout warning, got %+v", res.Warnings)
+	}
+}
+
+func TestDiscoverMetadataOutageDoesNotStarveProbes(t *testing.T) {
+	oldResolveDoH := resolveDoHFn
+	oldProbe := probeEndpointFn
+	oldFetchIPMetas := fetchIPMetasFn
+	oldMetaTimeout := metadataTimeout
+	t.Cleanup(func() {
+		resolveDoHFn = oldResolveDoH
+		probeEndpointFn = oldProbe
+		fetchIPMetasFn = oldFetchIPMetas
+		metadataTimeout = oldMetaTimeout
+	})
+
+	metadataTimeout = 50 * time.Millisecond
+	resolveDoHFn = func(_ context.Context, _ string) ([]string, bool, bool) {
+		return []string{"1.1.1.1", "2.2.2.2"}, false, false
+	}
+	// The provider hangs until its own deadline; the probes must not wait
+	// for it or share it.
+	metadataDone := make(chan struct{})
+	fetchIPMetasFn = func(ctx context.Context, ips []string) map[string]ipMeta {
+		<-ctx.Done()
+		close(metadataDone)
+		out := map[string]ipMeta{}
+		for _, ip := range ips {
+			out[ip] = ipMeta{Desc: "lookup failed", Failed: true}
+		}
+		return out
+	}
+	probeEndpointFn = func(ctx context.Context, _ string, _ string, ip string) ([]float64, int, error) {
+		select {
+		case <-metadataDone:
+			t.Errorf("probe of %s started after the metadata lookup ended", ip)
+		default:
+		}
+		if ip == "1.1.1.1" {
+			<-metadataDone
+		}
+		if ctx.Err() != nil {
+			return nil, 1, ctx.Err()
+		}
+		return map[string][]float64{"1.1.1.1": {20}, "2.2.2.2": {10}}[ip], 1, nil
+	}
+
+	opts := DiscoveryOptions{ProbeURL: "https://example.com/probe", Metadata: true}
+	res := Discover(context.Background(), "example.com", opts)
+	if res.DefaultDNS || res.Selected.IP != "2.2.2.2" || res.Selected.Status != "ok" {
+		t.Fatalf("expected probing to pick 2.2.2.2 despite the outage, got %+v", res)
+	}
+	for _, candidate := range res.Candidates {
+		if candidate.Status != "ok" || candidate.Desc != "lookup failed" {
+			t.Fatalf("expected probed candidates with failed metadata, got %+v", res.Candidates)
+		}
+	}
+
+	// Rules that need the missing metadata still apply once it is in.
+	metadataDone = make(chan struct{})
+	opts.Exclude = config.Match{ASNs: []int{20940}}
+	res = Discover(context.Background(), "example.com", opts)
+	if res.Selected.IP != "" || res.Error == "" {
+		t.Fatalf("expected unchecked --exclude-asn to leave no endpoint, got %+v", res)
+	}
+}
+
 func TestDiscoverHonorsForcedEndpoint(t *testing.T) {
 	oldProbe := probeEndpointFn
 	t.Cleanup(func() {
 		probeEndpointFn = oldProbe
 	})
 
-	probeEndpointFn = func(_ context.Context, _ string, _ string, ip string) (float64, error) {
+	probeEndpointFn = func(_ context.Context, _ string, _ string, ip string) ([]float64, int, error) {
 		if ip != "9.9.9.9" {
 			t.Fatalf("unexpected IP %q", ip)
 		}
-		return 12, nil
+		return []float64{12}, 1, nil
 	}
 
 	res := Discover(context.Background(), "example.com", DiscoveryOptions{
@@ -276,8 +475,71 @@ func TestDiscoverHonorsForcedEndpoint(t *testing.T) {
 	}
 }
 
+func TestBuildCandidateRecordsRTTStats(t *testing.T) {
+	oldProbe := probeEndpointFn
+	t.Cleanup(func() {
+		probeEndpointFn = oldProbe
+	})
+
+	probeEndpointFn = func(_ context.Context, _ string, _ string, _ string) ([]float64, int, error) {
+		return []float64{30, 10, 12}, 4, nil
+	}
+
+	c := buildCandidate(context.Background(), "example.com", "1.1.1.1", "dns", DiscoveryOptions{ProbeURL: "https://example.com/probe"})
+	if c.Status != "ok" {
+		t.Fatalf("expected ok candidate, got %+v", c)
+	}
+	if c.RTTMs != 12 || c.MinRTTMs != 10 || c.Samples != 3 || c.Loss != 0.25 {
+		t.Fatalf("unexpected stats: %+v", c)
+	}
+}
+
+func TestProbeEndpointReusesConnection(t *testing.T) {
+	var mu sync.Mutex
+	conns, requests := 0, 0
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	srv.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			mu.Lock()
+			conns++
+			mu.Unlock()
+		}
+	}
+	srv.Start()
+	defer srv.Close()
+
+	samples, sent, err := probeEndpoint(context.Background(), "127.0.0.1", srv.URL, "127.0.0.1")
+	if err != nil {
+		t.Fatalf("probeEndpoint: %v", err)
+	}
+	if len(samples) != probeSamples || sent != probeSamples {
+		t.Fatalf("expected %d samples, got %d of %d", probeSamples, len(samples), sent)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if requests != probeSamples || conns != 1 {
+		t.Fatalf("expected %d requests on 1 connection, got %d on %d", probeSamples, requests, conns)
+	}
+}
+
+func TestProbeEndpointUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	samples, sent, err := probeEndpoint(context.Background(), "127.0.0.1", url, "127.0.0.1")
+	if err == nil || len(samples) != 0 || sent != 1 {
+		t.Fatalf("expected failure after first attempt, got samples=%v sent=%d err=%v", samples, sent, err)
+	}
+}
+
 func TestResolveHostLocalhost(t *testing.T) {
-	ip := ResolveHost("localhost")
+	ip := ResolveHost("localhost", 0)
 	if ip != "" && net.ParseIP(ip) == nil {
 		t.Errorf("ResolveHost returned invalid IP: %q", ip)
 	}
@@ -617,17 +879,17 @@ func TestPromptChoiceCancelledContext(t *testing.T) {
 	// Since openPromptInput is not a var, we test via Choose integration.
 
 	oldResolveDoH := resolveDoHFn
-	oldFetchIPDesc := fetchIPDescFn
+	oldFetchIPMetas := fetchIPMetasFn
 	t.Cleanup(func() {
 		resolveDoHFn = oldResolveDoH
-		fetchIPDescFn = oldFetchIPDesc
+		fetchIPMetasFn = oldFetchIPMetas
 	})
 	resolveDoHFn = func(_ context.Context, _ string) ([]string, bool, bool) {
 		return []string{"1.1.1.1", "2.2.2.2"}, false, false
 	}
-	fetchIPDescFn = func(_ context.Context, ip string) string {
-		return "test-" + ip
-	}
+	fetchIPMetasFn = eachIP(func(ip string) ipMeta {
+		return ipMeta{Desc: "test-" + ip}
+	})
 
 	ep := Choose(ctx, "example.com", bus, true)
 	// With cancelled ctx, promptChoice should return cancelled=true,
@@ -641,19 +903,19 @@ func TestPromptChoiceCancelledContext(t *testing.T) {
 // Uses an os.Pipe injected via openPromptInputFn so it works in CI (no TTY).
 func TestPromptChoiceCancelDuringRead(t *testing.T) {
 	oldResolveDoH := resolveDoHFn
-	oldFetchIPDesc := fetchIPDescFn
+	oldFetchIPMetas := fetchIPMetasFn
 	oldOpenPrompt := openPromptInputFn
 	t.Cleanup(func() {
 		resolveDoHFn = oldResolveDoH
-		fetchIPDescFn = oldFetchIPDesc
+		fetchIPMetasFn = oldFetchIPMetas
 		openPromptInputFn = oldOpenPrompt
 	})
 	resolveDoHFn = func(_ context.Context, _ string) ([]string, bool, bool) {
 		return []string{"1.1.1.1", "2.2.2.2"}, false, false
 	}
-	fetchIPDescFn = func(_ context.Context, ip string) string {
-		return "test-" + ip
-	}
+	fetchIPMetasFn = eachIP(func(ip string) ipMeta {
+		return ipMeta{Desc: "test-" + ip}
+	})
 
 	// Create a pipe that will block on read until closed.
 	pr, pw, err := os.Pipe()
@@ -697,19 +959,19 @@ func TestPromptChoiceCancelDuringRead(t *testing.T) {
 // with simulated user input "2\n" injected via openPromptInputFn.
 func TestPromptChoiceNormalInput(t *testing.T) {
 	oldResolveDoH := resolveDoHFn
-	oldFetchIPDesc := fetchIPDescFn
+	oldFetchIPMetas := fetchIPMetasFn
 	oldOpenPrompt := openPromptInputFn
 	t.Cleanup(func() {
 		resolveDoHFn = oldResolveDoH
-		fetchIPDescFn = oldFetchIPDesc
+		fetchIPMetasFn = oldFetchIPMetas
 		openPromptInputFn = oldOpenPrompt
 	})
 	resolveDoHFn = func(_ context.Context, _ string) ([]string, bool, bool) {
 		return []string{"10.0.0.1", "10.0.0.2"}, false, false
 	}
-	fetchIPDescFn = func(_ context.Context, ip string) string {
-		return "desc-" + ip
-	}
+	fetchIPMetasFn = eachIP(func(ip string) ipMeta {
+		return ipMeta{Desc: "desc-" + ip}
+	})
 
 	// Create a pipe; write "2\n" to simulate the user selecting endpoint 2.
 	pr, pw, err := os.Pipe()
@@ -0,0 +1,61 @@
+package endpoint
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"slices"
+
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/config"
+)
+
+// matchRule reports which value of m, if any, candidate matches, as the
+// flag and value that matched, e.g. "--exclude-cidr 17.253.0.0/16". kind is
+// the flag prefix. Metadata fields only match once they are known.
+func matchRule(m config.Match, kind string, candidate Candidate) string {
+	addr, err := netip.ParseAddr(candidate.IP)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+	family := 4
+	if addr.Is6() {
+		family = 6
+	}
+	if slices.Contains(m.Families, family) {
+		return fmt.Sprintf("--%s-family %d", kind, family)
+	}
+	for _, prefix := range m.CIDRs {
+		if prefix.Contains(addr) {
+			return fmt.Sprintf("--%s-cidr %s", kind, prefix)
+		}
+	}
+	if candidate.ASN != 0 && slices.Contains(m.ASNs, candidate.ASN) {
+		return fmt.Sprintf("--%s-asn %d", kind, candidate.ASN)
+	}
+	if candidate.Country != "" && slices.Contains(m.Countries, candidate.Country) {
+		return fmt.Sprintf("--%s-country %s", kind, candidate.Country)
+	}
+	if m.Desc != "" && candidate.Desc != "" && !candidate.MetadataFailed {
+		if re, err := regexp.Compile(m.Desc); err == nil && re.MatchString(candidate.Desc) {
+			return fmt.Sprintf("--%s-desc %s", kind, m.Desc)
+		}
+	}
+	return ""
+}
+
+// uncheckedExclude names the ASN, country or description exclude rule that
+// cannot be checked because the candidate's metadata lookup did not yield
+// that field. Such a candidate might be the one the rule exists to avoid,
+// so it is not eligible either.
+func uncheckedExclude(m config.Match, candidate Candidate) string {
+	switch {
+	case len(m.ASNs) > 0 && candidate.ASN == 0:
+		return "--exclude-asn"
+	case len(m.Countries) > 0 && candidate.Country == "":
+		return "--exclude-country"
+	case m.Desc != "" && (candidate.MetadataFailed || candidate.Desc == ""):
+		return "--exclude-desc"
+	}
+	return ""
+}
@@ -0,0 +1,169 @@
+package endpoint
+
+import (
+	"context"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/config"
+)
+
+func TestMatchRule(t *testing.T) {
+	m := config.Match{
+		Families:  []int{6},
+		CIDRs:     []netip.Prefix{netip.MustParsePrefix("17.253.0.0/16")},
+		ASNs:      []int{714},
+		Countries: []string{"JP"},
+		Desc:      "(?i)tokyo",
+	}
+	tests := []struct {
+		candidate Candidate
+		want      string
+	}{
+		{Candidate{IP: "2403:300::1"}, "--exclude-family 6"},
+		{Candidate{IP: "17.253.85.205"}, "--exclude-cidr 17.253.0.0/16"},
+		{Candidate{IP: "23.1.1.1", ASN: 714}, "--exclude-asn 714"},
+		{Candidate{IP: "23.1.1.1", Country: "JP"}, "--exclude-country JP"},
+		{Candidate{IP: "23.1.1.1", Desc: "Tokyo, Japan"}, "--exclude-desc (?i)tokyo"},
+		{Candidate{IP: "23.1.1.1", ASN: 20940, Country: "US", Desc: "Ashburn"}, ""},
+		{Candidate{IP: "not-an-ip"}, ""},
+	}
+	for _, tt := range tests {
+		if got := matchRule(m, "exclude", tt.candidate); got != tt.want {
+			t.Errorf("matchRule(%+v) = %q, want %q", tt.candidate, got, tt.want)
+		}
+	}
+	if got := matchRule(config.Match{}, "prefer", Candidate{IP: "17.253.85.205"}); got != "" {
+		t.Errorf("empty match should not match, got %q", got)
+	}
+}
+
+func TestDiscoverAppliesCandidateRules(t *testing.T) {
+	oldResolveDoH := resolveDoHFn
+	oldFetchIPMetas := fetchIPMetasFn
+	oldProbe := probeEndpointFn
+	t.Cleanup(func() {
+		resolveDoHFn = oldResolveDoH
+		fetchIPMetasFn = oldFetchIPMetas
+		probeEndpointFn = oldProbe
+	})
+
+	resolveDoHFn = func(context.Context, string) ([]string, bool, bool) {
+		return []string{"17.253.85.205", "23.1.1.1", "23.2.2.2"}, false, false
+	}
+	fetchIPMetasFn = eachIP(func(ip string) ipMeta {
+		if ip == "23.2.2.2" {
+			return ipMeta{Desc: "desc-" + ip, ASN: 714, Country: "JP"}
+		}
+		return ipMeta{Desc: "desc-" + ip, ASN: 20940, Country: "US"}
+	})
+	var probed sync.Map
+	probeEndpointFn = func(_ context.Context, _ string, _ string, ip string) ([]float64, int, error) {
+		probed.Store(ip, true)
+		if ip == "23.2.2.2" {
+			return []float64{40}, 1, nil
+		}
+		return []float64{5}, 1, nil
+	}
+
+	res := Discover(context.Background(), "example.com", DiscoveryOptions{
+		ProbeURL: "https://example.com/probe",
+		Metadata: true,
+		Prefer:   config.Match{ASNs: []int{714}},
+		Exclude:  config.Match{CIDRs: []netip.Prefix{netip.MustParsePrefix("17.253.0.0/16")}},
+	})
+	if _, ok := probed.Load("17.253.85.205"); ok {
+		t.Fatal("excluded candidate should not be probed")
+	}
+	if res.Selected.IP != "23.2.2.2" {
+		t.Fatalf("expected the preferred candidate despite higher RTT, got %+v", res.Selected)
+	}
+	var order []string
+	for _, c := range res.Candidates {
+		order = append(order, c.IP)
+	}
+	if strings.Join(order, ",") != "23.2.2.2,23.1.1.1,17.253.85.205" {
+		t.Fatalf("candidate order = %v", order)
+	}
+	last := res.Candidates[2]
+	if last.Status != "excluded" || !strings.Contains(last.Error, "--exclude-cidr 17.253.0.0/16") {
+		t.Fatalf("unexpected excluded candidate %+v", last)
+	}
+}
+
+func TestDiscoverNeverFallsBackToExcluded(t *testing.T) {
+	oldResolveDoH := resolveDoHFn
+	oldResolveSystem := resolveSystemFn
+	oldFetchIPMetas := fetchIPMetasFn
+	oldProbe := probeEndpointFn
+	t.Cleanup(func() {
+		resolveDoHFn = oldResolveDoH
+		resolveSystemFn = oldResolveSystem
+		fetchIPMetasFn = oldFetchIPMetas
+		probeEndpointFn = oldProbe
+	})
+	probeEndpointFn = func(context.Context, string, string, string) ([]float64, int, error) {
+		return []float64{5}, 1, nil
+	}
+	fetchIPMetasFn = eachIP(func(ip string) ipMeta {
+		if ip == "23.1.1.1" {
+			return ipMeta{Desc: "lookup failed", Failed: true}
+		}
+		return ipMeta{Desc: "desc-" + ip, ASN: 714, Country: "JP"}
+	})
+	exclude := config.Match{CIDRs: []netip.Prefix{netip.MustParsePrefix("17.253.0.0/16")}}
+	opts := DiscoveryOptions{ProbeURL: "https://example.com/probe", Metadata: true, Exclude: exclude}
+
+	// Every DoH candidate excluded: no default DNS fallback.
+	resolveDoHFn = func(context.Context, string) ([]string, bool, bool) {
+		return []string{"17.253.85.205", "17.253.85.206"}, false, false
+	}
+	res := Discover(context.Background(), "example.com", opts)
+	if res.Error == "" || res.Selected.IP != "" || res.DefaultDNS {
+		t.Fatalf("all excluded: %+v", res)
+	}
+
+	// Both DoH providers time out and system DNS answers an excluded address.
+	resolveDoHFn = func(context.Context, string) ([]string, bool, bool) { return nil, true, true }
+	resolveSystemFn = func(string, int) string { return "17.253.85.205" }
+	res = Discover(context.Background(), "example.com", opts)
+	if res.Error == "" || res.Selected.IP != "" || len(res.Candidates) != 1 || res.Candidates[0].Status != "excluded" {
+		t.Fatalf("excluded system DNS answer: %+v", res)
+	}
+	resolveSystemFn = func(string, int) string { return "23.2.2.2" }
+	if res := Discover(context.Background(), "example.com", opts); res.Error != "" || res.Selected.IP != "23.2.2.2" {
+		t.Fatalf("allowed system DNS answer: %+v", res)
+	}
+
+	// Nothing resolves at all.
+	resolveSystemFn = func(string, int) string { return "" }
+	if res := Discover(context.Background(), "example.com", opts); res.Error == "" || res.DefaultDNS {
+		t.Fatalf("unresolved with exclude rules: %+v", res)
+	}
+	opts.Exclude = config.Match{}
+	if res := Discover(context.Background(), "example.com", opts); res.Error != "" || !res.DefaultDNS {
+		t.Fatalf("unresolved without rules should use default DNS: %+v", res)
+	}
+
+	// A candidate whose ASN is unknown cannot be checked against --exclude-asn.
+	resolveDoHFn = func(context.Context, string) ([]string, bool, bool) {
+		return []string{"23.1.1.1", "23.2.2.2"}, false, false
+	}
+	opts.Exclude = config.Match{ASNs: []int{20940}}
+	res = Discover(context.Background(), "example.com", opts)
+	if res.Selected.IP != "23.2.2.2" || res.Candidates[1].IP != "23.1.1.1" || res.Candidates[1].Status != "excluded" ||
+		!strings.Contains(res.Candidates[1].Error, "--exclude-asn") {
+		t.Fatalf("unknown ASN: %+v", res)
+	}
+
+	// Nor can its placeholder description be checked against --exclude-desc,
+	// even by a pattern the placeholder does not match.
+	opts.Exclude = config.Match{Desc: "(?i)akamai"}
+	res = Discover(context.Background(), "example.com", opts)
+	if res.Selected.IP != "23.2.2.2" || res.Candidates[1].IP != "23.1.1.1" || res.Candidates[1].Status != "excluded" ||
+		!strings.Contains(res.Candidates[1].Error, "--exclude-desc") {
+		t.Fatalf("unknown description: %+v", res)
+	}
+}
@@ -0,0 +1,603 @@
+package endpoint
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/i18n"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/mmdb"
+)
+
+// Provider looks up the network and location of an IP address. Lookup with
+// an empty ip describes the caller's own public address. A successful
+// result has Status "success" and Query set to the address looked up.
+type Provider interface {
+	Name() string
+	Lookup(ctx context.Context, ip string) (IPInfo, error)
+}
+
+// BatchProvider is a Provider that can also look up many addresses in one
+// request. Addresses missing from the result are looked up one at a time.
+type BatchProvider interface {
+	Provider
+	LookupBatch(ctx context.Context, ips []string) (map[string]IPInfo, error)
+}
+
+// ProviderOptions selects a metadata provider. Name is ip-api, ipinfo,
+// ripestat, mmdb or an http(s) URL template in which {ip} stands for the
+// address. Token authenticates ipinfo requests. Fields maps IPInfo keys (ip,
+// asn, isp, org, city, region, country, country_code) to dot-separated paths
+// in a template provider's JSON reply. MMDB lists the MaxMind DB files
+// (City, Country, ASN or ISP) the mmdb provider reads.
+type ProviderOptions struct {
+	Name   string
+	Token  string
+	Fields map[string]string
+	MMDB   []string
+}
+
+var (
+	ipAPIBaseURL    = "http://ip-api.com/json/"
+	ipAPIBatchURL   = "http://ip-api.com/batch"
+	ipinfoBaseURL   = "https://ipinfo.io/"
+	ripeStatBaseURL = "https://stat.ripe.net/data/"
+
+	provider atomic.Pointer[Provider]
+)
+
+func init() {
+	SetProvider(ipAPIProvider{})
+}
+
+// NewProvider returns the provider described by o.
+func NewProvider(o ProviderOptions) (Provider, error) {
+	switch o.Name {
+	case "", "ip-api":
+		return ipAPIProvider{}, nil
+	case "ipinfo":
+		return ipinfoProvider{token: o.Token}, nil
+	case "ripestat":
+		return ripeStatProvider{}, nil
+	case "mmdb":
+		return newMMDBProvider(o.MMDB)
+	}
+	if strings.HasPrefix(o.Name, "https://") || strings.HasPrefix(o.Name, "http://") {
+		return newTemplateProvider(o.Name, o.Fields)
+	}
+	if i18n.IsZH() {
+		return nil, fmt.Errorf("未知的元数据来源 %q", o.Name)
+	}
+	return nil, fmt.Errorf("unknown metadata provider %q", o.Name)
+}
+
+// SetProvider makes p answer every metadata lookup from now on.
+func SetProvider(p Provider) {
+	provider.Store(&p)
+}
+
+// CurrentProvider returns the provider set by SetProvider, ip-api by
+// default.
+func CurrentProvider() Provider {
+	return *provider.Load()
+}
+
+// getJSON decodes the JSON reply to a GET of rawURL into v.
+func getJSON(ctx context.Context, rawURL string, header http.Header, v any) error {
+	return requestJSON(ctx, http.MethodGet, rawURL, header, nil, v)
+}
+
+// postJSON sends body as JSON to rawURL and decodes the reply into v.
+func postJSON(ctx context.Context, rawURL string, header http.Header, body, v any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return requestJSON(ctx, http.MethodPost, rawURL, header, data, v)
+}
+
+func requestJSON(ctx context.Context, method, rawURL string, header http.Header, body []byte, v any) error {
+	req, err := http.NewRequestWithContext(ctx, method, rawURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for k, values := range header {
+		req.Header[k] = values
+	}
+	req.Header.Set("User-Agent", "iNetSpeed-CLI")
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	client := metadataHTTPClient
+	if family := familyOf(ctx); family != 0 {
+		opts := netOpts
+		opts.Network = fmt.Sprintf("tcp%d", family)
+		client = metadataClient(opts, metadataHTTPClient.Timeout)
+		defer client.CloseIdleConnections()
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// ipAPIProvider queries ip-api.com. Its free tier only serves plain HTTP.
+type ipAPIProvider struct{}
+
+func (ipAPIProvider) Name() string { return "ip-api" }
+
+const ipAPIFields = "status,query,as,isp,org,city,regionName,country,countryCode"
+
+// ipAPIBatchSize is the most addresses ip-api accepts in one batch request.
+const ipAPIBatchSize = 100
+
+func (ipAPIProvider) Lookup(ctx context.Context, ip string) (IPInfo, error) {
+	var info IPInfo
+	if err := getJSON(ctx, buildIPAPIURL(ip, ipAPIFields), nil, &info); err != nil {
+		return IPInfo{}, err
+	}
+	if info.Status != "success" {
+		return IPInfo{}, fmt.Errorf("ip-api status: %s", info.Status)
+	}
+	return info, nil
+}
+
+// LookupBatch posts ips to the batch endpoint, ipAPIBatchSize at a time.
+func (ipAPIProvider) LookupBatch(ctx context.Context, ips []string) (map[string]IPInfo, error) {
+	out := make(map[string]IPInfo, len(ips))
+	for chunk := range slices.Chunk(ips, ipAPIBatchSize) {
+		var infos []IPInfo
+		if err := postJSON(ctx, ipAPIBatchURL+"?fields="+ipAPIFields+ipAPILangSuffix(), nil, chunk, &infos); err != nil {
+			return out, err
+		}
+		for _, info := range infos {
+			if info.Status == "success" && info.Query != "" {
+				out[info.Query] = info
+			}
+		}
+	}
+	return out, nil
+}
+
+func buildIPAPIURL(target, fields string) string {
+	return fmt.Sprintf("%s%s?fields=%s%s", ipAPIBaseURL, target, fields, ipAPILangSuffix())
+}
+
+func ipAPILangSuffix() string {
+	if i18n.IsZH() {
+		return "&lang=zh-CN"
+	}
+	return ""
+}
+
+// ipinfoProvider queries ipinfo.io over HTTPS, with a bearer token when one
+// is set. The free plan reports the country as a code only.
+type ipinfoProvider struct {
+	token string
+}
+
+func (ipinfoProvider) Name() string { return "ipinfo" }
+
+type ipinfoReply struct {
+	IP      string `json:"ip"`
+	City    string `json:"city"`
+	Region  string `json:"region"`
+	Country string `json:"country"`
+	Org     string `json:"org"`
+	Bogon   bool   `json:"bogon"`
+}
+
+func (r ipinfoReply) info() (IPInfo, bool) {
+	if r.IP == "" || r.Bogon {
+		return IPInfo{}, false
+	}
+	// org is "AS15169 Google LLC": the ASN followed by its holder.
+	_, holder, _ := strings.Cut(r.Org, " ")
+	return IPInfo{
+		Status:      "success",
+		Query:       r.IP,
+		AS:          r.Org,
+		ISP:         holder,
+		Org:         holder,
+		City:        r.City,
+		RegionName:  r.Region,
+		Country:     r.Country,
+		CountryCode: r.Country,
+	}, true
+}
+
+func (p ipinfoProvider) header() http.Header {
+	header := http.Header{}
+	if p.token != "" {
+		header.Set("Authorization", "Bearer "+p.token)
+	}
+	return header
+}
+
+func (p ipinfoProvider) Lookup(ctx context.Context, ip string) (IPInfo, error) {
+	target := ipinfoBaseURL + "json"
+	if ip != "" {
+		target = ipinfoBaseURL + url.PathEscape(ip) + "/json"
+	}
+	var reply ipinfoReply
+	if err := getJSON(ctx, target, p.header(), &reply); err != nil {
+		return IPInfo{}, err
+	}
+	info, ok := reply.info()
+	if !ok {
+		return IPInfo{}, fmt.Errorf("ipinfo: no data for %q", ip)
+	}
+	return info, nil
+}
+
+// LookupBatch uses the batch endpoint, which requires a token.
+func (p ipinfoProvider) LookupBatch(ctx context.Context, ips []string) (map[string]IPInfo, error) {
+	if p.token == "" {
+		return nil, errors.New("ipinfo: batch lookups need a token")
+	}
+	var replies map[string]ipinfoReply
+	if err := postJSON(ctx, ipinfoBaseURL+"batch", p.header(), ips, &replies); err != nil {
+		return nil, err
+	}
+	out := make(map[string]IPInfo, len(replies))
+	for ip, reply := range replies {
+		if info, ok := reply.info(); ok {
+			out[ip] = info
+		}
+	}
+	return out, nil
+}
+
+// ripeStatProvider combines the RIPEstat prefix-overview (origin AS) and
+// maxmind-geo-lite (location) data calls. Both are served over HTTPS
+// without a key.
+type ripeStatProvider struct{}
+
+func (ripeStatProvider) Name() string { return "ripestat" }
+
+func (ripeStatProvider) Lookup(ctx context.Context, ip string) (IPInfo, error) {
+	if ip == "" {
+		var mine struct {
+			Data struct {
+				IP string `json:"ip"`
+			} `json:"data"`
+		}
+		if err := getJSON(ctx, ripeStatBaseURL+"whats-my-ip/data.json", nil, &mine); err != nil {
+			return IPInfo{}, err
+		}
+		if mine.Data.IP == "" {
+			return IPInfo{}, fmt.Errorf("ripestat: no address in whats-my-ip reply")
+		}
+		ip = mine.Data.IP
+	}
+
+	var prefix struct {
+		Data struct {
+			ASNs []struct {
+				ASN    int    `json:"asn"`
+				Holder string `json:"holder"`
+			} `json:"asns"`
+		} `json:"data"`
+	}
+	if err := getJSON(ctx, ripeStatBaseURL+"prefix-overview/data.json?resource="+url.QueryEscape(ip), nil, &prefix); err != nil {
+		return IPInfo{}, err
+	}
+	info := IPInfo{Status: "success", Query: ip}
+	if asns := prefix.Data.ASNs; len(asns) > 0 {
+		info.AS = fmt.Sprintf("AS%d %s", asns[0].ASN, asns[0].Holder)
+		info.ISP = asns[0].Holder
+		info.Org = asns[0].Holder
+	}
+
+	// Location is best effort: an unrouted or new prefix has none.
+	var geo struct {
+		Data struct {
+			LocatedResources []struct {
+				Locations []struct {
+					City    string `json:"city"`
+					Country string `json:"country"`
+				} `json:"locations"`
+			} `json:"located_resources"`
+		} `json:"data"`
+	}
+	if err := getJSON(ctx, ripeStatBaseURL+"maxmind-geo-lite/data.json?resource="+url.QueryEscape(ip), nil, &geo); err == nil {
+		for _, res := range geo.Data.LocatedResources {
+			if len(res.Locations) > 0 {
+				info.City = res.Locations[0].City
+				info.Country = res.Locations[0].Country
+				info.CountryCode = res.Locations[0].Country
+				break
+			}
+		}
+	}
+	if info.AS == "" && info.Country == "" {
+		return IPInfo{}, fmt.Errorf("ripestat: no data for %s", ip)
+	}
+	return info, nil
+}
+
+// mmdbProvider answers lookups from local MaxMind DB files without any
+// network traffic. A record's fields are taken from the first database that
+// has them, so City and ASN databases combine.
+type mmdbProvider struct {
+	dbs []*mmdb.Reader
+}
+
+func newMMDBProvider(paths []string) (Provider, error) {
+	if len(paths) == 0 {
+		return nil, errors.New(i18n.Text("the mmdb metadata provider needs --mmdb PATH", "mmdb 元数据来源需要 --mmdb PATH"))
+	}
+	var p mmdbProvider
+	for _, path := range paths {
+		db, err := mmdb.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		p.dbs = append(p.dbs, db)
+	}
+	return p, nil
+}
+
+func (mmdbProvider) Name() string { return "mmdb" }
+
+// NoPublicAddrError reports that the caller's own address cannot be looked
+// up offline: the local address outbound traffic leaves from is not public,
+// as behind NAT, and only an online service sees the public one.
+type NoPublicAddrError struct {
+	Local string
+}
+
+func (e *NoPublicAddrError) Error() string {
+	return fmt.Sprintf(i18n.Text("local address %s is not public; the public address cannot be determined offline",
+		"本机地址 %s 不是公网地址，离线数据库无法得知公网地址"), e.Local)
+}
+
+// Lookup with an empty ip describes the local address that outbound
+// traffic leaves from, which is reported even when no database has a
+// record for it. Behind NAT that address is private and Lookup fails with
+// a NoPublicAddrError.
+func (p mmdbProvider) Lookup(ctx context.Context, ip string) (IPInfo, error) {
+	self := ip == ""
+	if self {
+		local, err := outboundAddr(ctx)
+		if err != nil {
+			return IPInfo{}, err
+		}
+		if addr, err := netip.ParseAddr(local); err == nil && !publicAddr(addr) {
+			return IPInfo{}, &NoPublicAddrError{Local: local}
+		}
+		ip = local
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return IPInfo{}, err
+	}
+	lang := "en"
+	if i18n.IsZH() {
+		lang = "zh-CN"
+	}
+	name := func(rec any, path string) string {
+		return firstNonEmpty(jsonPath(rec, path+".names."+lang), jsonPath(rec, path+".names.en"))
+	}
+
+	var asn, asOrg, isp, org, city, region, country, code string
+	for _, db := range p.dbs {
+		rec, err := db.Lookup(addr)
+		if err != nil {
+			return IPInfo{}, err
+		}
+		if rec == nil {
+			continue
+		}
+		asn = firstNonEmpty(asn, jsonPath(rec, "autonomous_system_number"))
+		asOrg = firstNonEmpty(asOrg, jsonPath(rec, "autonomous_system_organization"))
+		isp = firstNonEmpty(isp, jsonPath(rec, "isp"))
+		org = firstNonEmpty(org, jsonPath(rec, "organization"))
+		city = firstNonEmpty(city, name(rec, "city"))
+		region = firstNonEmpty(region, name(rec, "subdivisions.0"))
+		country = firstNonEmpty(country, name(rec, "country"), name(rec, "registered_country"))
+		code = firstNonEmpty(code, jsonPath(rec, "country.iso_code"), jsonPath(rec, "registered_country.iso_code"))
+	}
+	info := IPInfo{
+		Status:      "success",
+		Query:       addr.String(),
+		ISP:         firstNonEmpty(isp, asOrg, org),
+		Org:         firstNonEmpty(org, asOrg),
+		City:        city,
+		RegionName:  region,
+		Country:     country,
+		CountryCode: code,
+	}
+	if asn != "" {
+		info.AS = strings.TrimSpace("AS" + asn + " " + asOrg)
+	}
+	if info.AS == "" && info.ISP == "" && info.Country == "" && !self {
+		return IPInfo{}, fmt.Errorf("mmdb: no record for %s", addr)
+	}
+	return info, nil
+}
+
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// publicAddr reports whether addr can be the caller's address on the
+// internet, ruling out private, carrier-grade NAT, loopback and link-local
+// ranges.
+func publicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsGlobalUnicast() && !addr.IsPrivate() && !sharedAddressSpace.Contains(addr)
+}
+
+// outboundAddr returns the local address the routing table picks for
+// public destinations, of the family set on ctx if any. Connecting a UDP
+// socket sends no packets.
+func outboundAddr(ctx context.Context) (string, error) {
+	targets := []string{"1.1.1.1:53", "[2606:4700:4700::1111]:53"}
+	switch familyOf(ctx) {
+	case 4:
+		targets = targets[:1]
+	case 6:
+		targets = targets[1:]
+	}
+	var lastErr error
+	for _, target := range targets {
+		d, err := netOpts.Dialer("udp", target)
+		if err != nil {
+			return "", err
+		}
+		conn, err := d.DialContext(ctx, "udp", target)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		local := conn.LocalAddr().(*net.UDPAddr).IP.String()
+		conn.Close()
+		return local, nil
+	}
+	return "", lastErr
+}
+
+// templateFields lists the keys a template provider maps, with the JSON
+// path used when --metadata-fields does not name one.
+var templateFields = map[string]string{
+	"ip":           "ip",
+	"asn":          "asn",
+	"isp":          "isp",
+	"org":          "org",
+	"city":         "city",
+	"region":       "region",
+	"country":      "country",
+	"country_code": "country_code",
+}
+
+// templateProvider queries any JSON API: {ip} in the URL is replaced by the
+// address, or by nothing for the caller's own, and fields picks values out
+// of the reply.
+type templateProvider struct {
+	template string
+	fields   map[string]string
+}
+
+func newTemplateProvider(template string, fields map[string]string) (Provider, error) {
+	if !strings.Contains(template, "{ip}") {
+		if i18n.IsZH() {
+			return nil, fmt.Errorf("元数据 URL 模板 %q 缺少 {ip} 占位符", template)
+		}
+		return nil, fmt.Errorf("metadata URL template %q has no {ip} placeholder", template)
+	}
+	p := templateProvider{template: template, fields: map[string]string{}}
+	for key, path := range templateFields {
+		p.fields[key] = path
+	}
+	for key, path := range fields {
+		if _, ok := templateFields[key]; !ok {
+			if i18n.IsZH() {
+				return nil, fmt.Errorf("未知的元数据字段 %q", key)
+			}
+			return nil, fmt.Errorf("unknown metadata field %q", key)
+		}
+		p.fields[key] = path
+	}
+	return p, nil
+}
+
+func (p templateProvider) Name() string {
+	u, err := url.Parse(strings.ReplaceAll(p.template, "{ip}", ""))
+	if err != nil {
+		return "template"
+	}
+	return u.Host
+}
+
+func (p templateProvider) Lookup(ctx context.Context, ip string) (IPInfo, error) {
+	var reply any
+	if err := getJSON(ctx, strings.ReplaceAll(p.template, "{ip}", url.PathEscape(ip)), nil, &reply); err != nil {
+		return IPInfo{}, err
+	}
+	field := func(key string) string {
+		return jsonPath(reply, p.fields[key])
+	}
+	info := IPInfo{
+		Status:      "success",
+		Query:       field("ip"),
+		ISP:         field("isp"),
+		Org:         field("org"),
+		City:        field("city"),
+		RegionName:  field("region"),
+		Country:     field("country"),
+		CountryCode: field("country_code"),
+	}
+	if info.Query == "" {
+		info.Query = ip
+	}
+	if info.Query == "" {
+		return IPInfo{}, fmt.Errorf("%s: no %q in reply", p.Name(), p.fields["ip"])
+	}
+	// Normalise the ASN to ip-api's "AS714 Apple Inc." form.
+	if asn := parseASN(field("asn")); asn != 0 {
+		info.AS = strings.TrimSpace(fmt.Sprintf("AS%d %s", asn, firstNonEmpty(info.Org, info.ISP)))
+	}
+	if info.Country == "" {
+		info.Country = info.CountryCode
+	}
+	return info, nil
+}
+
+// jsonPath follows a dot-separated path of object keys and array indexes
+// through a decoded JSON or MMDB value and formats the scalar it ends at.
+func jsonPath(v any, path string) string {
+	if path == "" {
+		return ""
+	}
+	for _, key := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]any:
+			v = node[key]
+		case []any:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(node) {
+				return ""
+			}
+			v = node[i]
+		default:
+			return ""
+		}
+	}
+	switch value := v.(type) {
+	case string:
+		return value
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	case uint64:
+		return strconv.FormatUint(value, 10)
+	case int64:
+		return strconv.FormatInt(value, 10)
+	case bool:
+		return strconv.FormatBool(value)
+	}
+	return ""
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
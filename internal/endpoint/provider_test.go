@@ -0,0 +1,214 @@
+package endpoint
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/i18n"
+)
+
+// providerServer answers each path in replies with its JSON body and
+// records the Authorization header it last saw.
+func providerServer(t *testing.T, replies map[string]string, auth *string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth != nil {
+			*auth = r.Header.Get("Authorization")
+		}
+		body, ok := replies[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestIPInfoProvider(t *testing.T) {
+	var auth string
+	srv := providerServer(t, map[string]string{
+		"/json":             `{"ip":"198.51.100.7","city":"Berlin","region":"Berlin","country":"DE","org":"AS3320 Deutsche Telekom AG"}`,
+		"/17.253.84.1/json": `{"ip":"17.253.84.1","city":"Frankfurt am Main","region":"Hesse","country":"DE","org":"AS714 Apple Inc."}`,
+		"/10.0.0.1/json":    `{"ip":"10.0.0.1","bogon":true}`,
+	}, &auth)
+	old := ipinfoBaseURL
+	ipinfoBaseURL = srv.URL + "/"
+	t.Cleanup(func() { ipinfoBaseURL = old })
+
+	p, err := NewProvider(ProviderOptions{Name: "ipinfo", Token: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	self, err := p.Lookup(context.Background(), "")
+	if err != nil || self.Query != "198.51.100.7" || self.ISP != "Deutsche Telekom AG" {
+		t.Fatalf("self lookup = %+v, %v", self, err)
+	}
+	if auth != "Bearer secret" {
+		t.Fatalf("Authorization = %q", auth)
+	}
+	info, err := p.Lookup(context.Background(), "17.253.84.1")
+	if err != nil || parseASN(info.AS) != 714 || info.CountryCode != "DE" || info.RegionName != "Hesse" {
+		t.Fatalf("lookup = %+v, %v", info, err)
+	}
+	if _, err := p.Lookup(context.Background(), "10.0.0.1"); err == nil {
+		t.Fatal("bogon lookup should fail")
+	}
+}
+
+func TestClientLookupUsesFamily(t *testing.T) {
+	srv := providerServer(t, map[string]string{
+		"/json": `{"ip":"198.51.100.7","country":"DE","org":"AS3320 Deutsche Telekom AG"}`,
+	}, nil)
+	old := ipinfoBaseURL
+	ipinfoBaseURL = srv.URL + "/"
+	t.Cleanup(func() { ipinfoBaseURL = old })
+
+	p, err := NewProvider(ProviderOptions{Name: "ipinfo"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The test server only listens on 127.0.0.1, so an IPv6-only lookup
+	// cannot reach it.
+	if info, err := p.Lookup(withFamily(context.Background(), 4), ""); err != nil || info.Query != "198.51.100.7" {
+		t.Fatalf("IPv4 self lookup = %+v, %v", info, err)
+	}
+	if info, err := p.Lookup(withFamily(context.Background(), 6), ""); err == nil {
+		t.Fatalf("IPv6 self lookup reached an IPv4-only server: %+v", info)
+	}
+}
+
+func TestRIPEstatProvider(t *testing.T) {
+	srv := providerServer(t, map[string]string{
+		"/whats-my-ip/data.json":      `{"data":{"ip":"17.253.84.1"}}`,
+		"/prefix-overview/data.json":  `{"data":{"asns":[{"asn":714,"holder":"APPLE-ENGINEERING"}]}}`,
+		"/maxmind-geo-lite/data.json": `{"data":{"located_resources":[{"locations":[{"city":"Frankfurt am Main","country":"DE"}]}]}}`,
+	}, nil)
+	old := ripeStatBaseURL
+	ripeStatBaseURL = srv.URL + "/"
+	t.Cleanup(func() { ripeStatBaseURL = old })
+
+	info, err := ripeStatProvider{}.Lookup(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := IPInfo{Status: "success", Query: "17.253.84.1", AS: "AS714 APPLE-ENGINEERING", ISP: "APPLE-ENGINEERING", Org: "APPLE-ENGINEERING",
+		City: "Frankfurt am Main", Country: "DE", CountryCode: "DE"}
+	if info != want {
+		t.Fatalf("lookup = %+v, want %+v", info, want)
+	}
+}
+
+func TestTemplateProvider(t *testing.T) {
+	srv := providerServer(t, map[string]string{
+		"/geo/2001:db8::1": `{"address":"2001:db8::1","network":{"asn":64500,"name":"Example Net"},"location":{"city":"Tokyo","country":{"name":"Japan","iso":"JP"}}}`,
+	}, nil)
+
+	if _, err := NewProvider(ProviderOptions{Name: srv.URL + "/geo"}); err == nil {
+		t.Fatal("template without {ip} should be rejected")
+	}
+	if _, err := NewProvider(ProviderOptions{Name: srv.URL + "/geo/{ip}", Fields: map[string]string{"zip": "postal"}}); err == nil {
+		t.Fatal("unknown field should be rejected")
+	}
+	p, err := NewProvider(ProviderOptions{Name: srv.URL + "/geo/{ip}", Fields: map[string]string{
+		"ip":           "address",
+		"asn":          "network.asn",
+		"isp":          "network.name",
+		"city":         "location.city",
+		"country":      "location.country.name",
+		"country_code": "location.country.iso",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := p.Lookup(context.Background(), "2001:db8::1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Query != "2001:db8::1" || info.AS != "AS64500 Example Net" || info.City != "Tokyo" || info.Country != "Japan" || info.CountryCode != "JP" {
+		t.Fatalf("lookup = %+v", info)
+	}
+}
+
+func TestSetProvider(t *testing.T) {
+	old := CurrentProvider()
+	t.Cleanup(func() { SetProvider(old) })
+	for _, name := range []string{"ipinfo", "ripestat", "ip-api"} {
+		p, err := NewProvider(ProviderOptions{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+		SetProvider(p)
+		if got := CurrentProvider().Name(); got != name {
+			t.Fatalf("CurrentProvider() = %s, want %s", got, name)
+		}
+	}
+}
+
+func TestJSONPath(t *testing.T) {
+	v := map[string]any{"a": []any{map[string]any{"b": 7.0}, "x"}, "c": true}
+	tests := map[string]string{"a.0.b": "7", "a.1": "x", "c": "true", "a.2": "", "a.0.b.c": "", "": ""}
+	for path, want := range tests {
+		if got := jsonPath(v, path); got != want {
+			t.Errorf("jsonPath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestMMDBProvider(t *testing.T) {
+	if _, err := NewProvider(ProviderOptions{Name: "mmdb"}); err == nil {
+		t.Fatal("mmdb without files should be rejected")
+	}
+	p, err := NewProvider(ProviderOptions{Name: "mmdb", MMDB: []string{"testdata/test-city.mmdb", "testdata/test-asn.mmdb"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	oldLang := i18n.Lang()
+	defer i18n.Set(oldLang)
+	i18n.Set("en")
+	info, err := p.Lookup(context.Background(), "1.1.1.1")
+	want := IPInfo{Status: "success", Query: "1.1.1.1", AS: "AS13335 CLOUDFLARENET", ISP: "CLOUDFLARENET", Org: "CLOUDFLARENET",
+		City: "Sydney", RegionName: "New South Wales", Country: "Australia", CountryCode: "AU"}
+	if err != nil || info != want {
+		t.Fatalf("Lookup(1.1.1.1) = %+v, %v; want %+v", info, err, want)
+	}
+
+	i18n.Set("zh")
+	if info, err := p.Lookup(context.Background(), "1.1.1.1"); err != nil || info.City != "悉尼" {
+		t.Fatalf("zh Lookup(1.1.1.1) = %+v, %v", info, err)
+	}
+	// Only the ASN database covers this address.
+	if info, err := p.Lookup(context.Background(), "2606:4700::1111"); err != nil || parseASN(info.AS) != 13335 || info.City != "" {
+		t.Fatalf("Lookup(2606:4700::1111) = %+v, %v", info, err)
+	}
+	if _, err := p.Lookup(context.Background(), "192.0.2.1"); err == nil {
+		t.Fatal("address outside the databases should fail")
+	}
+}
+
+func TestPublicAddr(t *testing.T) {
+	tests := map[string]bool{
+		"1.1.1.1":         true,
+		"2606:4700::1111": true,
+		"192.168.1.5":     false,
+		"10.0.0.1":        false,
+		"172.16.0.1":      false,
+		"100.64.0.1":      false,
+		"127.0.0.1":       false,
+		"169.254.1.1":     false,
+		"fd00::1":         false,
+		"fe80::1":         false,
+		"::ffff:10.0.0.1": false,
+	}
+	for in, want := range tests {
+		if got := publicAddr(netip.MustParseAddr(in)); got != want {
+			t.Errorf("publicAddr(%s) = %v, want %v", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+package endpoint
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"sync"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	dnsMessageType = "application/dns-message"
+	dnsMaxMessage  = 64 * 1024
+)
+
+// resolveWithResolvers queries A and AAAA records for host on every
+// resolver concurrently and merges the answers in resolver order. A valid
+// subnet is sent as EDNS Client Subnet. The bool reports whether every query
+// timed out.
+func resolveWithResolvers(ctx context.Context, host string, resolvers []string, subnet netip.Prefix) ([]string, bool) {
+	results := lookupAll(ctx, host, resolvers, subnet)
+	lists := make([][]string, 0, len(results))
+	allTimedOut := len(results) > 0
+	for _, r := range results {
+		lists = append(lists, r.ips)
+		allTimedOut = allTimedOut && r.timedOut
+	}
+	return mergeIPLists(lists...), allTimedOut
+}
+
+// lookupAll returns the A and AAAA results of every resolver, in resolver
+// order.
+func lookupAll(ctx context.Context, host string, resolvers []string, subnet netip.Prefix) []dohResult {
+	results := make([]dohResult, 2*len(resolvers))
+	var wg sync.WaitGroup
+	for i, spec := range resolvers {
+		for j, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+			wg.Add(1)
+			go func(idx int, spec string, qtype dnsmessage.Type) {
+				defer wg.Done()
+				results[idx] = queryResolver(ctx, spec, host, qtype, subnet)
+			}(2*i+j, spec, qtype)
+		}
+	}
+	wg.Wait()
+	return results
+}
+
+// queryResolver sends one query to spec, which is an http(s):// DoH URL or
+// a udp://, tcp:// or tls:// (DNS over TLS) server address.
+func queryResolver(ctx context.Context, spec, host string, qtype dnsmessage.Type, subnet netip.Prefix) dohResult {
+	ctx2, cancel := context.WithTimeout(ctx, dohTimeout)
+	defer cancel()
+
+	u, err := url.Parse(spec)
+	if err != nil {
+		return dohResult{err: err}
+	}
+	// DoH keeps the message ID at zero so responses stay cacheable.
+	var id uint16
+	if u.Scheme != "https" && u.Scheme != "http" {
+		id = uint16(rand.Uint32())
+	}
+	query, err := buildDNSQuery(host, qtype, id, subnet)
+	if err != nil {
+		return dohResult{err: err}
+	}
+
+	var reply []byte
+	switch u.Scheme {
+	case "https", "http":
+		reply, err = exchangeDoH(ctx2, u, query)
+	case "udp":
+		reply, err = exchangeUDP(ctx2, resolverAddr(u, "53"), query)
+	case "tcp":
+		reply, err = exchangeStream(ctx2, resolverAddr(u, "53"), query, nil)
+	case "tls":
+		reply, err = exchangeStream(ctx2, resolverAddr(u, "853"), query, &tls.Config{ServerName: u.Hostname()})
+	default:
+		err = fmt.Errorf("unsupported resolver scheme %q", u.Scheme)
+	}
+	if err != nil {
+		return dohResult{timedOut: isTimeoutErr(err), err: err}
+	}
+	ips, scope, err := parseDNSAnswer(reply, id)
+	return dohResult{ips: ips, ecsScope: scope, err: err}
+}
+
+func resolverAddr(u *url.URL, defaultPort string) string {
+	port := u.Port()
+	if port == "" {
+		port = defaultPort
+	}
+	return net.JoinHostPort(u.Hostname(), port)
+}
+
+// exchangeDoH sends an RFC 8484 GET request with the query in the dns
+// parameter.
+func exchangeDoH(ctx context.Context, u *url.URL, query []byte) ([]byte, error) {
+	reqURL := *u
+	params := reqURL.Query()
+	params.Set("dns", base64.RawURLEncoding.EncodeToString(query))
+	reqURL.RawQuery = params.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", dnsMessageType)
+	req.Header.Set("User-Agent", "iNetSpeed-CLI")
+
+	resp, err := dohHTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "" && !strings.HasPrefix(ct, dnsMessageType) {
+		return nil, fmt.Errorf("unexpected content type %q", ct)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, dnsMaxMessage))
+}
+
+// exchangeUDP sends query as a single datagram and waits for the reply with
+// the same ID, ignoring stray packets. A truncated reply is retried over
+// TCP.
+func exchangeUDP(ctx context.Context, addr string, query []byte) ([]byte, error) {
+	conn, err := netOpts.DialContext(ctx, "udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	if _, err := conn.Write(query); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, dnsMaxMessage)
+	for {
+		n, err := conn.Read(buf)
+		if err != nil {
+			return nil, err
+		}
+		if n < 12 || buf[0] != query[0] || buf[1] != query[1] {
+			continue
+		}
+		if buf[2]&0x02 != 0 {
+			return exchangeStream(ctx, addr, query, nil)
+		}
+		return buf[:n], nil
+	}
+}
+
+// exchangeStream sends query over TCP, or over TLS when tlsConfig is set,
+// using the two-byte length framing of RFC 1035 section 4.2.2.
+func exchangeStream(ctx context.Context, addr string, query []byte, tlsConfig *tls.Config) ([]byte, error) {
+	var conn net.Conn
+	var err error
+	opts := metadataOptions()
+	if tlsConfig != nil {
+		if conn, err = opts.DialPurpose(ctx, "tcp", addr); err == nil {
+			tlsConn := tls.Client(conn, opts.ConfigureTLS(tlsConfig))
+			if err = tlsConn.HandshakeContext(ctx); err != nil {
+				conn.Close()
+			}
+			conn = tlsConn
+		}
+	} else {
+		conn, err = opts.DialPurpose(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	framed := make([]byte, 2+len(query))
+	binary.BigEndian.PutUint16(framed, uint16(len(query)))
+	copy(framed[2:], query)
+	if _, err := conn.Write(framed); err != nil {
+		return nil, err
+	}
+	var length [2]byte
+	if _, err := io.ReadFull(conn, length[:]); err != nil {
+		return nil, err
+	}
+	reply := make([]byte, binary.BigEndian.Uint16(length[:]))
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+func buildDNSQuery(host string, qtype dnsmessage.Type, id uint16, subnet netip.Prefix) ([]byte, error) {
+	name, err := dnsmessage.NewName(dnsFQDN(host))
+	if err != nil {
+		return nil, err
+	}
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	if subnet.IsValid() {
+		opt, err := ecsOPT(subnet)
+		if err != nil {
+			return nil, err
+		}
+		msg.Additionals = append(msg.Additionals, opt)
+	}
+	return msg.Pack()
+}
+
+// parseDNSAnswer returns the A and AAAA records in the answer section and
+// the EDNS Client Subnet scope the resolver echoed back, or -1 when it did
+// not echo the option. CNAME chains need no special handling because
+// recursive resolvers include the target's records in the same answer.
+func parseDNSAnswer(packet []byte, id uint16) ([]string, int, error) {
+	var p dnsmessage.Parser
+	header, err := p.Start(packet)
+	if err != nil {
+		return nil, -1, err
+	}
+	if header.ID != id || !header.Response {
+		return nil, -1, errors.New("DNS reply does not match query")
+	}
+	if header.RCode != dnsmessage.RCodeSuccess && header.RCode != dnsmessage.RCodeNameError {
+		return nil, -1, fmt.Errorf("DNS %s", header.RCode)
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil, -1, err
+	}
+	var out []string
+	for {
+		rh, err := p.AnswerHeader()
+		if errors.Is(err, dnsmessage.ErrSectionDone) {
+			break
+		}
+		if err != nil {
+			return out, -1, err
+		}
+		switch rh.Type {
+		case dnsmessage.TypeA:
+			r, err := p.AResource()
+			if err != nil {
+				return out, -1, err
+			}
+			out = append(out, netip.AddrFrom4(r.A).String())
+		case dnsmessage.TypeAAAA:
+			r, err := p.AAAAResource()
+			if err != nil {
+				return out, -1, err
+			}
+			out = append(out, netip.AddrFrom16(r.AAAA).String())
+		default:
+			if err := p.SkipAnswer(); err != nil {
+				return out, -1, err
+			}
+		}
+	}
+	return out, replyECSScope(&p), nil
+}
+
+func dnsFQDN(host string) string {
+	if strings.HasSuffix(host, ".") {
+		return host
+	}
+	return host + "."
+}
@@ -0,0 +1,230 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsReply answers query with the records in answers for its question type.
+func dnsReply(t *testing.T, query []byte, answers map[dnsmessage.Type][]string) []byte {
+	t.Helper()
+	var msg dnsmessage.Message
+	if err := msg.Unpack(query); err != nil {
+		t.Fatalf("unpack query: %v", err)
+	}
+	if len(msg.Questions) != 1 {
+		t.Fatalf("expected one question, got %d", len(msg.Questions))
+	}
+	q := msg.Questions[0]
+	msg.Header.Response = true
+	msg.Header.RecursionAvailable = true
+	for _, ip := range answers[q.Type] {
+		addr := netip.MustParseAddr(ip)
+		hdr := dnsmessage.ResourceHeader{Name: q.Name, Type: q.Type, Class: dnsmessage.ClassINET, TTL: 60}
+		if q.Type == dnsmessage.TypeA {
+			msg.Answers = append(msg.Answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.AResource{A: addr.As4()}})
+		} else {
+			msg.Answers = append(msg.Answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.AAAAResource{AAAA: addr.As16()}})
+		}
+	}
+	packet, err := msg.Pack()
+	if err != nil {
+		t.Fatalf("pack reply: %v", err)
+	}
+	return packet
+}
+
+func newWireDoHServer(t *testing.T, answers map[dnsmessage.Type][]string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept") != dnsMessageType {
+			t.Errorf("unexpected Accept %q", r.Header.Get("Accept"))
+		}
+		query, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("dns"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", dnsMessageType)
+		w.Write(dnsReply(t, query, answers))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestResolveWithResolversMergesInOrder(t *testing.T) {
+	first := newWireDoHServer(t, map[dnsmessage.Type][]string{
+		dnsmessage.TypeA:    {"17.253.85.205"},
+		dnsmessage.TypeAAAA: {"2403:300:a0c:f000::1"},
+	})
+	second := newWireDoHServer(t, map[dnsmessage.Type][]string{
+		dnsmessage.TypeA: {"17.253.85.205", "17.253.85.206"},
+	})
+
+	ips, timedOut := resolveWithResolvers(context.Background(), "mensura.cdn-apple.com", []string{first.URL + "/dns-query", second.URL + "/dns-query"}, netip.Prefix{})
+	if timedOut {
+		t.Fatal("did not expect a timeout")
+	}
+	want := []string{"17.253.85.205", "2403:300:a0c:f000::1", "17.253.85.206"}
+	if !reflect.DeepEqual(ips, want) {
+		t.Fatalf("ips = %v, want %v", ips, want)
+	}
+}
+
+func TestResolveWithResolversAllTimedOut(t *testing.T) {
+	oldTimeout := dohTimeout
+	dohTimeout = 50 * time.Millisecond
+	t.Cleanup(func() { dohTimeout = oldTimeout })
+
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(srv.Close)
+	t.Cleanup(func() { close(release) })
+
+	ips, timedOut := resolveWithResolvers(context.Background(), "example.com", []string{srv.URL}, netip.Prefix{})
+	if len(ips) != 0 || !timedOut {
+		t.Fatalf("expected timeout with no IPs, got ips=%v timedOut=%t", ips, timedOut)
+	}
+}
+
+// startDNSServers serves answers over TCP and, on the same port, over UDP.
+// With truncate set the UDP side only returns empty replies with the TC bit
+// so clients must retry over TCP.
+func startDNSServers(t *testing.T, answers map[dnsmessage.Type][]string, truncate bool) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	pc, err := net.ListenPacket("udp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { pc.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var length [2]byte
+				if _, err := io.ReadFull(conn, length[:]); err != nil {
+					return
+				}
+				query := make([]byte, binary.BigEndian.Uint16(length[:]))
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+				reply := dnsReply(t, query, answers)
+				conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(reply))), reply...))
+			}()
+		}
+	}()
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if truncate {
+				reply := dnsReply(t, buf[:n], nil)
+				reply[2] |= 0x02
+				pc.WriteTo(reply, addr)
+				continue
+			}
+			pc.WriteTo(dnsReply(t, buf[:n], answers), addr)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func TestResolveWithResolversPlainDNS(t *testing.T) {
+	answers := map[dnsmessage.Type][]string{
+		dnsmessage.TypeA:    {"17.253.85.205"},
+		dnsmessage.TypeAAAA: {"2403:300:a0c:f000::1"},
+	}
+	want := []string{"17.253.85.205", "2403:300:a0c:f000::1"}
+
+	udp := startDNSServers(t, answers, false)
+	truncated := startDNSServers(t, answers, true)
+	for _, spec := range []string{"udp://" + udp, "tcp://" + udp, "udp://" + truncated} {
+		ips, timedOut := resolveWithResolvers(context.Background(), "mensura.cdn-apple.com", []string{spec}, netip.Prefix{})
+		if timedOut || !reflect.DeepEqual(ips, want) {
+			t.Fatalf("%s: ips=%v timedOut=%t, want %v", spec, ips, timedOut, want)
+		}
+	}
+}
+
+func TestQueryResolverUnsupportedScheme(t *testing.T) {
+	res := queryResolver(context.Background(), "quic://dns.example.com", "example.com", dnsmessage.TypeA, netip.Prefix{})
+	if res.err == nil || res.timedOut {
+		t.Fatalf("expected an error for an unsupported scheme, got %+v", res)
+	}
+}
+
+func TestParseDNSAnswerRejectsServerFailure(t *testing.T) {
+	msg := dnsmessage.Message{Header: dnsmessage.Header{Response: true, RCode: dnsmessage.RCodeServerFailure}}
+	packet, err := msg.Pack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := parseDNSAnswer(packet, 0); err == nil {
+		t.Fatal("expected SERVFAIL to be an error")
+	}
+}
+
+func TestDiscoverUsesConfiguredResolvers(t *testing.T) {
+	oldDoH := resolveDoHFn
+	oldResolvers := resolveResolversFn
+	oldProbe := probeEndpointFn
+	t.Cleanup(func() {
+		resolveDoHFn = oldDoH
+		resolveResolversFn = oldResolvers
+		probeEndpointFn = oldProbe
+	})
+
+	resolveDoHFn = func(context.Context, string) ([]string, bool, bool) {
+		t.Fatal("built-in DoH should not be used when resolvers are configured")
+		return nil, false, false
+	}
+	var gotResolvers []string
+	resolveResolversFn = func(_ context.Context, _ string, resolvers []string, _ netip.Prefix) ([]string, bool) {
+		gotResolvers = resolvers
+		return []string{"9.9.9.9"}, false
+	}
+	probeEndpointFn = func(context.Context, string, string, string) ([]float64, int, error) {
+		return []float64{10}, 1, nil
+	}
+
+	res := Discover(context.Background(), "example.com", DiscoveryOptions{
+		ProbeURL:  "https://example.com/probe",
+		Resolvers: []string{"https://dns.quad9.net/dns-query"},
+	})
+	if !reflect.DeepEqual(gotResolvers, []string{"https://dns.quad9.net/dns-query"}) {
+		t.Fatalf("resolvers = %v", gotResolvers)
+	}
+	if res.Selected.IP != "9.9.9.9" || res.Selected.Source != "doh" {
+		t.Fatalf("unexpected selection %+v", res.Selected)
+	}
+}
@@ -0,0 +1,140 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/i18n"
+)
+
+// discoveryCache remembers the last DNS discovery per host and discovery
+// settings so that Discover can keep measuring the same endpoint across
+// runs: while the entry is younger than ttl and its endpoint still probes
+// healthy, DNS discovery is skipped.
+type discoveryCache struct {
+	path string
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]discoveryEntry
+}
+
+type discoveryEntry struct {
+	Result       DiscoveryResult `json:"result"`
+	DiscoveredAt time.Time       `json:"discovered_at"`
+	// ReusedAt is when a later run last kept the selected endpoint.
+	ReusedAt time.Time `json:"reused_at,omitzero"`
+}
+
+type discoveryFile struct {
+	Entries map[string]discoveryEntry `json:"entries"`
+}
+
+var discCache atomic.Pointer[discoveryCache]
+
+// SetDiscoveryCache keeps discovery results in the file at path and lets
+// Discover reuse a selected endpoint for ttl when DiscoveryOptions.Sticky
+// is set. An empty path keeps results in memory only; a ttl of 0 turns
+// reuse off.
+func SetDiscoveryCache(path string, ttl time.Duration) {
+	if ttl <= 0 {
+		discCache.Store(nil)
+		return
+	}
+	c := &discoveryCache{path: path, ttl: ttl, entries: map[string]discoveryEntry{}}
+	if path != "" {
+		if data, err := os.ReadFile(path); err == nil {
+			var f discoveryFile
+			if json.Unmarshal(data, &f) == nil && f.Entries != nil {
+				c.entries = f.Entries
+			}
+		}
+	}
+	discCache.Store(c)
+}
+
+// discoveryKey identifies the settings a discovery depends on, so that a
+// run with another probe URL, resolvers, family, rules or metadata setting
+// does not reuse its endpoint.
+func discoveryKey(host string, opts DiscoveryOptions) string {
+	return fmt.Sprintf("%s|%s|%d|%s|%s|%v|%v|%t", host, opts.ProbeURL, opts.Family, strings.Join(opts.Resolvers, ","), opts.ClientSubnet, opts.Prefer, opts.Exclude, opts.Metadata)
+}
+
+// stickyDiscovery re-probes the endpoint an earlier run selected for host
+// and returns it as the result when it is still healthy. It reports false
+// when there is no fresh entry or the endpoint failed, after which the
+// caller runs discovery again; a failure is explained by the warning in
+// the returned result.
+func stickyDiscovery(ctx context.Context, host string, opts DiscoveryOptions) (DiscoveryResult, bool) {
+	c := discCache.Load()
+	if c == nil || !opts.Sticky {
+		return DiscoveryResult{}, false
+	}
+	key := discoveryKey(host, opts)
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	now := nowFn()
+	if !ok || entry.Result.Selected.IP == "" || now.Sub(entry.DiscoveredAt) >= c.ttl {
+		return DiscoveryResult{}, false
+	}
+
+	ip := entry.Result.Selected.IP
+	candidate := buildCandidate(ctx, host, ip, "doh", opts)
+	if candidate.Status != "ok" {
+		return DiscoveryResult{Warnings: []Warning{{
+			Code: "sticky_endpoint_failed",
+			Message: fmt.Sprintf(i18n.Text("Previously selected endpoint %s is no longer usable; discovering endpoints again.",
+				"上次选择的节点 %s 已不可用，重新发现节点。"), ip),
+		}}}, false
+	}
+	candidate.Source = "cache"
+
+	c.mu.Lock()
+	entry.ReusedAt = now
+	c.entries[key] = entry
+	c.mu.Unlock()
+	c.save()
+
+	return DiscoveryResult{
+		Host:         host,
+		Candidates:   []Candidate{candidate},
+		Selected:     endpointFromCandidate(candidate),
+		Cached:       true,
+		DiscoveredAt: entry.DiscoveredAt,
+	}, true
+}
+
+// rememberDiscovery stores a discovery that pinned an endpoint.
+func rememberDiscovery(host string, opts DiscoveryOptions, res DiscoveryResult) {
+	c := discCache.Load()
+	if c == nil || !opts.Sticky || res.DefaultDNS || res.Selected.IP == "" {
+		return
+	}
+	c.mu.Lock()
+	c.entries[discoveryKey(host, opts)] = discoveryEntry{Result: res, DiscoveredAt: nowFn()}
+	c.mu.Unlock()
+	c.save()
+}
+
+// save writes the cache to disk, dropping expired entries.
+func (c *discoveryCache) save() {
+	if c.path == "" {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := nowFn()
+	for key, e := range c.entries {
+		if now.Sub(e.DiscoveredAt) >= c.ttl {
+			delete(c.entries, key)
+		}
+	}
+	writeJSONAtomic(c.path, discoveryFile{Entries: c.entries})
+}
@@ -0,0 +1,188 @@
+package exporter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/config"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/i18n"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/netx"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/output"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/render"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/runner"
+)
+
+var runFn = runner.Run
+
+// Exporter serves the result of the latest completed run on /metrics and
+// runs on demand for /probe. Runs are serialized so concurrent scrapes never
+// measure against each other.
+type Exporter struct {
+	cfg   *config.Config
+	opts  netx.Options
+	log   io.Writer
+	runMu sync.Mutex
+
+	mu       sync.Mutex
+	latest   *runner.RunResult
+	runs     int
+	failures int
+}
+
+func New(cfg *config.Config, opts netx.Options, log io.Writer) *Exporter {
+	return &Exporter{cfg: cfg, opts: opts, log: log}
+}
+
+func Serve(ctx context.Context, cfg *config.Config, opts netx.Options) error {
+	e := New(cfg, opts, os.Stderr)
+	srv := &http.Server{
+		Addr:              cfg.Listen,
+		Handler:           e.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	ln, err := net.Listen("tcp", cfg.Listen)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.log, "  [+] %s %s\n", i18n.Text("Exporter listening on", "Exporter 监听于"), ln.Addr())
+
+	if cfg.Interval > 0 {
+		go e.schedule(ctx, cfg.Interval)
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	if err := srv.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func (e *Exporter) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", e.handleMetrics)
+	mux.HandleFunc("/probe", e.handleProbe)
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		fmt.Fprint(w, `<html><head><title>iNetSpeed-CLI exporter</title></head><body>
+<h1>iNetSpeed-CLI exporter</h1>
+<p><a href="/metrics">Metrics</a></p>
+<p><a href="/probe">Probe</a> (optional <code>?target=ENDPOINT_IP</code>)</p>
+</body></html>
+`)
+	})
+	return mux
+}
+
+func (e *Exporter) schedule(ctx context.Context, interval time.Duration) {
+	for {
+		e.run(ctx, "")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (e *Exporter) run(ctx context.Context, target string) runner.RunResult {
+	e.runMu.Lock()
+	defer e.runMu.Unlock()
+
+	cfg := *e.cfg
+	cfg.NonInteractive = true
+	if target != "" {
+		cfg.EndpointIP = target
+	}
+	bus := render.NewBus(render.NewPlainRenderer(io.Discard))
+	result := runFn(ctx, &cfg, e.opts, bus, false)
+	bus.Close()
+
+	e.mu.Lock()
+	e.runs++
+	if result.ExitCode != 0 {
+		e.failures++
+	}
+	if result.ExitCode != 130 {
+		e.latest = &result
+	}
+	e.mu.Unlock()
+
+	for _, o := range cfg.Outputs {
+		if err := output.Write(&cfg, o, result); err != nil {
+			fmt.Fprintf(e.log, "  [!] %s: %s\n", o.Format, err)
+		}
+	}
+	fmt.Fprintf(e.log, "  [+] %s endpoint=%s exit_code=%d degraded=%t\n",
+		i18n.Text("Run complete:", "测速完成:"), result.SelectedEndpoint.IP, result.ExitCode, result.Degraded)
+	return result
+}
+
+func (e *Exporter) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	e.mu.Lock()
+	latest := e.latest
+	runs, failures := e.runs, e.failures
+	e.mu.Unlock()
+
+	enc := newEncoder(w, r)
+	writeExporterMetrics(enc, runs, failures)
+	if latest != nil {
+		enc.Result(*latest)
+	}
+	_ = enc.Close()
+}
+
+func (e *Exporter) handleProbe(w http.ResponseWriter, r *http.Request) {
+	target := strings.TrimSpace(r.URL.Query().Get("target"))
+	if target != "" && net.ParseIP(target) == nil {
+		http.Error(w, fmt.Sprintf("invalid target %q: must be an endpoint IP", target), http.StatusBadRequest)
+		return
+	}
+	result := e.run(r.Context(), target)
+
+	enc := newEncoder(w, r)
+	enc.Family("inetspeed_probe_success", "gauge", "Whether the probe run completed without degradation.")
+	enc.Sample("inetspeed_probe_success", nil, boolValue(result.ExitCode == 0))
+	enc.Result(result)
+	_ = enc.Close()
+}
+
+func writeExporterMetrics(enc *output.PromEncoder, runs, failures int) {
+	enc.Family("inetspeed_exporter_runs_total", "counter", "Runs started by this exporter.")
+	enc.Sample("inetspeed_exporter_runs_total", nil, float64(runs))
+	enc.Family("inetspeed_exporter_failed_runs_total", "counter", "Runs that exited non-zero.")
+	enc.Sample("inetspeed_exporter_failed_runs_total", nil, float64(failures))
+}
+
+func newEncoder(w http.ResponseWriter, r *http.Request) *output.PromEncoder {
+	openMetrics := strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text")
+	if openMetrics {
+		w.Header().Set("Content-Type", output.OpenMetricsContentType)
+	} else {
+		w.Header().Set("Content-Type", output.PromContentType)
+	}
+	return output.NewPromEncoder(w, openMetrics)
+}
+
+func boolValue(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,106 @@
+package exporter
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/config"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/netx"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/render"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/runner"
+)
+
+func stubRun(t *testing.T, fn func(cfg *config.Config) runner.RunResult) {
+	old := runFn
+	t.Cleanup(func() { runFn = old })
+	runFn = func(_ context.Context, cfg *config.Config, _ netx.Options, _ *render.Bus, _ bool) runner.RunResult {
+		return fn(cfg)
+	}
+}
+
+func get(t *testing.T, h http.Handler, target string, accept string) (*http.Response, string) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	resp := rec.Result()
+	body, _ := io.ReadAll(resp.Body)
+	return resp, string(body)
+}
+
+func TestMetricsBeforeFirstRun(t *testing.T) {
+	e := New(&config.Config{}, netx.Options{}, io.Discard)
+	_, body := get(t, e.Handler(), "/metrics", "")
+	if !strings.Contains(body, "inetspeed_exporter_runs_total 0") {
+		t.Fatalf("missing runs counter:\n%s", body)
+	}
+	if strings.Contains(body, "inetspeed_run_info") {
+		t.Fatalf("did not expect run metrics before first run:\n%s", body)
+	}
+}
+
+func TestProbeRunsWithTargetAndUpdatesMetrics(t *testing.T) {
+	var gotEndpoint string
+	var gotNonInteractive bool
+	stubRun(t, func(cfg *config.Config) runner.RunResult {
+		gotEndpoint = cfg.EndpointIP
+		gotNonInteractive = cfg.NonInteractive
+		return runner.RunResult{
+			SelectedEndpoint: runner.SelectedEndpoint{IP: cfg.EndpointIP, Status: "ok"},
+			Rounds:           []runner.RoundResult{{Direction: "download", Threads: 1, Status: "ok", Mbps: 50}},
+		}
+	})
+
+	e := New(&config.Config{EndpointIP: "9.9.9.9"}, netx.Options{}, io.Discard)
+	resp, body := get(t, e.Handler(), "/probe?target=1.2.3.4", "")
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	if gotEndpoint != "1.2.3.4" || !gotNonInteractive {
+		t.Fatalf("run config endpoint=%q non_interactive=%v", gotEndpoint, gotNonInteractive)
+	}
+	if !strings.Contains(body, "inetspeed_probe_success 1") {
+		t.Fatalf("missing probe_success:\n%s", body)
+	}
+	if e.cfg.EndpointIP != "9.9.9.9" {
+		t.Fatal("probe must not mutate the exporter config")
+	}
+
+	_, body = get(t, e.Handler(), "/metrics", "")
+	if !strings.Contains(body, `inetspeed_throughput_bits_per_second{direction="download",threads="1",endpoint="1.2.3.4",asn=""} 5e+07`) {
+		t.Fatalf("metrics missing latest run:\n%s", body)
+	}
+	if !strings.Contains(body, "inetspeed_exporter_runs_total 1") {
+		t.Fatalf("runs counter not incremented:\n%s", body)
+	}
+}
+
+func TestProbeRejectsInvalidTarget(t *testing.T) {
+	stubRun(t, func(cfg *config.Config) runner.RunResult {
+		t.Fatal("run must not start for an invalid target")
+		return runner.RunResult{}
+	})
+	e := New(&config.Config{}, netx.Options{}, io.Discard)
+	resp, _ := get(t, e.Handler(), "/probe?target=not-an-ip", "")
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status = %d, want 400", resp.StatusCode)
+	}
+}
+
+func TestMetricsOpenMetricsNegotiation(t *testing.T) {
+	e := New(&config.Config{}, netx.Options{}, io.Discard)
+	resp, body := get(t, e.Handler(), "/metrics", "application/openmetrics-text; version=1.0.0")
+	if !strings.HasPrefix(resp.Header.Get("Content-Type"), "application/openmetrics-text") {
+		t.Fatalf("Content-Type = %q", resp.Header.Get("Content-Type"))
+	}
+	if !strings.HasSuffix(body, "# EOF\n") {
+		t.Fatalf("OpenMetrics body must end with # EOF:\n%s", body)
+	}
+}
@@ -0,0 +1,41 @@
+// Package fsx holds file-system helpers shared by the output writers and
+// the on-disk caches.
+package fsx
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// WriteAtomic replaces the file at path with what write produces. The data
+// goes to a temporary file in the same directory, is synced, and is then
+// renamed into place, so readers such as the node_exporter textfile
+// collector or a concurrent run never see a partial file. On error the
+// original file is left untouched.
+func WriteAtomic(path string, write func(io.Writer) error) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if err := write(tmp); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpName, path)
+}
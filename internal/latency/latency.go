@@ -18,6 +18,8 @@ type Stats struct {
 	Max    float64
 	Jitter float64
 	N      int
+	// Samples holds the raw measurements in collection order.
+	Samples []float64
 }
 
 func MeasureIdle(ctx context.Context, client *http.Client, url string, n int) Stats {
@@ -72,6 +74,13 @@ func (p *Probe) loop() {
 	}
 }
 
+// Samples returns a copy of the samples collected so far.
+func (p *Probe) Samples() []float64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]float64(nil), p.samples...)
+}
+
 func (p *Probe) Stop() Stats {
 	p.cancel()
 	p.wg.Wait()
@@ -152,11 +161,12 @@ func Compute(samples []float64) Stats {
 	}
 
 	return Stats{
-		Min:    math.Round(min*100) / 100,
-		Avg:    math.Round(avg*100) / 100,
-		Median: math.Round(med*100) / 100,
-		Max:    math.Round(max*100) / 100,
-		Jitter: math.Round(jitter*100) / 100,
-		N:      n,
+		Min:     math.Round(min*100) / 100,
+		Avg:     math.Round(avg*100) / 100,
+		Median:  math.Round(med*100) / 100,
+		Max:     math.Round(max*100) / 100,
+		Jitter:  math.Round(jitter*100) / 100,
+		N:       n,
+		Samples: append([]float64(nil), samples...),
 	}
 }
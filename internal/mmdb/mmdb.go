@@ -0,0 +1,343 @@
+// Package mmdb reads MaxMind DB files, the format of the MaxMind GeoIP2 /
+// GeoLite2 and DB-IP databases. Records decode to map[string]any, []any,
+// string, float64, uint64, int64, *big.Int, bool or []byte values.
+package mmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"net/netip"
+	"os"
+)
+
+// metadataMarker precedes the metadata map at the end of the file.
+var metadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// maxDepth bounds nesting so a corrupt file cannot exhaust the stack.
+const maxDepth = 32
+
+var errCorrupt = errors.New("mmdb: corrupt data section")
+
+// Metadata describes a database.
+type Metadata struct {
+	DatabaseType string
+	Languages    []string
+	IPVersion    int
+	NodeCount    int
+	RecordSize   int
+	BuildEpoch   uint64
+}
+
+// Reader looks up records in a database held in memory.
+type Reader struct {
+	Metadata Metadata
+	tree     []byte
+	data     []byte
+	// ipv4Start is the node that IPv4 lookups start from: the node reached
+	// by following ::/96 in an IPv6 tree, or 0 in an IPv4 one.
+	ipv4Start int
+}
+
+// Open reads the database at path.
+func Open(path string) (*Reader, error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	r, err := New(buf)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return r, nil
+}
+
+// New parses a database from buf, which must not be modified afterwards.
+func New(buf []byte) (*Reader, error) {
+	at := bytes.LastIndex(buf, metadataMarker)
+	if at < 0 {
+		return nil, errors.New("mmdb: metadata marker not found")
+	}
+	raw, _, err := decoder{buf[at+len(metadataMarker):]}.decode(0, 0)
+	if err != nil {
+		return nil, err
+	}
+	fields, ok := raw.(map[string]any)
+	if !ok {
+		return nil, errors.New("mmdb: metadata is not a map")
+	}
+	md := Metadata{
+		DatabaseType: asString(fields["database_type"]),
+		IPVersion:    int(asUint(fields["ip_version"])),
+		NodeCount:    int(asUint(fields["node_count"])),
+		RecordSize:   int(asUint(fields["record_size"])),
+		BuildEpoch:   asUint(fields["build_epoch"]),
+	}
+	if langs, ok := fields["languages"].([]any); ok {
+		for _, l := range langs {
+			md.Languages = append(md.Languages, asString(l))
+		}
+	}
+	switch md.RecordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("mmdb: unsupported record size %d", md.RecordSize)
+	}
+	if md.IPVersion != 4 && md.IPVersion != 6 {
+		return nil, fmt.Errorf("mmdb: unsupported IP version %d", md.IPVersion)
+	}
+	treeSize := md.NodeCount * md.RecordSize / 4
+	if md.NodeCount <= 0 || treeSize+16 > at {
+		return nil, errors.New("mmdb: search tree exceeds file")
+	}
+	r := &Reader{
+		Metadata: md,
+		tree:     buf[:treeSize],
+		data:     buf[treeSize+16 : at],
+	}
+	if md.IPVersion == 6 {
+		node := 0
+		for i := 0; i < 96 && node < md.NodeCount; i++ {
+			node = r.record(node, 0)
+		}
+		r.ipv4Start = node
+	}
+	return r, nil
+}
+
+// Lookup returns the record for addr, or nil when the database has none.
+func (r *Reader) Lookup(addr netip.Addr) (any, error) {
+	addr = addr.Unmap()
+	if addr.Is6() && r.Metadata.IPVersion == 4 {
+		return nil, nil
+	}
+	node := 0
+	if addr.Is4() {
+		node = r.ipv4Start
+	}
+	ip := addr.AsSlice()
+	for i := 0; i < len(ip)*8 && node < r.Metadata.NodeCount; i++ {
+		bit := int(ip[i/8]>>(7-i%8)) & 1
+		node = r.record(node, bit)
+	}
+	switch {
+	case node == r.Metadata.NodeCount:
+		return nil, nil
+	case node < r.Metadata.NodeCount:
+		return nil, errors.New("mmdb: search tree deeper than the address")
+	}
+	offset := node - r.Metadata.NodeCount - 16
+	if offset < 0 || offset >= len(r.data) {
+		return nil, errCorrupt
+	}
+	v, _, err := decoder{r.data}.decode(offset, 0)
+	return v, err
+}
+
+// record returns the left (bit 0) or right (bit 1) record of node.
+func (r *Reader) record(node, bit int) int {
+	b := r.tree[node*r.Metadata.RecordSize/4:]
+	switch r.Metadata.RecordSize {
+	case 24:
+		b = b[bit*3:]
+		return int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+	case 28:
+		if bit == 0 {
+			return int(b[3]&0xf0)<<20 | int(b[0])<<16 | int(b[1])<<8 | int(b[2])
+		}
+		return int(b[3]&0x0f)<<24 | int(b[4])<<16 | int(b[5])<<8 | int(b[6])
+	}
+	return int(binary.BigEndian.Uint32(b[bit*4:]))
+}
+
+// decoder reads values from a data section; pointers are offsets into buf.
+type decoder struct {
+	buf []byte
+}
+
+const (
+	typePointer  = 1
+	typeString   = 2
+	typeDouble   = 3
+	typeBytes    = 4
+	typeUint16   = 5
+	typeUint32   = 6
+	typeMap      = 7
+	typeInt32    = 8
+	typeUint64   = 9
+	typeUint128  = 10
+	typeArray    = 11
+	typeBoolean  = 14
+	typeFloat    = 15
+	typeExtended = 0
+)
+
+// decode returns the value at offset and the offset just after it.
+func (d decoder) decode(offset, depth int) (any, int, error) {
+	if depth > maxDepth {
+		return nil, 0, errCorrupt
+	}
+	if offset >= len(d.buf) {
+		return nil, 0, errCorrupt
+	}
+	ctrl := d.buf[offset]
+	offset++
+	typ := int(ctrl >> 5)
+	if typ == typePointer {
+		target, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		v, _, err := d.decode(target, depth+1)
+		return v, next, err
+	}
+	if typ == typeExtended {
+		if offset >= len(d.buf) {
+			return nil, 0, errCorrupt
+		}
+		typ = 7 + int(d.buf[offset])
+		offset++
+	}
+	size, offset, err := d.size(ctrl, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	switch typ {
+	case typeMap:
+		m := make(map[string]any, min(size, 64))
+		for range size {
+			key, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, errCorrupt
+			}
+			v, next, err := d.decode(next, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[k] = v
+			offset = next
+		}
+		return m, offset, nil
+	case typeArray:
+		a := make([]any, 0, min(size, 64))
+		for range size {
+			v, next, err := d.decode(offset, depth+1)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, v)
+			offset = next
+		}
+		return a, offset, nil
+	case typeBoolean:
+		return size != 0, offset, nil
+	}
+
+	if offset+size > len(d.buf) {
+		return nil, 0, errCorrupt
+	}
+	b := d.buf[offset : offset+size]
+	next := offset + size
+	switch typ {
+	case typeString:
+		return string(b), next, nil
+	case typeBytes:
+		return bytes.Clone(b), next, nil
+	case typeDouble:
+		if size != 8 {
+			return nil, 0, errCorrupt
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), next, nil
+	case typeFloat:
+		if size != 4 {
+			return nil, 0, errCorrupt
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), next, nil
+	case typeUint16, typeUint32, typeUint64:
+		if size > 8 {
+			return nil, 0, errCorrupt
+		}
+		var v uint64
+		for _, c := range b {
+			v = v<<8 | uint64(c)
+		}
+		return v, next, nil
+	case typeUint128:
+		if size > 16 {
+			return nil, 0, errCorrupt
+		}
+		return new(big.Int).SetBytes(b), next, nil
+	case typeInt32:
+		if size > 4 {
+			return nil, 0, errCorrupt
+		}
+		var v uint32
+		for _, c := range b {
+			v = v<<8 | uint32(c)
+		}
+		return int64(int32(v)), next, nil
+	}
+	return nil, 0, fmt.Errorf("mmdb: unknown data type %d", typ)
+}
+
+// size reads the payload size that follows a control byte.
+func (d decoder) size(ctrl byte, offset int) (int, int, error) {
+	size := int(ctrl & 0x1f)
+	extra := max(size-28, 0)
+	if offset+extra > len(d.buf) {
+		return 0, 0, errCorrupt
+	}
+	b := d.buf[offset : offset+extra]
+	switch size {
+	case 29:
+		size = 29 + int(b[0])
+	case 30:
+		size = 285 + (int(b[0])<<8 | int(b[1]))
+	case 31:
+		size = 65821 + (int(b[0])<<16 | int(b[1])<<8 | int(b[2]))
+	}
+	return size, offset + extra, nil
+}
+
+// pointer reads the target of a pointer whose control byte is ctrl.
+func (d decoder) pointer(ctrl byte, offset int) (int, int, error) {
+	n := int(ctrl>>3)&3 + 1
+	if offset+n > len(d.buf) {
+		return 0, 0, errCorrupt
+	}
+	b := d.buf[offset : offset+n]
+	v := int(ctrl & 7)
+	var target int
+	switch n {
+	case 1:
+		target = v<<8 | int(b[0])
+	case 2:
+		target = (v<<16 | int(b[0])<<8 | int(b[1])) + 2048
+	case 3:
+		target = (v<<24 | int(b[0])<<16 | int(b[1])<<8 | int(b[2])) + 526336
+	case 4:
+		target = int(binary.BigEndian.Uint32(b))
+	}
+	if target >= len(d.buf) {
+		return 0, 0, errCorrupt
+	}
+	return target, offset + n, nil
+}
+
+func asString(v any) string {
+	s, _ := v.(string)
+	return s
+}
+
+func asUint(v any) uint64 {
+	u, _ := v.(uint64)
+	return u
+}
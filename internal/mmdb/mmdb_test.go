@@ -0,0 +1,229 @@
+package mmdb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net/netip"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// pointer makes encode emit a pointer to an offset in the data section.
+type pointer int
+
+// encode serialises v in the MaxMind DB data format.
+func encode(v any) []byte {
+	header := func(typ, size int) []byte {
+		var out []byte
+		sizeBits := size
+		var extra []byte
+		switch {
+		case size >= 285:
+			sizeBits = 30
+			extra = []byte{byte((size - 285) >> 8), byte(size - 285)}
+		case size >= 29:
+			sizeBits = 29
+			extra = []byte{byte(size - 29)}
+		}
+		if typ > 7 {
+			out = append(out, byte(sizeBits), byte(typ-7))
+		} else {
+			out = append(out, byte(typ<<5|sizeBits))
+		}
+		return append(out, extra...)
+	}
+	switch v := v.(type) {
+	case pointer:
+		if v < 2048 {
+			return []byte{1<<5 | byte(v>>8&7), byte(v)}
+		}
+		v -= 2048
+		return []byte{1<<5 | 1<<3 | byte(v>>16&7), byte(v >> 8), byte(v)}
+	case string:
+		return append(header(typeString, len(v)), v...)
+	case uint32:
+		b := binary.BigEndian.AppendUint32(nil, v)
+		b = bytes.TrimLeft(b, "\x00")
+		return append(header(typeUint32, len(b)), b...)
+	case float64:
+		return binary.BigEndian.AppendUint64(header(typeDouble, 8), math.Float64bits(v))
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		return header(typeBoolean, size)
+	case []any:
+		out := header(typeArray, len(v))
+		for _, item := range v {
+			out = append(out, encode(item)...)
+		}
+		return out
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		out := header(typeMap, len(v))
+		for _, k := range keys {
+			out = append(out, encode(k)...)
+			out = append(out, encode(v[k])...)
+		}
+		return out
+	}
+	panic("encode: unsupported type")
+}
+
+// buildDB writes an IPv6 database mapping each prefix to the data section
+// value at its offset. IPv4 prefixes go under ::/96.
+func buildDB(t *testing.T, recordSize int, data []byte, prefixes map[string]int) []byte {
+	t.Helper()
+	type rec struct {
+		node   int // index of the child node, or -1
+		offset int // data offset, or -1 for an empty record
+	}
+	nodes := [][2]rec{{{-1, -1}, {-1, -1}}}
+	for s, offset := range prefixes {
+		p := netip.MustParsePrefix(s)
+		bits := p.Bits()
+		ip := p.Addr().As16()
+		if p.Addr().Is4() {
+			bits += 96
+			ip = [16]byte{}
+			a4 := p.Addr().As4()
+			copy(ip[12:], a4[:])
+		}
+		node := 0
+		for i := 0; i < bits; i++ {
+			bit := int(ip[i/8]>>(7-i%8)) & 1
+			if i == bits-1 {
+				nodes[node][bit] = rec{-1, offset}
+				break
+			}
+			if nodes[node][bit].node < 0 {
+				nodes = append(nodes, [2]rec{{-1, -1}, {-1, -1}})
+				nodes[node][bit] = rec{len(nodes) - 1, -1}
+			}
+			node = nodes[node][bit].node
+		}
+	}
+
+	count := len(nodes)
+	value := func(r rec) int {
+		switch {
+		case r.node >= 0:
+			return r.node
+		case r.offset >= 0:
+			return count + 16 + r.offset
+		}
+		return count
+	}
+	var tree []byte
+	for _, n := range nodes {
+		l, r := value(n[0]), value(n[1])
+		switch recordSize {
+		case 24:
+			tree = append(tree, byte(l>>16), byte(l>>8), byte(l), byte(r>>16), byte(r>>8), byte(r))
+		case 28:
+			tree = append(tree, byte(l>>16), byte(l>>8), byte(l), byte(l>>24&0x0f)<<4|byte(r>>24&0x0f), byte(r>>16), byte(r>>8), byte(r))
+		case 32:
+			tree = binary.BigEndian.AppendUint32(tree, uint32(l))
+			tree = binary.BigEndian.AppendUint32(tree, uint32(r))
+		}
+	}
+
+	out := append(tree, make([]byte, 16)...)
+	out = append(out, data...)
+	out = append(out, metadataMarker...)
+	return append(out, encode(map[string]any{
+		"binary_format_major_version": uint32(2),
+		"database_type":               "Test-City",
+		"ip_version":                  uint32(6),
+		"languages":                   []any{"en", "zh-CN"},
+		"node_count":                  uint32(count),
+		"record_size":                 uint32(recordSize),
+		"build_epoch":                 uint32(1700000000),
+	})...)
+}
+
+func testData() (data []byte, offsets []int) {
+	au := encode(map[string]any{
+		"country":                  map[string]any{"iso_code": "AU", "names": map[string]any{"en": "Australia", "zh-CN": "澳大利亚"}},
+		"autonomous_system_number": uint32(13335),
+		"location":                 map[string]any{"latitude": -33.5, "accuracy_radius": uint32(1000)},
+		"is_anycast":               true,
+		"note":                     strings.Repeat("x", 300),
+	})
+	// The second record reuses the first's country map through a pointer.
+	countryAt := bytes.Index(au, encode(map[string]any{"iso_code": "AU", "names": map[string]any{"en": "Australia", "zh-CN": "澳大利亚"}}))
+	doc := encode(map[string]any{"country": pointer(countryAt), "autonomous_system_organization": "Documentation"})
+	return append(au, doc...), []int{0, len(au)}
+}
+
+func TestLookup(t *testing.T) {
+	data, offsets := testData()
+	for _, size := range []int{24, 28, 32} {
+		db, err := New(buildDB(t, size, data, map[string]int{
+			"1.2.3.0/24":    offsets[0],
+			"2001:db8::/32": offsets[1],
+		}))
+		if err != nil {
+			t.Fatalf("record size %d: %v", size, err)
+		}
+		if db.Metadata.DatabaseType != "Test-City" || db.Metadata.IPVersion != 6 || db.Metadata.RecordSize != size ||
+			!reflect.DeepEqual(db.Metadata.Languages, []string{"en", "zh-CN"}) {
+			t.Fatalf("record size %d: metadata %+v", size, db.Metadata)
+		}
+
+		for _, ip := range []string{"1.2.3.4", "::ffff:1.2.3.255"} {
+			v, err := db.Lookup(netip.MustParseAddr(ip))
+			if err != nil {
+				t.Fatalf("Lookup(%s): %v", ip, err)
+			}
+			m, _ := v.(map[string]any)
+			country, _ := m["country"].(map[string]any)
+			location, _ := m["location"].(map[string]any)
+			if m["autonomous_system_number"] != uint64(13335) || country["iso_code"] != "AU" || location["latitude"] != -33.5 ||
+				m["is_anycast"] != true || len(m["note"].(string)) != 300 {
+				t.Fatalf("record size %d: Lookup(%s) = %v", size, ip, v)
+			}
+		}
+
+		v, err := db.Lookup(netip.MustParseAddr("2001:db8:1::1"))
+		m, _ := v.(map[string]any)
+		country, _ := m["country"].(map[string]any)
+		if err != nil || m["autonomous_system_organization"] != "Documentation" || country["iso_code"] != "AU" {
+			t.Fatalf("record size %d: Lookup(2001:db8:1::1) = %v, %v", size, v, err)
+		}
+
+		for _, ip := range []string{"1.2.4.1", "2001:db9::1", "8.8.8.8"} {
+			if v, err := db.Lookup(netip.MustParseAddr(ip)); v != nil || err != nil {
+				t.Fatalf("record size %d: Lookup(%s) = %v, %v; want no record", size, ip, v, err)
+			}
+		}
+	}
+}
+
+func TestCorruptDatabase(t *testing.T) {
+	data, offsets := testData()
+	db := buildDB(t, 24, data, map[string]int{"1.2.3.0/24": offsets[0]})
+	if _, err := New(db[:len(db)-len(metadataMarker)-40]); err == nil {
+		t.Fatal("expected an error without metadata")
+	}
+	// Damage every byte of the data section in turn: lookups may fail but
+	// must not panic.
+	at := bytes.LastIndex(db, metadataMarker)
+	for i := at - len(data); i < at; i++ {
+		broken := bytes.Clone(db)
+		broken[i] = 0xff
+		r, err := New(broken)
+		if err != nil {
+			continue
+		}
+		r.Lookup(netip.MustParseAddr("1.2.3.4"))
+	}
+}
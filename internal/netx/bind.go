@@ -0,0 +1,119 @@
+package netx
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// Bind selects the local side of outgoing connections. Interface binds
+// sockets to a network device and Source to a local address; either may be
+// empty.
+type Bind struct {
+	Interface string
+	Source    string
+}
+
+// Dialer returns a dialer for a connection to addr over network ("tcp",
+// "udp" and their 4/6 variants) that honours o.Bind.
+func (o Options) Dialer(network, addr string) (*net.Dialer, error) {
+	d := &net.Dialer{
+		Timeout:   10 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	b := o.Bind
+	if b == (Bind{}) {
+		return d, nil
+	}
+
+	source := b.Source
+	if b.Interface != "" {
+		if bindsDevice {
+			d.Control = deviceControl(b.Interface)
+		} else if source == "" {
+			ip, err := interfaceAddr(b.Interface, wantIPv6(network, addr))
+			if err != nil {
+				return nil, err
+			}
+			source = ip.String()
+		}
+	}
+	if source != "" {
+		ip := net.ParseIP(source)
+		if strings.HasPrefix(network, "udp") {
+			d.LocalAddr = &net.UDPAddr{IP: ip}
+		} else {
+			d.LocalAddr = &net.TCPAddr{IP: ip}
+		}
+	}
+	d.Resolver = o.Resolver()
+	return d, nil
+}
+
+// Resolver returns the resolver for system DNS lookups. With a Bind in
+// effect it is the pure Go resolver so that its queries leave through the
+// same interface.
+func (o Options) Resolver() *net.Resolver {
+	if o.Bind == (Bind{}) {
+		return net.DefaultResolver
+	}
+	return &net.Resolver{PreferGo: true, Dial: o.DialContext}
+}
+
+// DialContext dials addr through Dialer, bypassing any proxy.
+func (o Options) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	d, err := o.Dialer(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	return d.DialContext(ctx, network, addr)
+}
+
+// wantIPv6 reports whether a connection to addr over network uses IPv6.
+// Host names are assumed to be reached over IPv4 unless network says
+// otherwise.
+func wantIPv6(network, addr string) bool {
+	if strings.HasSuffix(network, "6") {
+		return true
+	}
+	if strings.HasSuffix(network, "4") {
+		return false
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+	ip, err := netip.ParseAddr(host)
+	return err == nil && !ip.Unmap().Is4()
+}
+
+// interfaceAddr picks the first global address of the given family on the
+// named interface, for systems that cannot bind a socket to a device.
+func interfaceAddr(name string, ipv6 bool) (netip.Addr, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	for _, a := range addrs {
+		prefix, err := netip.ParsePrefix(a.String())
+		if err != nil {
+			continue
+		}
+		ip := prefix.Addr().Unmap()
+		if ip.Is4() != ipv6 && !ip.IsLinkLocalUnicast() {
+			return ip, nil
+		}
+	}
+	family := 4
+	if ipv6 {
+		family = 6
+	}
+	return netip.Addr{}, fmt.Errorf("interface %s has no IPv%d address", name, family)
+}
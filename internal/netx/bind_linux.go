@@ -0,0 +1,22 @@
+//go:build linux
+
+package netx
+
+import "syscall"
+
+const bindsDevice = true
+
+// deviceControl binds the socket to the named device with SO_BINDTODEVICE,
+// so traffic leaves through it regardless of the routing table.
+func deviceControl(name string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			sockErr = syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, name)
+		})
+		if err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
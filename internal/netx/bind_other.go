@@ -0,0 +1,13 @@
+//go:build !linux
+
+package netx
+
+import "syscall"
+
+// bindsDevice is false where SO_BINDTODEVICE is unavailable; --interface
+// then binds to the interface's address instead.
+const bindsDevice = false
+
+func deviceControl(string) func(network, address string, c syscall.RawConn) error {
+	return nil
+}
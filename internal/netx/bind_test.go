@@ -0,0 +1,131 @@
+package netx
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestDialContextBindsSource(t *testing.T) {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	accepted := make(chan net.Addr, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		accepted <- conn.RemoteAddr()
+		conn.Close()
+	}()
+
+	opts := Options{Bind: Bind{Source: "127.0.0.1"}}
+	d, err := opts.Dialer("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	local, ok := d.LocalAddr.(*net.TCPAddr)
+	if !ok || !local.IP.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Fatalf("expected dialer bound to 127.0.0.1, got %v", d.LocalAddr)
+	}
+	if d.Resolver == net.DefaultResolver {
+		t.Fatal("expected a bound resolver with --source in effect")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := opts.DialContext(ctx, "tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if ip := conn.LocalAddr().(*net.TCPAddr).IP; !ip.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Fatalf("expected local address 127.0.0.1, got %v", conn.LocalAddr())
+	}
+	select {
+	case remote := <-accepted:
+		if remote.String() != conn.LocalAddr().String() {
+			t.Fatalf("server saw %v, client dialed from %v", remote, conn.LocalAddr())
+		}
+	case <-ctx.Done():
+		t.Fatal("listener never accepted the connection")
+	}
+
+	udp, err := opts.Dialer("udp", "127.0.0.1:53")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := udp.LocalAddr.(*net.UDPAddr); !ok {
+		t.Fatalf("expected a UDP local address for udp, got %T", udp.LocalAddr)
+	}
+}
+
+func TestDialerWithoutBind(t *testing.T) {
+	d, err := Options{}.Dialer("tcp", "127.0.0.1:80")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.LocalAddr != nil || d.Control != nil {
+		t.Fatalf("expected an unbound dialer, got local %v", d.LocalAddr)
+	}
+	if (Options{}).Resolver() != net.DefaultResolver {
+		t.Fatal("expected the default resolver without a bind")
+	}
+}
+
+func TestWantIPv6(t *testing.T) {
+	tests := []struct {
+		network, addr string
+		want          bool
+	}{
+		{"tcp", "192.0.2.1:443", false},
+		{"tcp", "[2001:db8::1]:443", true},
+		{"tcp", "[::ffff:192.0.2.1]:443", false},
+		{"tcp", "example.com:443", false},
+		{"tcp6", "example.com:443", true},
+		{"tcp4", "[2001:db8::1]:443", false},
+		{"udp", "2001:db8::1", true},
+	}
+	for _, tt := range tests {
+		if got := wantIPv6(tt.network, tt.addr); got != tt.want {
+			t.Errorf("wantIPv6(%q, %q) = %v, want %v", tt.network, tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestInterfaceAddr(t *testing.T) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Skip(err)
+	}
+	var lo *net.Interface
+	for i := range ifaces {
+		if ifaces[i].Flags&net.FlagLoopback != 0 {
+			lo = &ifaces[i]
+			break
+		}
+	}
+	if lo == nil {
+		t.Skip("no loopback interface")
+	}
+
+	ip, err := interfaceAddr(lo.Name, false)
+	if err != nil {
+		t.Fatalf("interfaceAddr(%s, IPv4): %v", lo.Name, err)
+	}
+	if !ip.Is4() || !ip.IsLoopback() {
+		t.Fatalf("expected an IPv4 loopback address on %s, got %v", lo.Name, ip)
+	}
+	if ip, err := interfaceAddr(lo.Name, true); err == nil && ip != netip.IPv6Loopback() {
+		t.Fatalf("expected ::1 as the IPv6 address of %s, got %v", lo.Name, ip)
+	}
+
+	if _, err := interfaceAddr("no-such-interface0", false); err == nil {
+		t.Fatal("expected an error for a missing interface")
+	}
+}
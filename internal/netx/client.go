@@ -14,17 +14,29 @@ type Options struct {
 	PinHost string
 	PinIP   string
 	Timeout time.Duration
+	// Network restricts dialing to "tcp4" or "tcp6"; empty allows both.
+	Network string
+	Purpose Purpose
+	// Tracker, when set, records the connections behind each request.
+	Tracker *ConnTracker
+
+	// Bind, Proxies and TLS apply to every connection; DSCP and Socket
+	// only to Measurement ones.
+	Bind    Bind
+	Proxies Proxies
+	// TLS, when set, is a template from LoadTLS whose settings override
+	// the defaults.
+	TLS *tls.Config
+	// DSCP is the code point (1-63) to mark connections with in IP_TOS or
+	// IPV6_TCLASS; 0 leaves them unmarked.
+	DSCP   int
+	Socket SocketOptions
 }
 
 func NewClient(opts Options) *http.Client {
-	dialer := &net.Dialer{
-		Timeout:   10 * time.Second,
-		KeepAlive: 30 * time.Second,
-	}
-
-	tlsCfg := &tls.Config{
+	tlsCfg := opts.ConfigureTLS(&tls.Config{
 		MinVersion: tls.VersionTLS12,
-	}
+	})
 	if opts.PinHost != "" {
 		tlsCfg.ServerName = opts.PinHost
 	}
@@ -37,23 +49,24 @@ func NewClient(opts Options) *http.Client {
 		IdleConnTimeout:     90 * time.Second,
 	}
 
-	if opts.PinHost != "" && opts.PinIP != "" {
-		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
-			host, port, err := net.SplitHostPort(addr)
-			if err != nil {
-				return dialer.DialContext(ctx, network, addr)
-			}
-			if host == opts.PinHost {
-				addr = net.JoinHostPort(opts.PinIP, port)
-			}
-			return dialer.DialContext(ctx, network, addr)
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if opts.Network != "" {
+			network = opts.Network
+		}
+		if host, port, err := net.SplitHostPort(addr); err == nil && opts.PinIP != "" && host == opts.PinHost {
+			addr = net.JoinHostPort(opts.PinIP, port)
 		}
+		return opts.DialPurpose(ctx, network, addr)
 	}
 
 	_ = http2.ConfigureTransport(transport)
 
+	var rt http.RoundTripper = transport
+	if opts.Tracker != nil {
+		rt = &trackingTransport{base: transport, tracker: opts.Tracker}
+	}
 	return &http.Client{
-		Transport: transport,
+		Transport: rt,
 		Timeout:   opts.Timeout,
 	}
 }
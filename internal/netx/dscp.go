@@ -0,0 +1,66 @@
+package netx
+
+import (
+	"context"
+	"net"
+	"syscall"
+)
+
+// MarksDSCP reports whether Options.DSCP has any effect on this platform.
+func MarksDSCP() bool {
+	return marksDSCP
+}
+
+// dialerFor returns Dialer with the socket options that apply to o.Purpose
+// added.
+func (o Options) dialerFor(network, addr string) (*net.Dialer, error) {
+	d, err := o.Dialer(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if o.Purpose != Measurement {
+		return d, nil
+	}
+	if o.DSCP > 0 {
+		d.Control = chainControl(d.Control, tosControl(o.DSCP<<2))
+	}
+	applySocketOptions(d, o.Socket)
+	return d, nil
+}
+
+// dialPurpose dials addr directly with the socket options of o.Purpose.
+func (o Options) dialPurpose(ctx context.Context, network, addr string) (net.Conn, error) {
+	d, err := o.dialerFor(network, addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		return nil, err
+	}
+	if o.Purpose == Measurement {
+		if err := applyNoDelay(conn, o.Socket); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return conn, nil
+}
+
+type controlFunc = func(network, address string, c syscall.RawConn) error
+
+// chainControl runs both socket control functions; either may be nil.
+func chainControl(first, second controlFunc) controlFunc {
+	if first == nil {
+		return second
+	}
+	if second == nil {
+		return first
+	}
+	return func(network, address string, c syscall.RawConn) error {
+		if err := first(network, address, c); err != nil {
+			return err
+		}
+		return second(network, address, c)
+	}
+}
@@ -0,0 +1,29 @@
+//go:build !windows
+
+package netx
+
+import (
+	"strings"
+	"syscall"
+)
+
+const marksDSCP = true
+
+// tosControl sets the traffic class byte, IP_TOS on IPv4 sockets and
+// IPV6_TCLASS on IPv6 ones.
+func tosControl(tos int) controlFunc {
+	return func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			if strings.HasSuffix(network, "6") {
+				sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IPV6, syscall.IPV6_TCLASS, tos)
+			} else {
+				sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS, tos)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
@@ -0,0 +1,58 @@
+//go:build !windows
+
+package netx
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// dialedTOS dials a loopback listener with opts and returns the IP_TOS
+// byte the kernel reports for the socket.
+func dialedTOS(t *testing.T, opts Options) int {
+	t.Helper()
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := opts.DialPurpose(ctx, "tcp4", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	raw, err := conn.(*net.TCPConn).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tos int
+	var sockErr error
+	if err := raw.Control(func(fd uintptr) {
+		tos, sockErr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_IP, syscall.IP_TOS)
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if sockErr != nil {
+		t.Fatal(sockErr)
+	}
+	return tos
+}
+
+func TestDSCPMarksMeasurementSockets(t *testing.T) {
+	// EF (46) in the upper six bits of the TOS byte.
+	if tos := dialedTOS(t, Options{Purpose: Measurement, DSCP: 46}); tos != 46<<2 {
+		t.Fatalf("expected IP_TOS %#x on a measurement socket, got %#x", 46<<2, tos)
+	}
+	if tos := dialedTOS(t, Options{Purpose: Metadata, DSCP: 46}); tos != 0 {
+		t.Fatalf("expected metadata sockets to stay unmarked, got IP_TOS %#x", tos)
+	}
+	if tos := dialedTOS(t, Options{Purpose: Measurement}); tos != 0 {
+		t.Fatalf("expected no marking without DSCP, got IP_TOS %#x", tos)
+	}
+}
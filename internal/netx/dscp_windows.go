@@ -0,0 +1,11 @@
+//go:build windows
+
+package netx
+
+// marksDSCP is false on Windows, which ignores IP_TOS from applications
+// and only marks traffic through QoS policies.
+const marksDSCP = false
+
+func tosControl(int) controlFunc {
+	return nil
+}
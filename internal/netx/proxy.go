@@ -0,0 +1,171 @@
+package netx
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/net/proxy"
+)
+
+// Purpose tells which proxy setting applies to a client's connections.
+type Purpose int
+
+const (
+	// Measurement covers endpoint probes, latency and transfer traffic.
+	Measurement Purpose = iota
+	// Metadata covers DoH and DNS discovery queries and IP metadata lookups.
+	Metadata
+)
+
+// Proxies holds the proxy for each Purpose; nil means a direct connection.
+// Supported schemes are http and https (HTTP CONNECT) and socks5 and
+// socks5h, each with optional user:password credentials.
+type Proxies struct {
+	Metadata    *url.URL
+	Measurement *url.URL
+}
+
+func (o Options) proxy() *url.URL {
+	if o.Purpose == Metadata {
+		return o.Proxies.Metadata
+	}
+	return o.Proxies.Measurement
+}
+
+// DialPurpose dials a TCP connection to addr through the proxy configured
+// for o.Purpose, or directly when there is none, with the socket options of
+// o.Purpose applied. The proxy resolves host names in addr itself.
+func (o Options) DialPurpose(ctx context.Context, network, addr string) (net.Conn, error) {
+	u := o.proxy()
+	if u == nil {
+		return o.dialPurpose(ctx, network, addr)
+	}
+	switch u.Scheme {
+	case "socks5", "socks5h":
+		forward := &forwardDialer{opts: o}
+		d, err := proxy.FromURL(u, forward)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := d.(proxy.ContextDialer).DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return nil, err
+		}
+		return &tunnelConn{Conn: conn, raw: forward.conn}, nil
+	case "http", "https":
+		return o.dialConnect(ctx, u, addr)
+	}
+	return nil, fmt.Errorf("unsupported proxy scheme %q", u.Scheme)
+}
+
+// forwardDialer reaches a SOCKS5 proxy with the Bind and socket options of
+// opts applied, and remembers the connection it made.
+type forwardDialer struct {
+	opts Options
+	conn net.Conn
+}
+
+func (f *forwardDialer) Dial(network, addr string) (net.Conn, error) {
+	return f.DialContext(context.Background(), network, addr)
+}
+
+func (f *forwardDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	conn, err := f.opts.dialPurpose(ctx, network, addr)
+	f.conn = conn
+	return conn, err
+}
+
+// tunnelConn is a SOCKS5 tunnel that keeps the socket to the proxy
+// reachable through NetConn.
+type tunnelConn struct {
+	net.Conn
+	raw net.Conn
+}
+
+func (c *tunnelConn) NetConn() net.Conn {
+	return c.raw
+}
+
+// dialConnect opens a tunnel to addr with an HTTP CONNECT request, over TLS
+// to the proxy itself for https proxies.
+func (o Options) dialConnect(ctx context.Context, u *url.URL, addr string) (net.Conn, error) {
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	conn, err := o.dialPurpose(ctx, "tcp", net.JoinHostPort(u.Hostname(), port))
+	if err != nil {
+		return nil, err
+	}
+	// Unblock the handshake and CONNECT exchange when ctx ends.
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Now()) })
+	defer stop()
+	if u.Scheme == "https" {
+		tlsConn := tls.Client(conn, o.ConfigureTLS(&tls.Config{ServerName: u.Hostname(), MinVersion: tls.VersionTLS12}))
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		conn = tlsConn
+	}
+
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: http.Header{},
+	}
+	if u.User != nil {
+		password, _ := u.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(u.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// A successful CONNECT reply has no body; the tunnel follows directly.
+	if resp.StatusCode != http.StatusOK {
+		conn.Close()
+		return nil, fmt.Errorf("proxy CONNECT %s: %s", addr, resp.Status)
+	}
+	if !stop() {
+		conn.Close()
+		return nil, ctx.Err()
+	}
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn returns bytes the proxy sent after its CONNECT reply before
+// reading from the connection again.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+func (c *bufferedConn) NetConn() net.Conn {
+	return c.Conn
+}
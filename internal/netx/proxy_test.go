@@ -0,0 +1,228 @@
+package netx
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// proxyLog records the tunnels a test proxy opened and the credentials it
+// was given for each.
+type proxyLog struct {
+	mu      sync.Mutex
+	targets []string
+	auth    []string
+}
+
+func (l *proxyLog) add(target, auth string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.targets = append(l.targets, target)
+	l.auth = append(l.auth, auth)
+}
+
+func (l *proxyLog) snapshot() ([]string, []string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.targets...), append([]string(nil), l.auth...)
+}
+
+// pipe copies between both connections until either side closes.
+func pipe(a, b net.Conn) {
+	done := make(chan struct{}, 2)
+	go func() { io.Copy(a, b); done <- struct{}{} }()
+	go func() { io.Copy(b, a); done <- struct{}{} }()
+	<-done
+	a.Close()
+	b.Close()
+}
+
+// connectProxy is an HTTP proxy that only serves CONNECT.
+func connectProxy(t *testing.T, log *proxyLog) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		log.add(r.Host, r.Header.Get("Proxy-Authorization"))
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			upstream.Close()
+			return
+		}
+		rw.WriteString("HTTP/1.1 200 Connection established\r\n\r\n")
+		rw.Flush()
+		pipe(conn, upstream)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// socksProxy is a SOCKS5 server that requires username/password
+// authentication and supports CONNECT to IPv4 addresses and host names.
+func socksProxy(t *testing.T, log *proxyLog) string {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveSOCKS(conn, log)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+func serveSOCKS(conn net.Conn, log *proxyLog) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	readN := func(n int) []byte {
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil
+		}
+		return buf
+	}
+
+	greeting := readN(2)
+	if greeting == nil || greeting[0] != 5 || readN(int(greeting[1])) == nil {
+		return
+	}
+	conn.Write([]byte{5, 2})
+	ver := readN(2)
+	if ver == nil || ver[0] != 1 {
+		return
+	}
+	user := readN(int(ver[1]))
+	plen := readN(1)
+	if user == nil || plen == nil {
+		return
+	}
+	pass := readN(int(plen[0]))
+	if pass == nil {
+		return
+	}
+	conn.Write([]byte{1, 0})
+
+	req := readN(4)
+	if req == nil || req[1] != 1 {
+		return
+	}
+	var host string
+	switch req[3] {
+	case 1:
+		host = net.IP(readN(4)).String()
+	case 3:
+		n := readN(1)
+		if n == nil {
+			return
+		}
+		host = string(readN(int(n[0])))
+	default:
+		conn.Write([]byte{5, 8, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	port := readN(2)
+	if port == nil {
+		return
+	}
+	target := net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port))))
+	log.add(target, string(user)+":"+string(pass))
+	upstream, err := net.Dial("tcp", target)
+	if err != nil {
+		conn.Write([]byte{5, 5, 0, 1, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+	pipe(&bufferedConn{Conn: conn, r: r}, upstream)
+}
+
+func TestProxiesPerPurpose(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "ok")
+	}))
+	defer target.Close()
+	targetHost := target.Listener.Addr().String()
+
+	var connectLog, socksLog proxyLog
+	connect := connectProxy(t, &connectLog)
+	socks := socksProxy(t, &socksLog)
+
+	measureProxy, _ := url.Parse(connect.URL)
+	measureProxy.User = url.UserPassword("alice", "s3cret")
+	metadataProxy := &url.URL{Scheme: "socks5", Host: socks, User: url.UserPassword("bob", "hunter2")}
+	proxies := Proxies{Metadata: metadataProxy, Measurement: measureProxy}
+
+	get := func(purpose Purpose) {
+		t.Helper()
+		client := NewClient(Options{Timeout: 5 * time.Second, Purpose: purpose, Proxies: proxies})
+		defer client.CloseIdleConnections()
+		resp, err := client.Get(target.URL)
+		if err != nil {
+			t.Fatalf("purpose %d: %v", purpose, err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if string(body) != "ok" {
+			t.Fatalf("purpose %d: unexpected body %q", purpose, body)
+		}
+	}
+
+	get(Measurement)
+	targets, auth := connectLog.snapshot()
+	if len(targets) != 1 || targets[0] != targetHost {
+		t.Fatalf("expected one CONNECT to %s, got %v", targetHost, targets)
+	}
+	if auth[0] != "Basic YWxpY2U6czNjcmV0" {
+		t.Fatalf("unexpected Proxy-Authorization %q", auth[0])
+	}
+	if targets, _ := socksLog.snapshot(); len(targets) != 0 {
+		t.Fatalf("measurement traffic reached the metadata proxy: %v", targets)
+	}
+
+	get(Metadata)
+	targets, auth = socksLog.snapshot()
+	if len(targets) != 1 || targets[0] != targetHost {
+		t.Fatalf("expected one SOCKS5 CONNECT to %s, got %v", targetHost, targets)
+	}
+	if auth[0] != "bob:hunter2" {
+		t.Fatalf("unexpected SOCKS5 credentials %q", auth[0])
+	}
+	if targets, _ := connectLog.snapshot(); len(targets) != 1 {
+		t.Fatalf("metadata traffic reached the measurement proxy: %v", targets)
+	}
+}
+
+func TestDialPurposeReportsRefusedConnect(t *testing.T) {
+	var log proxyLog
+	connect := connectProxy(t, &log)
+	u, _ := url.Parse(connect.URL)
+
+	opts := Options{Proxies: Proxies{Measurement: u}}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// Nothing listens on port 1, so the proxy answers 502.
+	if _, err := opts.DialPurpose(ctx, "tcp", "127.0.0.1:1"); err == nil {
+		t.Fatal("expected an error for a refused CONNECT")
+	}
+}
@@ -0,0 +1,80 @@
+package netx
+
+import "net"
+
+// SocketOptions tunes the TCP sockets of measurement connections. Zero
+// sizes keep the system defaults and a nil NoDelay keeps Go's default of
+// TCP_NODELAY on. The buffer sizes are set before connecting, so the
+// receive buffer also decides the window scale offered in the handshake.
+type SocketOptions struct {
+	RcvBuf       int
+	SndBuf       int
+	NoDelay      *bool
+	NotSentLowat int
+	MPTCP        bool
+}
+
+// SocketState is what the kernel reports for a connected socket. Linux
+// doubles the requested buffer sizes to leave room for bookkeeping and caps
+// them at net.core.rmem_max and wmem_max; MPTCP is false when the kernel or
+// the peer fell back to plain TCP.
+type SocketState struct {
+	RcvBuf       int
+	SndBuf       int
+	NoDelay      bool
+	NotSentLowat int
+	MPTCP        bool
+}
+
+// SetsNotSentLowat reports whether SocketOptions.NotSentLowat has any
+// effect on this platform.
+func SetsNotSentLowat() bool {
+	return tcpNotSentLowat != 0
+}
+
+// applySocketOptions adds the measurement socket options o to d.
+func applySocketOptions(d *net.Dialer, o SocketOptions) {
+	if o.RcvBuf > 0 || o.SndBuf > 0 || o.NotSentLowat > 0 {
+		d.Control = chainControl(d.Control, bufferControl(o.RcvBuf, o.SndBuf, o.NotSentLowat))
+	}
+	if o.MPTCP {
+		d.SetMultipathTCP(true)
+	}
+}
+
+// applyNoDelay sets TCP_NODELAY on a freshly dialed measurement connection
+// when o asks for a value.
+func applyNoDelay(conn net.Conn, o SocketOptions) error {
+	if o.NoDelay == nil {
+		return nil
+	}
+	if tc, ok := conn.(*net.TCPConn); ok {
+		return tc.SetNoDelay(*o.NoDelay)
+	}
+	return nil
+}
+
+// socketState reads the effective options of the TCP socket under conn,
+// looking through TLS and proxy tunnels. It returns nil when there is no
+// TCP socket to read.
+func socketState(conn net.Conn) *SocketState {
+	for {
+		switch c := conn.(type) {
+		case *net.TCPConn:
+			raw, err := c.SyscallConn()
+			if err != nil {
+				return nil
+			}
+			state, err := readSocketState(raw)
+			if err != nil {
+				return nil
+			}
+			state.MPTCP, _ = c.MultipathTCP()
+			return &state
+		case interface{ NetConn() net.Conn }:
+			conn = c.NetConn()
+		default:
+			return nil
+		}
+	}
+}
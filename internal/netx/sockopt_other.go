@@ -0,0 +1,64 @@
+//go:build !windows
+
+package netx
+
+import (
+	"runtime"
+	"syscall"
+)
+
+// tcpNotSentLowat is the TCP_NOTSENT_LOWAT option number, or 0 where the
+// option does not exist.
+var tcpNotSentLowat = map[string]int{"linux": 25, "darwin": 0x201}[runtime.GOOS]
+
+// bufferControl sets SO_RCVBUF, SO_SNDBUF and TCP_NOTSENT_LOWAT before the
+// socket connects; zero values are left alone.
+func bufferControl(rcvBuf, sndBuf, notSentLowat int) controlFunc {
+	return func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			if rcvBuf > 0 {
+				if sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF, rcvBuf); sockErr != nil {
+					return
+				}
+			}
+			if sndBuf > 0 {
+				if sockErr = syscall.SetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF, sndBuf); sockErr != nil {
+					return
+				}
+			}
+			if notSentLowat > 0 && tcpNotSentLowat != 0 {
+				sockErr = syscall.SetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpNotSentLowat, notSentLowat)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
+
+func readSocketState(c syscall.RawConn) (SocketState, error) {
+	var state SocketState
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		if state.RcvBuf, sockErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF); sockErr != nil {
+			return
+		}
+		if state.SndBuf, sockErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF); sockErr != nil {
+			return
+		}
+		var noDelay int
+		if noDelay, sockErr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_NODELAY); sockErr != nil {
+			return
+		}
+		state.NoDelay = noDelay != 0
+		if tcpNotSentLowat != 0 {
+			state.NotSentLowat, sockErr = syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, tcpNotSentLowat)
+		}
+	})
+	if err != nil {
+		return state, err
+	}
+	return state, sockErr
+}
@@ -0,0 +1,52 @@
+//go:build windows
+
+package netx
+
+import "syscall"
+
+// tcpNotSentLowat is 0: Windows has no TCP_NOTSENT_LOWAT.
+const tcpNotSentLowat = 0
+
+// bufferControl sets SO_RCVBUF and SO_SNDBUF before the socket connects;
+// zero values are left alone.
+func bufferControl(rcvBuf, sndBuf, _ int) controlFunc {
+	return func(network, address string, c syscall.RawConn) error {
+		var sockErr error
+		err := c.Control(func(fd uintptr) {
+			if rcvBuf > 0 {
+				if sockErr = syscall.SetsockoptInt(syscall.Handle(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF, rcvBuf); sockErr != nil {
+					return
+				}
+			}
+			if sndBuf > 0 {
+				sockErr = syscall.SetsockoptInt(syscall.Handle(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF, sndBuf)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		return sockErr
+	}
+}
+
+func readSocketState(c syscall.RawConn) (SocketState, error) {
+	var state SocketState
+	var sockErr error
+	err := c.Control(func(fd uintptr) {
+		if state.RcvBuf, sockErr = syscall.GetsockoptInt(syscall.Handle(fd), syscall.SOL_SOCKET, syscall.SO_RCVBUF); sockErr != nil {
+			return
+		}
+		if state.SndBuf, sockErr = syscall.GetsockoptInt(syscall.Handle(fd), syscall.SOL_SOCKET, syscall.SO_SNDBUF); sockErr != nil {
+			return
+		}
+		var noDelay int
+		if noDelay, sockErr = syscall.GetsockoptInt(syscall.Handle(fd), syscall.IPPROTO_TCP, syscall.TCP_NODELAY); sockErr != nil {
+			return
+		}
+		state.NoDelay = noDelay != 0
+	})
+	if err != nil {
+		return state, err
+	}
+	return state, sockErr
+}
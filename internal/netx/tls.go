@@ -0,0 +1,99 @@
+package netx
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"os"
+)
+
+// TLS lists the TLS settings applied to every connection. CAFile adds PEM
+// roots to the system pool; CertFile and KeyFile hold a client certificate
+// offered when a server asks for one; KeyLogFile receives session secrets
+// in NSS key log format. Zero values keep the defaults.
+type TLS struct {
+	CAFile       string
+	CertFile     string
+	KeyFile      string
+	MinVersion   uint16
+	MaxVersion   uint16
+	CipherSuites []uint16
+	KeyLogFile   string
+}
+
+// LoadTLS loads the files named in t and returns the settings as a template
+// for Options.TLS. The closer releases the key log file and must only be
+// called once no more handshakes use the template.
+func LoadTLS(t TLS) (*tls.Config, io.Closer, error) {
+	tmpl := &tls.Config{
+		MinVersion:   t.MinVersion,
+		MaxVersion:   t.MaxVersion,
+		CipherSuites: t.CipherSuites,
+	}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, nil, fmt.Errorf("%s: no PEM certificates found", t.CAFile)
+		}
+		tmpl.RootCAs = pool
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		tmpl.Certificates = []tls.Certificate{cert}
+	}
+	if t.KeyLogFile != "" {
+		f, err := os.OpenFile(t.KeyLogFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, nil, err
+		}
+		tmpl.KeyLogWriter = f
+		return tmpl, f, nil
+	}
+	return tmpl, nopCloser{}, nil
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// ConfigureTLS returns a copy of cfg with the settings from o.TLS applied.
+func (o Options) ConfigureTLS(cfg *tls.Config) *tls.Config {
+	out := cfg.Clone()
+	if out == nil {
+		out = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	tmpl := o.TLS
+	if tmpl == nil {
+		return out
+	}
+	if tmpl.MinVersion != 0 {
+		out.MinVersion = tmpl.MinVersion
+	}
+	if tmpl.MaxVersion != 0 {
+		out.MaxVersion = tmpl.MaxVersion
+	}
+	if tmpl.CipherSuites != nil {
+		out.CipherSuites = tmpl.CipherSuites
+	}
+	if tmpl.RootCAs != nil {
+		out.RootCAs = tmpl.RootCAs
+	}
+	if tmpl.Certificates != nil {
+		out.Certificates = tmpl.Certificates
+	}
+	if tmpl.KeyLogWriter != nil {
+		out.KeyLogWriter = tmpl.KeyLogWriter
+	}
+	return out
+}
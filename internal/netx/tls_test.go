@@ -0,0 +1,31 @@
+package netx
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadTLSClosesKeyLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keys.log")
+	tmpl, closer, err := LoadTLS(TLS{KeyLogFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tmpl.KeyLogWriter.Write([]byte("CLIENT_RANDOM 00 00\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := closer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tmpl.KeyLogWriter.Write([]byte("x")); err == nil {
+		t.Fatal("expected the key log file to be closed")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "CLIENT_RANDOM 00 00\n" {
+		t.Fatalf("unexpected key log contents %q", data)
+	}
+
+	if _, closer, err := LoadTLS(TLS{}); err != nil || closer.Close() != nil {
+		t.Fatalf("expected a no-op closer without a key log, got %v", err)
+	}
+}
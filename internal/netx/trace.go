@@ -0,0 +1,112 @@
+package netx
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+)
+
+// ConnDetail describes one connection a client used: the HTTP protocol of
+// its responses, the negotiated TLS parameters and the leaf certificate.
+// Reused counts the requests that found the connection already open. Socket
+// holds the TCP socket options in effect when the connection was first
+// used, or nil when they could not be read.
+type ConnDetail struct {
+	RemoteAddr  string
+	Proto       string
+	TLSVersion  string
+	CipherSuite string
+	ALPN        string
+	CertSubject string
+	CertIssuer  string
+	Requests    int
+	Reused      int
+	Socket      *SocketState
+}
+
+// ConnTracker collects a ConnDetail per connection, in order of first use.
+type ConnTracker struct {
+	mu    sync.Mutex
+	conns []*ConnDetail
+	index map[net.Conn]*ConnDetail
+}
+
+func NewConnTracker() *ConnTracker {
+	return &ConnTracker{index: map[net.Conn]*ConnDetail{}}
+}
+
+// Connections returns a snapshot of the connections seen so far.
+func (t *ConnTracker) Connections() []ConnDetail {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	out := make([]ConnDetail, 0, len(t.conns))
+	for _, c := range t.conns {
+		out = append(out, *c)
+	}
+	return out
+}
+
+func (t *ConnTracker) gotConn(info httptrace.GotConnInfo) *ConnDetail {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	detail, ok := t.index[info.Conn]
+	if !ok {
+		// Until a response arrives the protocol follows from ALPN; this
+		// transport never speaks HTTP/2 without TLS.
+		detail = &ConnDetail{RemoteAddr: info.Conn.RemoteAddr().String(), Proto: "HTTP/1.1", Socket: socketState(info.Conn)}
+		if tc, ok := info.Conn.(*tls.Conn); ok {
+			state := tc.ConnectionState()
+			detail.TLSVersion = tls.VersionName(state.Version)
+			detail.CipherSuite = tls.CipherSuiteName(state.CipherSuite)
+			detail.ALPN = state.NegotiatedProtocol
+			if detail.ALPN == "h2" {
+				detail.Proto = "HTTP/2.0"
+			}
+			if len(state.PeerCertificates) > 0 {
+				leaf := state.PeerCertificates[0]
+				detail.CertSubject = leaf.Subject.String()
+				detail.CertIssuer = leaf.Issuer.String()
+			}
+		}
+		t.index[info.Conn] = detail
+		t.conns = append(t.conns, detail)
+	}
+	detail.Requests++
+	if info.Reused {
+		detail.Reused++
+	}
+	return detail
+}
+
+func (t *ConnTracker) gotResponse(detail *ConnDetail, resp *http.Response) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	detail.Proto = resp.Proto
+}
+
+// trackingTransport reports the connection behind every request to a
+// ConnTracker.
+type trackingTransport struct {
+	base    *http.Transport
+	tracker *ConnTracker
+}
+
+func (t *trackingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var detail *ConnDetail
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			detail = t.tracker.gotConn(info)
+		},
+	}
+	resp, err := t.base.RoundTrip(req.WithContext(httptrace.WithClientTrace(req.Context(), trace)))
+	if err == nil && detail != nil {
+		t.tracker.gotResponse(detail, resp)
+	}
+	return resp, err
+}
+
+func (t *trackingTransport) CloseIdleConnections() {
+	t.base.CloseIdleConnections()
+}
@@ -0,0 +1,105 @@
+package output
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/runner"
+)
+
+var csvHeader = []string{
+	"timestamp",
+	"endpoint",
+	"asn",
+	"direction",
+	"threads",
+	"mbps",
+	"bytes",
+	"duration_ms",
+	"loaded_latency_median_ms",
+	"loaded_latency_jitter_ms",
+	"status",
+}
+
+// csvRun is one measured endpoint whose rounds become rows.
+type csvRun struct {
+	endpoint string
+	asn      string
+	rounds   []runner.RoundResult
+}
+
+// csvRuns lists the runs a result holds: the selected endpoint normally,
+// every endpoint of --compare-endpoints in rank order, and each address
+// family of a --dual-stack run, since the top-level rounds only describe
+// the best endpoint or the IPv4 run. The server ASN of a comparison is only
+// known for the selected endpoint.
+func csvRuns(result runner.RunResult) []csvRun {
+	if len(result.Comparison) > 0 {
+		runs := make([]csvRun, 0, len(result.Comparison))
+		for _, entry := range result.Comparison {
+			run := csvRun{endpoint: entry.Endpoint.IP, rounds: entry.Rounds}
+			if entry.Endpoint.IP == result.SelectedEndpoint.IP {
+				run.asn = asNumber(result.ConnectionInfo.Server.ASN)
+			}
+			runs = append(runs, run)
+		}
+		return runs
+	}
+	if ds := result.DualStack; ds != nil && len(ds.Families) > 0 {
+		runs := make([]csvRun, 0, len(ds.Families))
+		for _, f := range ds.Families {
+			runs = append(runs, csvRun{endpoint: f.Endpoint.IP, asn: asNumber(f.Server.ASN), rounds: f.Rounds})
+		}
+		return runs
+	}
+	return []csvRun{{
+		endpoint: result.SelectedEndpoint.IP,
+		asn:      asNumber(result.ConnectionInfo.Server.ASN),
+		rounds:   result.Rounds,
+	}}
+}
+
+// WriteCSV writes one row per round. comma selects the field separator so
+// the same layout serves both CSV and TSV.
+func WriteCSV(w io.Writer, result runner.RunResult, comma rune, header bool) error {
+	cw := csv.NewWriter(w)
+	cw.Comma = comma
+	if header {
+		if err := cw.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	for _, run := range csvRuns(result) {
+		for _, round := range run.rounds {
+			timestamp := round.StartedAt
+			if timestamp == "" {
+				timestamp = result.StartedAt
+			}
+			if err := cw.Write([]string{
+				timestamp,
+				run.endpoint,
+				run.asn,
+				round.Direction,
+				strconv.Itoa(round.Threads),
+				strconv.FormatFloat(round.Mbps, 'f', 2, 64),
+				strconv.FormatInt(round.TotalBytes, 10),
+				strconv.FormatInt(round.DurationMs, 10),
+				optionalMs(round.LoadedLatency.MedianMs),
+				optionalMs(round.LoadedLatency.JitterMs),
+				round.Status,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+func optionalMs(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', 2, 64)
+}
@@ -0,0 +1,85 @@
+package output
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/config"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/runner"
+)
+
+func TestWriteCSV(t *testing.T) {
+	var buf bytes.Buffer
+	result := testResult()
+	result.Rounds[0].StartedAt = "2026-03-15T00:00:01Z"
+	if err := WriteCSV(&buf, result, ',', true); err != nil {
+		t.Fatal(err)
+	}
+	want := "timestamp,endpoint,asn,direction,threads,mbps,bytes,duration_ms,loaded_latency_median_ms,loaded_latency_jitter_ms,status\n" +
+		"2026-03-15T00:00:01Z,17.253.85.205,AS714,download,1,100.00,125000000,10000,45.00,10.00,ok\n"
+	if buf.String() != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestWriteCSVDualStack(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, testDualStackResult(), ',', false); err != nil {
+		t.Fatal(err)
+	}
+	want := "2026-03-15T00:00:00Z,17.253.85.205,AS714,download,1,100.00,125000000,10000,45.00,10.00,ok\n" +
+		"2026-03-15T00:00:00Z,2403:300:a42::1,AS714,download,1,120.00,150000000,10000,,,ok\n"
+	if buf.String() != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestWriteCSVComparison(t *testing.T) {
+	var buf bytes.Buffer
+	if err := WriteCSV(&buf, testComparisonResult(), ',', false); err != nil {
+		t.Fatal(err)
+	}
+	want := "2026-03-15T00:00:00Z,17.253.85.205,AS714,download,1,100.00,125000000,10000,45.00,10.00,ok\n" +
+		"2026-03-15T00:00:00Z,17.253.85.206,,download,1,40.00,50000000,10000,,,degraded\n"
+	if buf.String() != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestWriteTSVWithoutLoadedLatency(t *testing.T) {
+	var buf bytes.Buffer
+	result := testResult()
+	result.Rounds[0].LoadedLatency = runner.LatencyResult{Status: "unavailable"}
+	if err := WriteCSV(&buf, result, '\t', false); err != nil {
+		t.Fatal(err)
+	}
+	want := "2026-03-15T00:00:00Z\t17.253.85.205\tAS714\tdownload\t1\t100.00\t125000000\t10000\t\t\tok\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestWriteCSVAppendSkipsHeader(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.csv")
+	cfg := &config.Config{OutputAppend: true}
+	o := config.Output{Format: config.OutputCSV, Path: path}
+	for i := 0; i < 2; i++ {
+		if err := Write(cfg, o, testResult()); err != nil {
+			t.Fatalf("Write() #%d error: %v", i, err)
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expected header + 2 rows, got %d lines:\n%s", len(lines), data)
+	}
+	if !strings.HasPrefix(lines[0], "timestamp,") || strings.HasPrefix(lines[2], "timestamp,") {
+		t.Fatalf("header should appear exactly once:\n%s", data)
+	}
+}
@@ -0,0 +1,403 @@
+package output
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/config"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/fsx"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/i18n"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/runner"
+)
+
+const (
+	chartWidth   = 640
+	chartHeight  = 200
+	chartPadL    = 56
+	chartPadR    = 12
+	chartPadT    = 12
+	chartPadB    = 28
+	histogramMax = 20
+)
+
+// WriteHTMLReport writes a self-contained HTML page (inline CSS and SVG, no
+// external assets) describing result.
+func WriteHTMLReport(path string, result runner.RunResult) error {
+	return fsx.WriteAtomic(path, func(w io.Writer) error {
+		return RenderHTML(w, result)
+	})
+}
+
+func RenderHTML(w io.Writer, result runner.RunResult) error {
+	return reportTemplate.Execute(w, newReportView(result))
+}
+
+type reportView struct {
+	Lang        string
+	Title       string
+	Generated   string
+	Result      runner.RunResult
+	Status      string
+	StatusClass string
+	IdleLatency string
+	DataUsed    string
+	IdleChart   template.HTML
+	Rounds      []roundView
+	Candidates  []candidateView
+	Families    []familyView
+	Deltas      []string
+	L           map[string]string
+}
+
+type roundView struct {
+	runner.RoundResult
+	Bytes        string
+	Duration     string
+	Loaded       string
+	Throughput   template.HTML
+	Distribution template.HTML
+}
+
+type familyView struct {
+	runner.FamilyResult
+	Idle string
+}
+
+type candidateView struct {
+	runner.CandidateResult
+	Index    int
+	RTT      string
+	Selected bool
+}
+
+func newReportView(result runner.RunResult) reportView {
+	v := reportView{
+		Lang:      i18n.Lang(),
+		Title:     i18n.Text("iNetSpeed-CLI Report", "iNetSpeed-CLI 测速报告"),
+		Generated: time.Now().UTC().Format(time.RFC3339),
+		Result:    result,
+		DataUsed:  config.HumanBytes(result.TotalBytes),
+		IdleChart: histogramChart(result.IdleLatency.SamplesMs),
+		L: map[string]string{
+			"started":     i18n.Text("Started", "开始时间"),
+			"generated":   i18n.Text("Generated", "生成时间"),
+			"host":        i18n.Text("Host", "主机"),
+			"endpoint":    i18n.Text("Endpoint", "节点"),
+			"summary":     i18n.Text("Summary", "测速汇总"),
+			"idle":        i18n.Text("Idle Latency", "空载延迟"),
+			"data":        i18n.Text("Data Used", "消耗流量"),
+			"status":      i18n.Text("Status", "状态"),
+			"warnings":    i18n.Text("Warnings", "告警"),
+			"candidates":  i18n.Text("Endpoint Candidates", "候选节点"),
+			"ip":          "IP",
+			"desc":        i18n.Text("Description", "描述"),
+			"rtt":         "RTT",
+			"source":      i18n.Text("Source", "来源"),
+			"connection":  i18n.Text("Connection Information", "连接信息"),
+			"client":      i18n.Text("Client", "客户端"),
+			"server":      i18n.Text("Server", "服务端"),
+			"isp":         "ISP",
+			"asn":         "ASN",
+			"location":    i18n.Text("Location", "位置"),
+			"connections": i18n.Text("Connections", "连接"),
+			"remote":      i18n.Text("Remote", "远端"),
+			"protocol":    i18n.Text("Protocol", "协议"),
+			"cipher":      i18n.Text("Cipher", "密码套件"),
+			"cert":        i18n.Text("Certificate", "证书"),
+			"issuer":      i18n.Text("Issuer", "签发者"),
+			"requests":    i18n.Text("Requests (reused)", "请求数（复用）"),
+			"buffers":     i18n.Text("Socket buffers (rcv / snd)", "套接字缓冲（收 / 发）"),
+			"rounds":      i18n.Text("Rounds", "测速轮次"),
+			"round":       i18n.Text("Round", "轮次"),
+			"throughput":  i18n.Text("Throughput", "吞吐"),
+			"bytes":       i18n.Text("Bytes", "流量"),
+			"duration":    i18n.Text("Duration", "耗时"),
+			"loaded":      i18n.Text("Loaded Latency", "负载延迟"),
+			"overtime":    i18n.Text("Throughput over time", "吞吐随时间变化"),
+			"dist":        i18n.Text("Latency distribution", "延迟分布"),
+			"unavailable": i18n.Text("unavailable", "不可用"),
+			"dualstack":   i18n.Text("Dual-Stack Comparison", "双栈对比"),
+			"family":      i18n.Text("Family", "协议"),
+			"download":    i18n.Text("Download", "下载"),
+			"upload":      i18n.Text("Upload", "上传"),
+		},
+	}
+	if result.Degraded {
+		v.Status = i18n.Text("Completed with degraded results", "测速完成，但结果存在降级")
+		v.StatusClass = "warn"
+	} else {
+		v.Status = i18n.Text("All tests complete", "所有测试完成")
+		v.StatusClass = "ok"
+	}
+	v.IdleLatency = latencySummary(result.IdleLatency)
+	for i, candidate := range result.Candidates {
+		cv := candidateView{CandidateResult: candidate, Index: i + 1, RTT: "-"}
+		if candidate.RTTMs != nil {
+			cv.RTT = fmt.Sprintf("%.2f ms", *candidate.RTTMs)
+			if candidate.MinRTTMs != nil {
+				cv.RTT += fmt.Sprintf(i18n.Text(" (min %.2f)", "（最小 %.2f）"), *candidate.MinRTTMs)
+			}
+			if candidate.Loss != nil && *candidate.Loss > 0 {
+				cv.RTT += fmt.Sprintf(i18n.Text(", loss %.0f%%", "，丢失 %.0f%%"), *candidate.Loss*100)
+			}
+		}
+		cv.Selected = candidate.IP != "" && candidate.IP == result.SelectedEndpoint.IP
+		v.Candidates = append(v.Candidates, cv)
+	}
+	if ds := result.DualStack; ds != nil {
+		for _, f := range ds.Families {
+			v.Families = append(v.Families, familyView{FamilyResult: f, Idle: latencySummary(f.IdleLatency)})
+		}
+		v.Deltas = dualStackDeltas(ds)
+	}
+	for _, round := range result.Rounds {
+		v.Rounds = append(v.Rounds, roundView{
+			RoundResult:  round,
+			Bytes:        config.HumanBytes(round.TotalBytes),
+			Duration:     fmt.Sprintf("%.1fs", float64(round.DurationMs)/1000),
+			Loaded:       latencySummary(round.LoadedLatency),
+			Throughput:   throughputChart(round.Timeline),
+			Distribution: histogramChart(round.LoadedLatency.SamplesMs),
+		})
+	}
+	return v
+}
+
+func latencySummary(l runner.LatencyResult) string {
+	if l.Status != "ok" || l.MedianMs == nil {
+		return i18n.Text("unavailable", "不可用")
+	}
+	jitter := 0.0
+	if l.JitterMs != nil {
+		jitter = *l.JitterMs
+	}
+	return fmt.Sprintf(i18n.Text("%.2f ms (jitter %.2f ms)", "%.2f 毫秒 (抖动 %.2f 毫秒)"), *l.MedianMs, jitter)
+}
+
+// throughputChart draws the per-interval rate of one round as an area chart.
+func throughputChart(samples []runner.ThroughputSample) template.HTML {
+	if len(samples) == 0 {
+		return emptyChart()
+	}
+	maxX := float64(samples[len(samples)-1].ElapsedMs) / 1000
+	maxY := 0.0
+	for _, s := range samples {
+		maxY = math.Max(maxY, s.Mbps)
+	}
+	maxY = niceCeil(maxY)
+	if maxX <= 0 {
+		maxX = 1
+	}
+
+	var b strings.Builder
+	openChart(&b)
+	axes(&b, maxY, "Mbps", fmt.Sprintf("%.1fs", maxX))
+	points := make([]string, 0, len(samples)+2)
+	points = append(points, fmt.Sprintf("%.1f,%.1f", plotX(0, maxX), plotY(0, maxY)))
+	for _, s := range samples {
+		points = append(points, fmt.Sprintf("%.1f,%.1f", plotX(float64(s.ElapsedMs)/1000, maxX), plotY(s.Mbps, maxY)))
+	}
+	line := strings.Join(points, " ")
+	fmt.Fprintf(&b, `<polygon class="area" points="%s %.1f,%.1f"/>`, line, plotX(maxX, maxX), plotY(0, maxY))
+	fmt.Fprintf(&b, `<polyline class="line" points="%s"/>`, line)
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+// histogramChart buckets latency samples into at most histogramMax bins.
+func histogramChart(samples []float64) template.HTML {
+	if len(samples) == 0 {
+		return emptyChart()
+	}
+	lo, hi := samples[0], samples[0]
+	for _, s := range samples {
+		lo = math.Min(lo, s)
+		hi = math.Max(hi, s)
+	}
+	bins := int(math.Ceil(math.Sqrt(float64(len(samples)))))
+	bins = max(1, min(bins, histogramMax))
+	width := (hi - lo) / float64(bins)
+	if width <= 0 {
+		bins, width = 1, 1
+	}
+	counts := make([]int, bins)
+	for _, s := range samples {
+		i := int((s - lo) / width)
+		if i >= bins {
+			i = bins - 1
+		}
+		counts[i]++
+	}
+	maxCount := 0
+	for _, c := range counts {
+		maxCount = max(maxCount, c)
+	}
+	maxY := float64(maxCount)
+
+	var b strings.Builder
+	openChart(&b)
+	axes(&b, maxY, "n", fmt.Sprintf("%.1f ms", hi))
+	fmt.Fprintf(&b, `<text class="label" x="%d" y="%d">%.1f ms</text>`, chartPadL, chartHeight-8, lo)
+	plotW := float64(chartWidth - chartPadL - chartPadR)
+	barW := plotW / float64(bins)
+	for i, c := range counts {
+		if c == 0 {
+			continue
+		}
+		x := float64(chartPadL) + float64(i)*barW
+		y := plotY(float64(c), maxY)
+		fmt.Fprintf(&b, `<rect class="bar" x="%.1f" y="%.1f" width="%.1f" height="%.1f"><title>%.2f–%.2f ms: %d</title></rect>`,
+			x+1, y, math.Max(barW-2, 1), plotY(0, maxY)-y, lo+float64(i)*width, lo+float64(i+1)*width, c)
+	}
+	b.WriteString(`</svg>`)
+	return template.HTML(b.String())
+}
+
+func openChart(b *strings.Builder) {
+	fmt.Fprintf(b, `<svg class="chart" viewBox="0 0 %d %d" xmlns="http://www.w3.org/2000/svg" role="img">`, chartWidth, chartHeight)
+}
+
+func axes(b *strings.Builder, maxY float64, unit, xLabel string) {
+	for i := 0; i <= 4; i++ {
+		v := maxY * float64(i) / 4
+		y := plotY(v, maxY)
+		fmt.Fprintf(b, `<line class="grid" x1="%d" y1="%.1f" x2="%d" y2="%.1f"/>`, chartPadL, y, chartWidth-chartPadR, y)
+		fmt.Fprintf(b, `<text class="label" x="%d" y="%.1f" text-anchor="end">%s</text>`, chartPadL-6, y+4, formatTick(v))
+	}
+	fmt.Fprintf(b, `<text class="label" x="8" y="%d">%s</text>`, chartPadT+4, template.HTMLEscapeString(unit))
+	fmt.Fprintf(b, `<text class="label" x="%d" y="%d" text-anchor="end">%s</text>`, chartWidth-chartPadR, chartHeight-8, template.HTMLEscapeString(xLabel))
+}
+
+func emptyChart() template.HTML {
+	return template.HTML(fmt.Sprintf(`<svg class="chart" viewBox="0 0 %d %d" xmlns="http://www.w3.org/2000/svg" role="img"><text class="label" x="%d" y="%d" text-anchor="middle">%s</text></svg>`,
+		chartWidth, chartHeight/2, chartWidth/2, chartHeight/4, template.HTMLEscapeString(i18n.Text("No samples", "无样本"))))
+}
+
+func plotX(v, maxX float64) float64 {
+	return float64(chartPadL) + v/maxX*float64(chartWidth-chartPadL-chartPadR)
+}
+
+func plotY(v, maxY float64) float64 {
+	if maxY <= 0 {
+		maxY = 1
+	}
+	return float64(chartHeight-chartPadB) - v/maxY*float64(chartHeight-chartPadT-chartPadB)
+}
+
+// niceCeil rounds v up to 1, 2 or 5 times a power of ten so axis ticks
+// land on readable values.
+func niceCeil(v float64) float64 {
+	if v <= 0 {
+		return 1
+	}
+	exp := math.Pow(10, math.Floor(math.Log10(v)))
+	for _, m := range []float64{1, 2, 5, 10} {
+		if v <= m*exp {
+			return m * exp
+		}
+	}
+	return 10 * exp
+}
+
+func formatTick(v float64) string {
+	if v == math.Trunc(v) {
+		return fmt.Sprintf("%.0f", v)
+	}
+	return fmt.Sprintf("%.1f", v)
+}
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body{font-family:-apple-system,"Segoe UI",Roboto,"PingFang SC","Microsoft YaHei",sans-serif;margin:0;background:#f6f7f9;color:#1d2330}
+main{max-width:960px;margin:0 auto;padding:24px}
+h1{font-size:1.6em;margin:0 0 4px}
+h2{font-size:1.2em;margin:32px 0 12px;border-bottom:1px solid #d8dce3;padding-bottom:4px}
+h3{font-size:1em;margin:20px 0 8px}
+.meta{color:#5b6475;font-size:.9em}
+.badge{display:inline-block;padding:2px 10px;border-radius:10px;font-size:.85em;font-weight:600}
+.badge.ok{background:#dff5e3;color:#1d6b32}.badge.warn{background:#fff1d6;color:#8a5a00}
+table{border-collapse:collapse;width:100%;background:#fff;font-size:.92em}
+th,td{text-align:left;padding:6px 10px;border-bottom:1px solid #e6e9ee}
+th{background:#eef1f5;font-weight:600}
+tr.selected td{background:#eaf3ff;font-weight:600}
+td.num{text-align:right;font-variant-numeric:tabular-nums}
+.charts{display:grid;grid-template-columns:1fr 1fr;gap:12px}
+.card{background:#fff;border:1px solid #e6e9ee;border-radius:6px;padding:8px 12px}
+.card h4{margin:4px 0;font-size:.85em;color:#5b6475;font-weight:600}
+svg.chart{width:100%;height:auto}
+.grid{stroke:#e6e9ee;stroke-width:1}
+.label{fill:#5b6475;font-size:11px}
+.line{fill:none;stroke:#2f6fed;stroke-width:2}
+.area{fill:#2f6fed;fill-opacity:.15}
+.bar{fill:#2f6fed;fill-opacity:.7}
+ul.warnings{background:#fff8e8;border:1px solid #f1dca8;padding:8px 8px 8px 28px}
+@media (max-width:720px){.charts{grid-template-columns:1fr}}
+</style>
+</head>
+<body>
+<main>
+<h1>{{.Title}}</h1>
+<div class="meta">{{.L.started}}: {{.Result.StartedAt}} · {{.L.generated}}: {{.Generated}}{{with .Result.ConnectionInfo.Host}} · {{$.L.host}}: {{.}}{{end}}{{with .Result.SelectedEndpoint.IP}} · {{$.L.endpoint}}: {{.}}{{end}}</div>
+
+<h2>{{.L.summary}}</h2>
+<p><span class="badge {{.StatusClass}}">{{.Status}}</span></p>
+<table>
+<tr><th>{{.L.idle}}</th><td>{{.IdleLatency}}</td></tr>
+<tr><th>{{.L.data}}</th><td>{{.DataUsed}}</td></tr>
+{{range .Rounds}}<tr><th>{{.Name}}</th><td>{{printf "%.2f" .Mbps}} Mbps · {{$.L.loaded}} {{.Loaded}}</td></tr>
+{{end}}</table>
+{{if .Result.Warnings}}<h3>{{.L.warnings}}</h3>
+<ul class="warnings">{{range .Result.Warnings}}<li><code>{{.Code}}</code> {{.Message}}</li>{{end}}</ul>{{end}}
+
+{{if .Families}}<h2>{{.L.dualstack}}</h2>
+<table>
+<tr><th>{{.L.family}}</th><th>{{.L.endpoint}}</th><th>{{.L.idle}}</th><th>{{.L.download}}</th><th>{{.L.upload}}</th></tr>
+{{range .Families}}<tr><td>IPv{{.Family}}</td><td>{{or .Endpoint.IP "-"}}</td><td>{{.Idle}}</td><td class="num">{{printf "%.2f" .DownloadMbps}} Mbps</td><td class="num">{{printf "%.2f" .UploadMbps}} Mbps</td></tr>
+{{end}}</table>
+{{with .Deltas}}<ul>{{range .}}<li>{{.}}</li>{{end}}</ul>{{end}}{{end}}
+
+{{if .Candidates}}<h2>{{.L.candidates}}</h2>
+<table>
+<tr><th>#</th><th>{{.L.ip}}</th><th>{{.L.desc}}</th><th>{{.L.rtt}}</th><th>{{.L.source}}</th><th>{{.L.status}}</th></tr>
+{{range .Candidates}}<tr{{if .Selected}} class="selected"{{end}}><td>{{.Index}}</td><td>{{.IP}}</td><td>{{.Description}}</td><td class="num">{{.RTT}}</td><td>{{.Source}}</td><td>{{.Status}}</td></tr>
+{{end}}</table>{{end}}
+
+<h2>{{.L.connection}}</h2>
+<table>
+<tr><th></th><th>{{.L.ip}}</th><th>{{.L.isp}}</th><th>{{.L.asn}}</th><th>{{.L.location}}</th></tr>
+{{with .Result.ConnectionInfo.Client}}<tr><th>{{$.L.client}}</th><td>{{or .IP $.L.unavailable}}</td><td>{{.ISP}}</td><td>{{.ASN}}</td><td>{{.Location}}</td></tr>{{end}}
+{{with .Result.ConnectionInfo.Server}}<tr><th>{{$.L.server}}</th><td>{{or .IP $.L.unavailable}}</td><td>{{.ISP}}</td><td>{{.ASN}}</td><td>{{.Location}}</td></tr>{{end}}
+</table>
+{{with .Result.ConnectionInfo.Connections}}<h3>{{$.L.connections}}</h3>
+<table>
+<tr><th>{{$.L.remote}}</th><th>{{$.L.protocol}}</th><th>TLS</th><th>{{$.L.cipher}}</th><th>{{$.L.cert}}</th><th>{{$.L.issuer}}</th><th>{{$.L.requests}}</th><th>{{$.L.buffers}}</th></tr>
+{{range .}}<tr><td>{{.RemoteAddr}}</td><td>{{.Proto}}</td><td>{{.TLSVersion}}</td><td>{{.CipherSuite}}</td><td>{{.CertSubject}}</td><td>{{.CertIssuer}}</td><td class="num">{{.Requests}} ({{.ReusedRequests}})</td><td class="num">{{with .Socket}}{{.RcvBufBytes}} / {{.SndBufBytes}}{{end}}</td></tr>
+{{end}}</table>{{end}}
+
+<h2>{{.L.idle}}</h2>
+<div class="card"><h4>{{.L.dist}} · {{.IdleLatency}}</h4>{{.IdleChart}}</div>
+
+{{if .Rounds}}<h2>{{.L.rounds}}</h2>
+<table>
+<tr><th>{{.L.round}}</th><th>{{.L.throughput}}</th><th>{{.L.bytes}}</th><th>{{.L.duration}}</th><th>{{.L.loaded}}</th><th>{{.L.status}}</th></tr>
+{{range .Rounds}}<tr><td>{{.Name}}</td><td class="num">{{printf "%.2f" .Mbps}} Mbps</td><td class="num">{{.Bytes}}</td><td class="num">{{.Duration}}</td><td>{{.Loaded}}</td><td>{{.Status}}</td></tr>
+{{end}}</table>
+{{range .Rounds}}<h3>{{.Name}}</h3>
+<div class="charts">
+<div class="card"><h4>{{$.L.overtime}}</h4>{{.Throughput}}</div>
+<div class="card"><h4>{{$.L.loaded}} · {{$.L.dist}}</h4>{{.Distribution}}</div>
+</div>
+{{end}}{{end}}
+</main>
+</body>
+</html>
+`))
@@ -0,0 +1,96 @@
+package output
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/i18n"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/runner"
+)
+
+func TestRenderHTMLSelfContained(t *testing.T) {
+	result := testResult()
+	rtt := 12.5
+	result.Candidates = []runner.CandidateResult{
+		{IP: "17.253.85.205", Description: "Tokyo <JP>", RTTMs: &rtt, Source: "doh", Status: "ok"},
+		{IP: "17.253.85.206", Source: "doh", Status: "degraded"},
+	}
+	result.IdleLatency.SamplesMs = []float64{10, 11, 12, 12, 16}
+	result.Rounds[0].Timeline = []runner.ThroughputSample{
+		{ElapsedMs: 500, Bytes: 5000000, Mbps: 80},
+		{ElapsedMs: 1000, Bytes: 12000000, Mbps: 112},
+	}
+
+	var buf bytes.Buffer
+	if err := RenderHTML(&buf, result); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"<!DOCTYPE html>",
+		`<tr class="selected"><td>1</td><td>17.253.85.205</td>`,
+		"Tokyo &lt;JP&gt;",
+		`<polyline class="line"`,
+		`<rect class="bar"`,
+		"AS714 Apple Inc.",
+		"mixed_hosts",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report missing %q", want)
+		}
+	}
+	for _, external := range []string{"<script src", "<link ", "https://cdn", "@import"} {
+		if strings.Contains(out, external) {
+			t.Errorf("report must not reference external assets, found %q", external)
+		}
+	}
+}
+
+func TestRenderHTMLDualStack(t *testing.T) {
+	oldLang := i18n.Lang()
+	defer i18n.Set(oldLang)
+	i18n.Set("en")
+
+	var buf bytes.Buffer
+	if err := RenderHTML(&buf, testDualStackResult()); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"<td>IPv4</td><td>17.253.85.205</td>",
+		"<td>IPv6</td><td>2403:300:a42::1</td>",
+		`<td class="num">120.00 Mbps</td>`,
+		"<li>IPv6 vs IPv4 download: &#43;20 Mbps</li>",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("report missing %q", want)
+		}
+	}
+
+	buf.Reset()
+	if err := RenderHTML(&buf, testResult()); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(buf.String(), "<td>IPv6</td>") {
+		t.Error("single-stack report should not have a dual-stack section")
+	}
+}
+
+func TestHistogramChartEmpty(t *testing.T) {
+	if out := string(histogramChart(nil)); !strings.Contains(out, "No samples") {
+		t.Fatalf("expected placeholder chart, got %s", out)
+	}
+	if out := string(histogramChart([]float64{5, 5, 5})); !strings.Contains(out, `<rect class="bar"`) {
+		t.Fatalf("identical samples should produce a single bar, got %s", out)
+	}
+}
+
+func TestNiceCeil(t *testing.T) {
+	tests := map[float64]float64{0: 1, 0.7: 1, 3: 5, 12: 20, 95: 100, 940: 1000}
+	for in, want := range tests {
+		if got := niceCeil(in); got != want {
+			t.Errorf("niceCeil(%v) = %v, want %v", in, got, want)
+		}
+	}
+}
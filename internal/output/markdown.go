@@ -0,0 +1,212 @@
+package output
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/config"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/i18n"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/runner"
+)
+
+// WriteMarkdown writes the run summary as GitHub-flavoured Markdown tables,
+// mirroring what the terminal summary shows, for pasting into issues or CI
+// job summaries.
+func WriteMarkdown(w io.Writer, result runner.RunResult) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintf(bw, "## %s\n\n", i18n.Text("\U0001f4ca Speed Test Summary", "\U0001f4ca 测速汇总"))
+
+	fmt.Fprintf(bw, "| %s | %s |\n|---|---|\n", i18n.Text("Item", "项目"), i18n.Text("Value", "值"))
+	if result.ConnectionInfo.Host != "" {
+		mdRow(bw, i18n.Text("Host", "域名"), "`"+result.ConnectionInfo.Host+"`")
+	}
+	mdRow(bw, i18n.Text("Endpoint", "节点"), endpointCell(result.SelectedEndpoint))
+	if server := result.ConnectionInfo.Server; server.Status == "ok" {
+		mdRow(bw, i18n.Text("Server", "服务端"), peerCell(server))
+	}
+	if client := result.ConnectionInfo.Client; client.Status == "ok" {
+		mdRow(bw, i18n.Text("Client", "客户端"), peerCell(client))
+	}
+	mdRow(bw, i18n.Text("Idle Latency", "空载延迟"), latencyCell(result.IdleLatency))
+	mdRow(bw, i18n.Text("Data Used", "消耗流量"), config.HumanBytes(result.TotalBytes))
+	if result.StartedAt != "" {
+		mdRow(bw, i18n.Text("Started", "开始时间"), result.StartedAt)
+	}
+
+	if len(result.Rounds) > 0 {
+		fmt.Fprintf(bw, "\n### %s\n\n", i18n.Text("Throughput", "吞吐"))
+		fmt.Fprintf(bw, "| %s | %s | %s | %s | %s | %s |\n|---|---:|---:|---:|---|---|\n",
+			i18n.Text("Round", "轮次"),
+			"Mbps",
+			i18n.Text("Data", "流量"),
+			i18n.Text("Time", "耗时"),
+			i18n.Text("Loaded Latency", "负载延迟"),
+			i18n.Text("Status", "状态"))
+		for _, round := range result.Rounds {
+			name := round.Name
+			if round.Threads > 1 {
+				name = fmt.Sprintf(i18n.Text("%s, %d threads", "%s，%d 线程"), name, round.Threads)
+			}
+			fmt.Fprintf(bw, "| %s | %.0f | %s | %.1fs | %s | %s |\n",
+				mdEscape(name),
+				round.Mbps,
+				config.HumanBytes(round.TotalBytes),
+				float64(round.DurationMs)/1000,
+				latencyCell(round.LoadedLatency),
+				mdEscape(statusCell(round.Status, round.Error)))
+		}
+	}
+
+	if len(result.Comparison) > 0 {
+		fmt.Fprintf(bw, "\n### %s\n\n", i18n.Text("Endpoint Comparison", "节点对比"))
+		fmt.Fprintf(bw, "| # | %s | %s | %s | %s |\n|---:|---|---|---:|---:|\n",
+			i18n.Text("Endpoint", "节点"),
+			i18n.Text("Idle Latency", "空载延迟"),
+			i18n.Text("Download", "下载"),
+			i18n.Text("Upload", "上传"))
+		for _, entry := range result.Comparison {
+			fmt.Fprintf(bw, "| %d | %s | %s | %.0f Mbps | %.0f Mbps |\n",
+				entry.Rank, endpointCell(entry.Endpoint), latencyCell(entry.IdleLatency), entry.DownloadMbps, entry.UploadMbps)
+		}
+	}
+
+	if ds := result.DualStack; ds != nil && len(ds.Families) > 0 {
+		fmt.Fprintf(bw, "\n### %s\n\n", i18n.Text("Dual-Stack Comparison", "双栈对比"))
+		fmt.Fprintf(bw, "| %s | %s | %s | %s | %s |\n|---|---|---|---:|---:|\n",
+			i18n.Text("Family", "协议"),
+			i18n.Text("Endpoint", "节点"),
+			i18n.Text("Idle Latency", "空载延迟"),
+			i18n.Text("Download", "下载"),
+			i18n.Text("Upload", "上传"))
+		for _, f := range ds.Families {
+			fmt.Fprintf(bw, "| IPv%d | %s | %s | %.0f Mbps | %.0f Mbps |\n",
+				f.Family, endpointCell(f.Endpoint), latencyCell(f.IdleLatency), f.DownloadMbps, f.UploadMbps)
+		}
+		if deltas := dualStackDeltas(ds); len(deltas) > 0 {
+			fmt.Fprintln(bw)
+			for _, delta := range deltas {
+				fmt.Fprintf(bw, "- %s\n", delta)
+			}
+		}
+	}
+
+	if len(result.ECSMapping) > 0 {
+		fmt.Fprintf(bw, "\n### %s\n\n", i18n.Text("ECS Mapping", "ECS 映射"))
+		fmt.Fprintf(bw, "| %s | %s | %s |\n|---|---|---|\n",
+			i18n.Text("Subnet", "子网"),
+			i18n.Text("Scope", "作用域"),
+			i18n.Text("Endpoints", "节点"))
+		for _, mapping := range result.ECSMapping {
+			scope := "-"
+			if mapping.ScopePrefix != nil {
+				scope = fmt.Sprintf("/%d", *mapping.ScopePrefix)
+			}
+			cells := make([]string, 0, len(mapping.Endpoints))
+			for _, ep := range mapping.Endpoints {
+				cells = append(cells, strings.TrimSpace("`"+ep.IP+"` "+mdEscape(ep.Description)))
+			}
+			if len(cells) == 0 {
+				cells = append(cells, mdEscape(statusCell(mapping.Status, mapping.Error)))
+			}
+			fmt.Fprintf(bw, "| `%s` | %s | %s |\n", mapping.Subnet, scope, strings.Join(cells, "<br>"))
+		}
+	}
+
+	if len(result.Warnings) > 0 {
+		fmt.Fprintf(bw, "\n### %s\n\n", i18n.Text("Warnings", "告警"))
+		for _, warning := range result.Warnings {
+			fmt.Fprintf(bw, "- `%s` %s\n", warning.Code, mdEscape(warning.Message))
+		}
+	}
+
+	fmt.Fprintln(bw)
+	if result.Degraded {
+		fmt.Fprintf(bw, "> ⚠️ %s\n", i18n.Text("Completed with degraded results.", "测速完成，但结果存在降级。"))
+	} else {
+		fmt.Fprintf(bw, "> ✅ %s\n", i18n.Text("All tests complete.", "所有测试完成。"))
+	}
+	return bw.Flush()
+}
+
+func mdRow(w io.Writer, key, value string) {
+	fmt.Fprintf(w, "| %s | %s |\n", mdEscape(key), value)
+}
+
+func endpointCell(ep runner.SelectedEndpoint) string {
+	if ep.IP == "" {
+		return i18n.Text("system resolver", "系统解析")
+	}
+	cell := "`" + ep.IP + "`"
+	if ep.Source != "" {
+		cell += " (" + mdEscape(ep.Source) + ")"
+	}
+	if ep.Description != "" {
+		cell += " " + mdEscape(ep.Description)
+	}
+	return cell
+}
+
+func peerCell(peer runner.PeerInfo) string {
+	parts := make([]string, 0, 3)
+	for _, part := range []string{peer.ASN, peer.ISP, peer.Location} {
+		if part != "" && !containsString(parts, part) {
+			parts = append(parts, part)
+		}
+	}
+	cell := mdEscape(strings.Join(parts, " · "))
+	if peer.IP != "" {
+		cell = strings.TrimSpace("`" + peer.IP + "` " + cell)
+	}
+	return cell
+}
+
+func latencyCell(l runner.LatencyResult) string {
+	if l.Status != "ok" || l.MedianMs == nil {
+		return i18n.Text("unavailable", "不可用")
+	}
+	jitter := 0.0
+	if l.JitterMs != nil {
+		jitter = *l.JitterMs
+	}
+	return fmt.Sprintf(i18n.Text("%.2f ms (jitter %.2f ms)", "%.2f 毫秒（抖动 %.2f 毫秒）"), *l.MedianMs, jitter)
+}
+
+// dualStackDeltas describes the IPv6 minus IPv4 differences that both
+// families produced a value for.
+func dualStackDeltas(ds *runner.DualStackResult) []string {
+	var out []string
+	if ds.DownloadDeltaMbps != nil {
+		out = append(out, fmt.Sprintf(i18n.Text("IPv6 vs IPv4 download: %+.0f Mbps", "IPv6 相对 IPv4 下载: %+.0f Mbps"), *ds.DownloadDeltaMbps))
+	}
+	if ds.UploadDeltaMbps != nil {
+		out = append(out, fmt.Sprintf(i18n.Text("IPv6 vs IPv4 upload: %+.0f Mbps", "IPv6 相对 IPv4 上传: %+.0f Mbps"), *ds.UploadDeltaMbps))
+	}
+	if ds.IdleLatencyDeltaMs != nil {
+		out = append(out, fmt.Sprintf(i18n.Text("IPv6 vs IPv4 idle latency: %+.2f ms", "IPv6 相对 IPv4 空载延迟: %+.2f 毫秒"), *ds.IdleLatencyDeltaMs))
+	}
+	return out
+}
+
+func statusCell(status, errText string) string {
+	if errText != "" {
+		return status + ": " + errText
+	}
+	return status
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+var mdEscaper = strings.NewReplacer("|", `\|`, "\r\n", " ", "\n", " ")
+
+// mdEscape keeps free text from breaking out of a table cell.
+func mdEscape(s string) string { return mdEscaper.Replace(s) }
@@ -0,0 +1,95 @@
+package output
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/i18n"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/runner"
+)
+
+func TestWriteMarkdown(t *testing.T) {
+	oldLang := i18n.Lang()
+	defer i18n.Set(oldLang)
+	i18n.Set("en")
+
+	var buf bytes.Buffer
+	result := testResult()
+	result.Rounds[0].Error = "a|b"
+	result.Comparison = []runner.EndpointResult{{Rank: 1, Endpoint: result.SelectedEndpoint, IdleLatency: result.IdleLatency, DownloadMbps: 100, UploadMbps: 20}}
+	scope := 24
+	result.ECSMapping = []runner.SubnetMappingResult{
+		{Subnet: "203.0.113.0/24", ScopePrefix: &scope, Status: "ok", Endpoints: []runner.MappedEndpoint{{IP: "17.253.85.205", Description: "Tokyo"}, {IP: "17.253.85.206"}}},
+		{Subnet: "198.51.100.0/24", Status: "failed", Error: "timeout"},
+	}
+	if err := WriteMarkdown(&buf, result); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"## \U0001f4ca Speed Test Summary\n",
+		"| Endpoint | `17.253.85.205` (doh) |\n",
+		"| Idle Latency | 12.00 ms (jitter 2.00 ms) |\n",
+		"| Round | Mbps | Data | Time | Loaded Latency | Status |\n|---|---:|---:|---:|---|---|\n",
+		"| Download (single thread) | 100 | 119.2 MiB | 10.0s | 45.00 ms (jitter 10.00 ms) | ok: a\\|b |\n",
+		"| 1 | `17.253.85.205` (doh) | 12.00 ms (jitter 2.00 ms) | 100 Mbps | 20 Mbps |\n",
+		"| `203.0.113.0/24` | /24 | `17.253.85.205` Tokyo<br>`17.253.85.206` |\n",
+		"| `198.51.100.0/24` | - | failed: timeout |\n",
+		"- `mixed_hosts` x\n",
+		"> ⚠️ Completed with degraded results.\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q\n%s", want, out)
+		}
+	}
+}
+
+func TestWriteMarkdownDualStack(t *testing.T) {
+	oldLang := i18n.Lang()
+	defer i18n.Set(oldLang)
+	i18n.Set("en")
+
+	var buf bytes.Buffer
+	if err := WriteMarkdown(&buf, testDualStackResult()); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"### Dual-Stack Comparison\n",
+		"| IPv4 | `17.253.85.205` (doh) | 12.00 ms (jitter 2.00 ms) | 100 Mbps | 0 Mbps |\n",
+		"| IPv6 | `2403:300:a42::1` (doh) | 15.00 ms (jitter 0.00 ms) | 120 Mbps | 0 Mbps |\n",
+		"- IPv6 vs IPv4 download: +20 Mbps\n",
+		"- IPv6 vs IPv4 idle latency: +3.00 ms\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "IPv6 vs IPv4 upload") {
+		t.Errorf("upload delta should be omitted without upload results\n%s", out)
+	}
+}
+
+func TestWriteMarkdownChinese(t *testing.T) {
+	oldLang := i18n.Lang()
+	defer i18n.Set(oldLang)
+	i18n.Set("zh")
+
+	var buf bytes.Buffer
+	result := testResult()
+	result.Degraded = false
+	result.Warnings = nil
+	if err := WriteMarkdown(&buf, result); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{"测速汇总", "| 空载延迟 | 12.00 毫秒（抖动 2.00 毫秒） |", "> ✅ 所有测试完成。"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "告警") {
+		t.Errorf("warnings section should be omitted\n%s", out)
+	}
+}
@@ -0,0 +1,83 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/config"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/fsx"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/runner"
+)
+
+// Write renders result to the destination described by o. Streaming
+// formats such as ndjson are rendered during the run and are not handled
+// here.
+func Write(cfg *config.Config, o config.Output, result runner.RunResult) error {
+	switch o.Format {
+	case config.OutputPromTextfile:
+		return WritePromTextfile(o.Path, result)
+	case config.OutputCSV, config.OutputTSV:
+		comma := ','
+		if o.Format == config.OutputTSV {
+			comma = '\t'
+		}
+		w, existed, err := Open(o.Path, cfg.OutputAppend)
+		if err != nil {
+			return err
+		}
+		err = WriteCSV(w, result, comma, !cfg.NoHeader && !existed)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	case config.OutputMarkdown:
+		w, _, err := Open(o.Path, cfg.OutputAppend)
+		if err != nil {
+			return err
+		}
+		err = WriteMarkdown(w, result)
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		return err
+	default:
+		return fmt.Errorf("unsupported output format %q", o.Format)
+	}
+}
+
+// Open returns the writer for an --output destination: stdout when path is
+// empty, otherwise the file, truncated or appended to. existed reports
+// whether appending to a file that already had content.
+func Open(path string, appendMode bool) (w io.WriteCloser, existed bool, err error) {
+	if path == "" {
+		return nopCloser{os.Stdout}, false, nil
+	}
+	if !appendMode {
+		f, err := os.Create(path)
+		return f, false, err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, false, err
+	}
+	if fi, err := f.Stat(); err == nil && fi.Size() > 0 {
+		existed = true
+	}
+	return f, existed, nil
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// WritePromTextfile writes result in Prometheus exposition format for the
+// node_exporter textfile collector. The file is written next to path and
+// renamed into place so the collector never reads a partial file.
+func WritePromTextfile(path string, result runner.RunResult) error {
+	return fsx.WriteAtomic(path, func(f io.Writer) error {
+		enc := NewPromEncoder(f, false)
+		enc.Result(result)
+		return enc.Close()
+	})
+}
@@ -0,0 +1,304 @@
+package output
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/runner"
+)
+
+const (
+	PromContentType        = "text/plain; version=0.0.4; charset=utf-8"
+	OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+)
+
+type Label struct {
+	Name  string
+	Value string
+}
+
+// PromEncoder writes metric families in the Prometheus text exposition
+// format, or in OpenMetrics when OpenMetrics is set.
+type PromEncoder struct {
+	w           io.Writer
+	openMetrics bool
+	err         error
+}
+
+func NewPromEncoder(w io.Writer, openMetrics bool) *PromEncoder {
+	return &PromEncoder{w: w, openMetrics: openMetrics}
+}
+
+func (e *PromEncoder) Family(name, typ, help string) {
+	if e.openMetrics && typ == "counter" {
+		name = strings.TrimSuffix(name, "_total")
+	}
+	e.printf("# HELP %s %s\n", name, escapeHelp(help))
+	e.printf("# TYPE %s %s\n", name, typ)
+}
+
+func (e *PromEncoder) Sample(name string, labels []Label, v float64) {
+	e.printf("%s%s %s\n", name, formatLabels(labels), formatValue(v))
+}
+
+func (e *PromEncoder) Close() error {
+	if e.openMetrics {
+		e.printf("# EOF\n")
+	}
+	return e.err
+}
+
+func (e *PromEncoder) printf(format string, args ...any) {
+	if e.err != nil {
+		return
+	}
+	_, e.err = fmt.Fprintf(e.w, format, args...)
+}
+
+// Result writes the metric families describing one completed run.
+func (e *PromEncoder) Result(result runner.RunResult) {
+	endpoint := []Label{
+		{"endpoint", result.SelectedEndpoint.IP},
+		{"asn", asNumber(result.ConnectionInfo.Server.ASN)},
+	}
+
+	e.Family("inetspeed_run_info", "gauge", "Endpoint and connection details of the last run.")
+	e.Sample("inetspeed_run_info", []Label{
+		{"host", result.ConnectionInfo.Host},
+		{"endpoint", result.SelectedEndpoint.IP},
+		{"endpoint_source", result.SelectedEndpoint.Source},
+		{"endpoint_status", result.SelectedEndpoint.Status},
+		{"asn", asNumber(result.ConnectionInfo.Server.ASN)},
+		{"client_asn", asNumber(result.ConnectionInfo.Client.ASN)},
+	}, 1)
+
+	if started, err := time.Parse(time.RFC3339Nano, result.StartedAt); err == nil {
+		e.Family("inetspeed_run_timestamp_seconds", "gauge", "Unix time the last run started.")
+		e.Sample("inetspeed_run_timestamp_seconds", nil, float64(started.UnixNano())/1e9)
+	}
+	e.Family("inetspeed_run_duration_seconds", "gauge", "Wall time of the last run.")
+	e.Sample("inetspeed_run_duration_seconds", nil, float64(result.DurationMs)/1000)
+	e.Family("inetspeed_degraded", "gauge", "Whether the last run completed with degraded results.")
+	e.Sample("inetspeed_degraded", nil, boolValue(result.Degraded))
+	e.Family("inetspeed_exit_code", "gauge", "Exit code of the last run.")
+	e.Sample("inetspeed_exit_code", nil, float64(result.ExitCode))
+	e.Family("inetspeed_data_used_bytes", "gauge", "Bytes transferred by all rounds of the last run.")
+	e.Sample("inetspeed_data_used_bytes", nil, float64(result.TotalBytes))
+
+	if len(result.Warnings) > 0 {
+		// One series per code: a run can raise the same warning more than
+		// once, and duplicate series would make the exposition invalid.
+		var codes []string
+		counts := map[string]int{}
+		for _, warning := range result.Warnings {
+			if counts[warning.Code] == 0 {
+				codes = append(codes, warning.Code)
+			}
+			counts[warning.Code]++
+		}
+		e.Family("inetspeed_warning", "gauge", "Warnings raised by the last run, by code.")
+		for _, code := range codes {
+			e.Sample("inetspeed_warning", []Label{{"code", code}}, float64(counts[code]))
+		}
+	}
+
+	e.latency("inetspeed_idle_latency_seconds", "inetspeed_idle_jitter_seconds", "Idle", []runner.LatencyResult{result.IdleLatency}, [][]Label{endpoint})
+	if result.DualStack != nil {
+		e.dualStack(*result.DualStack)
+	}
+	if len(result.Comparison) > 0 {
+		e.comparison(result.Comparison)
+	}
+
+	if len(result.Rounds) == 0 {
+		return
+	}
+	roundLabels := make([][]Label, 0, len(result.Rounds))
+	loaded := make([]runner.LatencyResult, 0, len(result.Rounds))
+	for _, round := range result.Rounds {
+		roundLabels = append(roundLabels, append([]Label{
+			{"direction", round.Direction},
+			{"threads", strconv.Itoa(round.Threads)},
+		}, endpoint...))
+		loaded = append(loaded, round.LoadedLatency)
+	}
+
+	e.Family("inetspeed_throughput_bits_per_second", "gauge", "Measured throughput per round.")
+	for i, round := range result.Rounds {
+		e.Sample("inetspeed_throughput_bits_per_second", roundLabels[i], round.Mbps*1_000_000)
+	}
+	e.Family("inetspeed_round_bytes", "gauge", "Bytes transferred per round.")
+	for i, round := range result.Rounds {
+		e.Sample("inetspeed_round_bytes", roundLabels[i], float64(round.TotalBytes))
+	}
+	e.Family("inetspeed_round_duration_seconds", "gauge", "Duration of each round.")
+	for i, round := range result.Rounds {
+		e.Sample("inetspeed_round_duration_seconds", roundLabels[i], float64(round.DurationMs)/1000)
+	}
+	e.Family("inetspeed_round_faults", "gauge", "Threads that hit a network fault per round.")
+	for i, round := range result.Rounds {
+		e.Sample("inetspeed_round_faults", roundLabels[i], float64(round.FaultCount))
+	}
+	e.Family("inetspeed_round_success", "gauge", "Whether each round completed with status ok.")
+	for i, round := range result.Rounds {
+		e.Sample("inetspeed_round_success", roundLabels[i], boolValue(round.Status == "ok"))
+	}
+	e.latency("inetspeed_loaded_latency_seconds", "inetspeed_loaded_jitter_seconds", "Loaded", loaded, roundLabels)
+}
+
+// dualStack writes the per-family summary of a --dual-stack run. The
+// top-level series describe the IPv4 run only.
+func (e *PromEncoder) dualStack(ds runner.DualStackResult) {
+	if len(ds.Families) == 0 {
+		return
+	}
+	labels := func(f runner.FamilyResult, extra ...Label) []Label {
+		return append([]Label{{"family", strconv.Itoa(f.Family)}, {"endpoint", f.Endpoint.IP}}, extra...)
+	}
+	e.Family("inetspeed_family_throughput_bits_per_second", "gauge", "Best throughput per address family of a dual-stack run.")
+	for _, f := range ds.Families {
+		e.Sample("inetspeed_family_throughput_bits_per_second", labels(f, Label{"direction", "download"}), f.DownloadMbps*1_000_000)
+		e.Sample("inetspeed_family_throughput_bits_per_second", labels(f, Label{"direction", "upload"}), f.UploadMbps*1_000_000)
+	}
+	e.Family("inetspeed_family_idle_latency_seconds", "gauge", "Median idle latency per address family of a dual-stack run.")
+	for _, f := range ds.Families {
+		if f.IdleLatency.Status == "ok" && f.IdleLatency.MedianMs != nil {
+			e.Sample("inetspeed_family_idle_latency_seconds", labels(f), *f.IdleLatency.MedianMs/1000)
+		}
+	}
+	e.Family("inetspeed_family_degraded", "gauge", "Whether each address family of a dual-stack run was degraded.")
+	for _, f := range ds.Families {
+		e.Sample("inetspeed_family_degraded", labels(f), boolValue(f.Degraded))
+	}
+
+	if ds.DownloadDeltaMbps != nil || ds.UploadDeltaMbps != nil {
+		e.Family("inetspeed_dual_stack_throughput_delta_bits_per_second", "gauge", "IPv6 minus IPv4 throughput of a dual-stack run.")
+		if ds.DownloadDeltaMbps != nil {
+			e.Sample("inetspeed_dual_stack_throughput_delta_bits_per_second", []Label{{"direction", "download"}}, *ds.DownloadDeltaMbps*1_000_000)
+		}
+		if ds.UploadDeltaMbps != nil {
+			e.Sample("inetspeed_dual_stack_throughput_delta_bits_per_second", []Label{{"direction", "upload"}}, *ds.UploadDeltaMbps*1_000_000)
+		}
+	}
+	if ds.IdleLatencyDeltaMs != nil {
+		e.Family("inetspeed_dual_stack_idle_latency_delta_seconds", "gauge", "IPv6 minus IPv4 median idle latency of a dual-stack run.")
+		e.Sample("inetspeed_dual_stack_idle_latency_delta_seconds", nil, *ds.IdleLatencyDeltaMs/1000)
+	}
+}
+
+// comparison writes one sample per endpoint measured by
+// --compare-endpoints. The top-level series describe the best one only.
+// The rank is a value rather than a label so a change in order does not
+// start new series.
+func (e *PromEncoder) comparison(entries []runner.EndpointResult) {
+	e.Family("inetspeed_endpoint_throughput_bits_per_second", "gauge", "Best throughput per compared endpoint.")
+	for _, entry := range entries {
+		ip := Label{"ip", entry.Endpoint.IP}
+		e.Sample("inetspeed_endpoint_throughput_bits_per_second", []Label{ip, {"direction", "download"}}, entry.DownloadMbps*1_000_000)
+		e.Sample("inetspeed_endpoint_throughput_bits_per_second", []Label{ip, {"direction", "upload"}}, entry.UploadMbps*1_000_000)
+	}
+	e.Family("inetspeed_endpoint_idle_latency_seconds", "gauge", "Median idle latency per compared endpoint.")
+	for _, entry := range entries {
+		if entry.IdleLatency.Status == "ok" && entry.IdleLatency.MedianMs != nil {
+			e.Sample("inetspeed_endpoint_idle_latency_seconds", []Label{{"ip", entry.Endpoint.IP}}, *entry.IdleLatency.MedianMs/1000)
+		}
+	}
+	e.Family("inetspeed_endpoint_rank", "gauge", "Rank of each compared endpoint, 1 being the best.")
+	for _, entry := range entries {
+		e.Sample("inetspeed_endpoint_rank", []Label{{"ip", entry.Endpoint.IP}}, float64(entry.Rank))
+	}
+	e.Family("inetspeed_endpoint_degraded", "gauge", "Whether each compared endpoint was degraded.")
+	for _, entry := range entries {
+		e.Sample("inetspeed_endpoint_degraded", []Label{{"ip", entry.Endpoint.IP}}, boolValue(entry.Degraded))
+	}
+}
+
+func (e *PromEncoder) latency(name, jitterName, kind string, results []runner.LatencyResult, labels [][]Label) {
+	ok := false
+	for _, result := range results {
+		if result.Status == "ok" {
+			ok = true
+		}
+	}
+	if !ok {
+		return
+	}
+	e.Family(name, "summary", kind+" latency quantiles (0 = min, 0.5 = median, 1 = max).")
+	for i, result := range results {
+		if result.Status != "ok" {
+			continue
+		}
+		for _, q := range []struct {
+			quantile string
+			value    *float64
+		}{{"0", result.MinMs}, {"0.5", result.MedianMs}, {"1", result.MaxMs}} {
+			if q.value == nil {
+				continue
+			}
+			e.Sample(name, append(append([]Label(nil), labels[i]...), Label{"quantile", q.quantile}), *q.value/1000)
+		}
+		if result.AvgMs != nil {
+			e.Sample(name+"_sum", labels[i], *result.AvgMs*float64(result.Samples)/1000)
+		}
+		e.Sample(name+"_count", labels[i], float64(result.Samples))
+	}
+	e.Family(jitterName, "gauge", kind+" latency jitter.")
+	for i, result := range results {
+		if result.Status != "ok" || result.JitterMs == nil {
+			continue
+		}
+		e.Sample(jitterName, labels[i], *result.JitterMs/1000)
+	}
+}
+
+var asnRe = regexp.MustCompile(`^AS\d+`)
+
+// asNumber reduces an "AS714 Apple Inc." style description to "AS714" so
+// the label stays stable when the provider changes the organisation name.
+func asNumber(s string) string {
+	if m := asnRe.FindString(strings.TrimSpace(s)); m != "" {
+		return m
+	}
+	return ""
+}
+
+func formatLabels(labels []Label) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	parts := make([]string, 0, len(labels))
+	for _, label := range labels {
+		parts = append(parts, label.Name+`="`+escapeLabel(label.Value)+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+
+func boolValue(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,268 @@
+package output
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/config"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/runner"
+)
+
+func testResult() runner.RunResult {
+	ms := func(v float64) *float64 { return &v }
+	return runner.RunResult{
+		SchemaVersion:    1,
+		SelectedEndpoint: runner.SelectedEndpoint{IP: "17.253.85.205", Source: "doh", Status: "ok"},
+		ConnectionInfo: runner.ConnectionInfo{
+			Status: "ok",
+			Host:   "mensura.cdn-apple.com",
+			Client: runner.PeerInfo{Status: "ok", ASN: "AS4134 CHINANET"},
+			Server: runner.PeerInfo{Status: "ok", ASN: "AS714 Apple Inc."},
+		},
+		IdleLatency: runner.LatencyResult{Status: "ok", Samples: 4, MinMs: ms(10), AvgMs: ms(12.5), MedianMs: ms(12), MaxMs: ms(16), JitterMs: ms(2)},
+		Rounds: []runner.RoundResult{{
+			Name:       "Download (single thread)",
+			Direction:  "download",
+			Threads:    1,
+			Status:     "ok",
+			TotalBytes: 125000000,
+			DurationMs: 10000,
+			Mbps:       100,
+			LoadedLatency: runner.LatencyResult{
+				Status: "ok", Samples: 2, MinMs: ms(40), AvgMs: ms(45), MedianMs: ms(45), MaxMs: ms(50), JitterMs: ms(10),
+			},
+		}},
+		TotalBytes: 125000000,
+		Warnings:   []runner.Warning{{Code: "mixed_hosts", Message: "x"}},
+		Degraded:   true,
+		ExitCode:   2,
+		StartedAt:  "2026-03-15T00:00:00Z",
+		DurationMs: 12500,
+	}
+}
+
+// testDualStackResult is testResult as a --dual-stack run: the top level
+// repeats the IPv4 run and the IPv6 run only appears under DualStack.
+func testDualStackResult() runner.RunResult {
+	ms := func(v float64) *float64 { return &v }
+	result := testResult()
+	v6 := runner.FamilyResult{
+		Family:       6,
+		Endpoint:     runner.SelectedEndpoint{IP: "2403:300:a42::1", Source: "doh", Status: "ok"},
+		IdleLatency:  runner.LatencyResult{Status: "ok", Samples: 4, MedianMs: ms(15)},
+		Rounds:       []runner.RoundResult{{Name: "Download (single thread)", Direction: "download", Threads: 1, Status: "ok", TotalBytes: 150000000, DurationMs: 10000, Mbps: 120}},
+		DownloadMbps: 120,
+		TotalBytes:   150000000,
+		Server:       runner.PeerInfo{Status: "ok", ASN: "AS714 Apple Inc."},
+	}
+	result.DualStack = &runner.DualStackResult{
+		Families: []runner.FamilyResult{{
+			Family:       4,
+			Endpoint:     result.SelectedEndpoint,
+			IdleLatency:  result.IdleLatency,
+			Rounds:       result.Rounds,
+			DownloadMbps: 100,
+			TotalBytes:   result.TotalBytes,
+			Server:       result.ConnectionInfo.Server,
+		}, v6},
+		DownloadDeltaMbps:  ms(20),
+		IdleLatencyDeltaMs: ms(3),
+	}
+	return result
+}
+
+// testComparisonResult is testResult as a --compare-endpoints run of two
+// endpoints; the top level repeats the best one.
+func testComparisonResult() runner.RunResult {
+	ms := func(v float64) *float64 { return &v }
+	result := testResult()
+	result.Comparison = []runner.EndpointResult{
+		{Rank: 1, Endpoint: result.SelectedEndpoint, IdleLatency: result.IdleLatency, Rounds: result.Rounds, DownloadMbps: 100, TotalBytes: result.TotalBytes},
+		{
+			Rank:         2,
+			Endpoint:     runner.SelectedEndpoint{IP: "17.253.85.206", Source: "doh", Status: "ok"},
+			IdleLatency:  runner.LatencyResult{Status: "ok", Samples: 4, MedianMs: ms(20)},
+			Rounds:       []runner.RoundResult{{Name: "Download (single thread)", Direction: "download", Threads: 1, Status: "degraded", TotalBytes: 50000000, DurationMs: 10000, Mbps: 40}},
+			DownloadMbps: 40,
+			TotalBytes:   50000000,
+			Degraded:     true,
+		},
+	}
+	return result
+}
+
+func TestPromEncoderResult(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewPromEncoder(&buf, false)
+	enc.Result(testResult())
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"# TYPE inetspeed_throughput_bits_per_second gauge\n",
+		`inetspeed_throughput_bits_per_second{direction="download",threads="1",endpoint="17.253.85.205",asn="AS714"} 1e+08`,
+		`inetspeed_idle_latency_seconds{endpoint="17.253.85.205",asn="AS714",quantile="0.5"} 0.012`,
+		`inetspeed_idle_latency_seconds_count{endpoint="17.253.85.205",asn="AS714"} 4`,
+		`inetspeed_loaded_jitter_seconds{direction="download",threads="1",endpoint="17.253.85.205",asn="AS714"} 0.01`,
+		"inetspeed_data_used_bytes 1.25e+08\n",
+		"inetspeed_degraded 1\n",
+		"inetspeed_run_timestamp_seconds 1.7735328e+09\n",
+		`inetspeed_warning{code="mixed_hosts"} 1`,
+		`client_asn="AS4134"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, "# EOF") {
+		t.Error("text format must not contain # EOF")
+	}
+}
+
+func TestPromEncoderGroupsWarnings(t *testing.T) {
+	result := testResult()
+	result.Warnings = []runner.Warning{
+		{Code: "round_degraded", Message: "download"},
+		{Code: "mixed_hosts", Message: "x"},
+		{Code: "round_degraded", Message: "upload"},
+	}
+	var buf bytes.Buffer
+	enc := NewPromEncoder(&buf, false)
+	enc.Result(result)
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if n := strings.Count(out, `inetspeed_warning{code="round_degraded"}`); n != 1 {
+		t.Fatalf("expected one round_degraded series, got %d\n%s", n, out)
+	}
+	for _, want := range []string{
+		`inetspeed_warning{code="round_degraded"} 2` + "\n",
+		`inetspeed_warning{code="mixed_hosts"} 1` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q\n%s", want, out)
+		}
+	}
+}
+
+func TestPromEncoderDualStack(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewPromEncoder(&buf, false)
+	enc.Result(testDualStackResult())
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`inetspeed_family_throughput_bits_per_second{family="4",endpoint="17.253.85.205",direction="download"} 1e+08` + "\n",
+		`inetspeed_family_throughput_bits_per_second{family="6",endpoint="2403:300:a42::1",direction="download"} 1.2e+08` + "\n",
+		`inetspeed_family_idle_latency_seconds{family="6",endpoint="2403:300:a42::1"} 0.015` + "\n",
+		`inetspeed_dual_stack_throughput_delta_bits_per_second{direction="download"} 2e+07` + "\n",
+		"inetspeed_dual_stack_idle_latency_delta_seconds 0.003\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q\n%s", want, out)
+		}
+	}
+	if strings.Contains(out, `inetspeed_dual_stack_throughput_delta_bits_per_second{direction="upload"}`) {
+		t.Errorf("upload delta should be omitted without upload results\n%s", out)
+	}
+
+	buf.Reset()
+	enc = NewPromEncoder(&buf, false)
+	enc.Result(testResult())
+	enc.Close()
+	if strings.Contains(buf.String(), "inetspeed_family_") {
+		t.Errorf("single-stack runs should not emit family series\n%s", buf.String())
+	}
+}
+
+func TestPromEncoderComparison(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewPromEncoder(&buf, false)
+	enc.Result(testComparisonResult())
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		`inetspeed_endpoint_throughput_bits_per_second{ip="17.253.85.205",direction="download"} 1e+08` + "\n",
+		`inetspeed_endpoint_throughput_bits_per_second{ip="17.253.85.206",direction="download"} 4e+07` + "\n",
+		`inetspeed_endpoint_idle_latency_seconds{ip="17.253.85.206"} 0.02` + "\n",
+		`inetspeed_endpoint_rank{ip="17.253.85.206"} 2` + "\n",
+		`inetspeed_endpoint_degraded{ip="17.253.85.206"} 1` + "\n",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output missing %q\n%s", want, out)
+		}
+	}
+	if n := strings.Count(out, "# TYPE inetspeed_endpoint_throughput_bits_per_second "); n != 1 {
+		t.Errorf("expected one endpoint throughput family, got %d", n)
+	}
+}
+
+func TestPromEncoderOpenMetrics(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewPromEncoder(&buf, true)
+	enc.Family("inetspeed_exporter_runs_total", "counter", "Runs.")
+	enc.Sample("inetspeed_exporter_runs_total", nil, 3)
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := "# HELP inetspeed_exporter_runs Runs.\n# TYPE inetspeed_exporter_runs counter\ninetspeed_exporter_runs_total 3\n# EOF\n"
+	if buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+}
+
+func TestFormatLabelsEscapes(t *testing.T) {
+	got := formatLabels([]Label{{"desc", "a\"b\\c\nd"}})
+	want := `{desc="a\"b\\c\nd"}`
+	if got != want {
+		t.Fatalf("formatLabels() = %s, want %s", got, want)
+	}
+}
+
+func TestASNumber(t *testing.T) {
+	tests := map[string]string{
+		"AS714 Apple Inc.": "AS714",
+		"AS13335":          "AS13335",
+		"unavailable":      "",
+		"":                 "",
+	}
+	for in, want := range tests {
+		if got := asNumber(in); got != want {
+			t.Errorf("asNumber(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestWritePromTextfileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "speedtest.prom")
+	if err := os.WriteFile(path, []byte("stale"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(&config.Config{}, config.Output{Format: config.OutputPromTextfile, Path: path}, testResult()); err != nil {
+		t.Fatalf("Write() error: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), "inetspeed_throughput_bits_per_second{") {
+		t.Fatalf("unexpected textfile contents:\n%s", data)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected temp file to be cleaned up, got %d entries", len(entries))
+	}
+}
@@ -0,0 +1,339 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/config"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/i18n"
+)
+
+const (
+	dashboardMaxCandidates = 5
+	dashboardMaxConns      = 8
+	dashboardMinWidth      = 40
+	dashboardMinHeight     = 12
+)
+
+var sparkRunes = []rune("▁▂▃▄▅▆▇█")
+
+// DashboardRenderer draws a full-screen view of the run on the alternate
+// screen and redraws it on every event: a throughput sparkline for the
+// current round, per-connection bars, loaded latency and the endpoint
+// candidates. Close leaves the alternate screen and replays the transcript
+// through the TTY renderer so the results stay in the scrollback.
+type DashboardRenderer struct {
+	mu      sync.Mutex
+	w       io.Writer
+	size    func() (int, int)
+	started bool
+
+	title      string
+	candidates []Candidate
+	selected   string
+	log        []Event
+
+	label     string
+	progress  Progress
+	rates     []float64
+	connRates []float64
+	prev      Progress
+}
+
+func NewDashboardRenderer() *DashboardRenderer {
+	return &DashboardRenderer{
+		w:    os.Stderr,
+		size: func() (int, int) { return termSize(os.Stderr.Fd()) },
+	}
+}
+
+func (d *DashboardRenderer) Render(ev Event) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch ev.Kind {
+	case KindProgress:
+		d.label = ev.Label
+		if p, ok := ev.Data.(Progress); ok {
+			d.addProgress(p)
+		}
+	case KindSync:
+	default:
+		if ev.Kind == KindHeader {
+			d.title = ev.Value
+			d.resetRound()
+		}
+		switch data := ev.Data.(type) {
+		case []Candidate:
+			d.candidates = append(d.candidates[:0], data...)
+		case Candidate:
+			if data.Selected {
+				d.selected = data.IP
+			}
+		}
+		d.log = append(d.log, ev)
+	}
+	d.draw()
+}
+
+// Close restores the normal screen and prints the run transcript.
+func (d *DashboardRenderer) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.started {
+		return
+	}
+	d.started = false
+	fmt.Fprint(d.w, "\033[?1049l")
+	tty := &TTYRenderer{w: d.w}
+	for _, ev := range d.log {
+		tty.Render(ev)
+	}
+}
+
+func (d *DashboardRenderer) resetRound() {
+	d.label = ""
+	d.progress = Progress{}
+	d.prev = Progress{}
+	d.rates = nil
+	d.connRates = nil
+}
+
+// addProgress turns cumulative counters into per-tick rates so the
+// sparkline shows how throughput evolved rather than the running average.
+func (d *DashboardRenderer) addProgress(p Progress) {
+	interval := (p.Elapsed - d.prev.Elapsed).Seconds()
+	if interval > 0 {
+		d.rates = append(d.rates, float64(p.Bytes-d.prev.Bytes)*8/(interval*1_000_000))
+		d.connRates = make([]float64, len(p.Conns))
+		for i, b := range p.Conns {
+			var before int64
+			if i < len(d.prev.Conns) {
+				before = d.prev.Conns[i]
+			}
+			d.connRates[i] = float64(b-before) * 8 / (interval * 1_000_000)
+		}
+	}
+	d.progress = p
+	d.prev = p
+}
+
+func (d *DashboardRenderer) draw() {
+	width, height := 0, 0
+	if d.size != nil {
+		width, height = d.size()
+	}
+	if width <= 0 {
+		width = 80
+	}
+	if height <= 0 {
+		height = 24
+	}
+	width = max(width, dashboardMinWidth)
+	height = max(height, dashboardMinHeight)
+
+	var lines []string
+	lines = append(lines, fmt.Sprintf("%s%s iNetSpeed-CLI%s  %s▸ %s%s", cCyan, cBold, cReset, cBold, d.title, cReset))
+	lines = append(lines, cDim+strings.Repeat("─", width)+cReset)
+
+	if len(d.candidates) > 0 {
+		lines = append(lines, cBold+i18n.Text("Endpoints", "候选节点")+cReset)
+		for i, c := range d.candidates {
+			if i == dashboardMaxCandidates {
+				lines = append(lines, fmt.Sprintf("%s    +%d%s", cDim, len(d.candidates)-i, cReset))
+				break
+			}
+			marker := " "
+			if c.IP != "" && c.IP == d.selected {
+				marker = cGreen + "▶" + cReset
+			}
+			lines = append(lines, fmt.Sprintf("  %s %d) %-39s %s", marker, i+1, c.IP, c.Label))
+		}
+	}
+
+	if d.label != "" {
+		p := d.progress
+		peak := 0.0
+		for _, r := range d.rates {
+			peak = max(peak, r)
+		}
+		cur := 0.0
+		if len(d.rates) > 0 {
+			cur = d.rates[len(d.rates)-1]
+		}
+		lines = append(lines, fmt.Sprintf(i18n.Text(
+			"%sThroughput%s [%s]  now %.1f Mbps  avg %.1f Mbps  peak %.1f Mbps  %s  %.1fs",
+			"%s吞吐%s [%s]  当前 %.1f Mbps  平均 %.1f Mbps  峰值 %.1f Mbps  %s  %.1fs"),
+			cBold, cReset, d.label, cur, p.Mbps, peak, config.HumanBytes(p.Bytes), p.Elapsed.Seconds()))
+		lines = append(lines, "  "+cGreen+sparkline(d.rates, width-4)+cReset)
+
+		if len(p.Conns) > 0 {
+			lines = append(lines, cBold+i18n.Text("Connections", "连接")+cReset)
+			var top int64
+			for _, b := range p.Conns {
+				top = max(top, b)
+			}
+			barWidth := width - 34
+			for i, b := range p.Conns {
+				if i == dashboardMaxConns {
+					lines = append(lines, fmt.Sprintf("%s    +%d%s", cDim, len(p.Conns)-i, cReset))
+					break
+				}
+				frac := 0.0
+				if top > 0 {
+					frac = float64(b) / float64(top)
+				}
+				rate := 0.0
+				if i < len(d.connRates) {
+					rate = d.connRates[i]
+				}
+				lines = append(lines, fmt.Sprintf("  #%-2d %s %10s %8.1f Mbps", i+1, bar(frac, barWidth), config.HumanBytes(b), rate))
+			}
+		}
+
+		if n := len(p.LoadedMs); n > 0 {
+			lines = append(lines, fmt.Sprintf(i18n.Text(
+				"%sLoaded latency%s  median %.2f ms  last %.2f ms  (%d samples)",
+				"%s负载延迟%s  中位数 %.2f 毫秒  最新 %.2f 毫秒  (%d 个样本)"),
+				cBold, cReset, median(p.LoadedMs), p.LoadedMs[n-1], n))
+			lines = append(lines, "  "+cYellow+sparkline(p.LoadedMs, width-4)+cReset)
+		}
+	}
+
+	// The last row is left empty for the endpoint prompt.
+	room := height - 1 - len(lines) - 1
+	if room > 0 {
+		lines = append(lines, cDim+strings.Repeat("─", width)+cReset)
+		var logLines []string
+		for _, ev := range d.log {
+			if ev.Kind != KindLine {
+				logLines = append(logLines, dashboardLogLine(ev))
+			}
+		}
+		lines = append(lines, logLines[max(len(logLines)-room, 0):]...)
+	}
+	if len(lines) > height-1 {
+		lines = lines[:height-1]
+	}
+
+	var b strings.Builder
+	if !d.started {
+		b.WriteString("\033[?1049h")
+		d.started = true
+	}
+	b.WriteString("\033[H")
+	for _, line := range lines {
+		b.WriteString(truncate(line, width))
+		b.WriteString("\033[K\r\n")
+	}
+	b.WriteString("\033[J")
+	fmt.Fprint(d.w, b.String())
+}
+
+func dashboardLogLine(ev Event) string {
+	switch ev.Kind {
+	case KindBanner:
+		return cCyan + cBold + ev.Value + cReset
+	case KindHeader:
+		return cCyan + cBold + "▸ " + ev.Value + cReset
+	case KindWarn:
+		return cYellow + cBold + "[!]" + cReset + " " + ev.Value
+	case KindResult:
+		return cGreen + cBold + "  ➜  " + ev.Value + cReset
+	case KindKV:
+		return fmt.Sprintf("%s%-18s%s %s", cDim, ev.Label+":", cReset, ev.Value)
+	case KindFatal:
+		return cRed + cBold + "[✗]" + cReset + " " + ev.Value
+	default:
+		return cGreen + cBold + "[+]" + cReset + " " + ev.Value
+	}
+}
+
+// sparkline renders the last width values scaled to their maximum.
+func sparkline(values []float64, width int) string {
+	if width <= 0 || len(values) == 0 {
+		return ""
+	}
+	if len(values) > width {
+		values = values[len(values)-width:]
+	}
+	top := 0.0
+	for _, v := range values {
+		top = max(top, v)
+	}
+	out := make([]rune, len(values))
+	for i, v := range values {
+		idx := 0
+		if top > 0 && v > 0 {
+			idx = int(v/top*float64(len(sparkRunes)-1) + 0.5)
+		}
+		out[i] = sparkRunes[idx]
+	}
+	return string(out)
+}
+
+func bar(frac float64, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	full := int(frac*float64(width) + 0.5)
+	full = min(max(full, 0), width)
+	return cCyan + strings.Repeat("█", full) + cDim + strings.Repeat("░", width-full) + cReset
+}
+
+func median(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	n := len(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// truncate cuts s to width terminal columns, skipping ANSI escapes when
+// counting and counting East Asian wide characters as two columns.
+func truncate(s string, width int) string {
+	var b strings.Builder
+	cols := 0
+	runes := []rune(s)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		if r == '\033' {
+			for ; i < len(runes); i++ {
+				b.WriteRune(runes[i])
+				if runes[i] == 'm' {
+					break
+				}
+			}
+			continue
+		}
+		w := runeWidth(r)
+		if cols+w > width {
+			b.WriteString(cReset)
+			return b.String()
+		}
+		cols += w
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func runeWidth(r rune) int {
+	switch {
+	case r >= 0x1100 && r <= 0x115f,
+		r >= 0x2e80 && r <= 0xa4cf,
+		r >= 0xac00 && r <= 0xd7a3,
+		r >= 0xf900 && r <= 0xfaff,
+		r >= 0xfe30 && r <= 0xfe4f,
+		r >= 0xff00 && r <= 0xff60,
+		r >= 0xffe0 && r <= 0xffe6,
+		r >= 0x1f300 && r <= 0x1faff:
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,103 @@
+package render
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// NDJSONRenderer writes one JSON object per event so wrappers can follow a
+// run without parsing the human-readable renderers.
+type NDJSONRenderer struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+type ndjsonEvent struct {
+	Type    string    `json:"type"`
+	Time    time.Time `json:"time"`
+	Phase   string    `json:"phase,omitempty"`
+	Label   string    `json:"label,omitempty"`
+	Message string    `json:"message,omitempty"`
+	Data    any       `json:"data,omitempty"`
+}
+
+type ndjsonProgress struct {
+	Bytes     int64   `json:"bytes"`
+	ElapsedMs int64   `json:"elapsed_ms"`
+	Mbps      float64 `json:"mbps"`
+	Conns     []int64 `json:"conns,omitempty"`
+}
+
+func NewNDJSONRenderer(w io.Writer) *NDJSONRenderer {
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	return &NDJSONRenderer{enc: enc}
+}
+
+func (n *NDJSONRenderer) Render(ev Event) {
+	out := ndjsonEvent{Time: ev.Time, Message: ev.Value, Data: ev.Data}
+	switch ev.Kind {
+	case KindBanner:
+		out.Type = "banner"
+	case KindHeader:
+		out.Type = "phase"
+		out.Phase = ev.Label
+	case KindInfo:
+		out.Type = "info"
+	case KindWarn:
+		out.Type = "warn"
+	case KindResult:
+		out.Type = "result"
+	case KindKV:
+		out.Type = "kv"
+		out.Label = ev.Label
+	case KindProgress:
+		out.Type = "progress"
+		out.Label = ev.Label
+		out.Message = ""
+		if p, ok := ev.Data.(Progress); ok {
+			if p.Key != "" {
+				out.Label = p.Key
+				out.Message = ev.Label
+			}
+			out.Data = ndjsonProgress{
+				Bytes:     p.Bytes,
+				ElapsedMs: p.Elapsed.Milliseconds(),
+				Mbps:      p.Mbps,
+				Conns:     p.Conns,
+			}
+		}
+	case KindFatal:
+		out.Type = "fatal"
+	default:
+		return
+	}
+	n.write(out)
+}
+
+// Finish writes the closing run_result event carrying the full result
+// document. Call it after the Bus has been closed.
+func (n *NDJSONRenderer) Finish(result any) error {
+	return n.write(ndjsonEvent{Type: "run_result", Time: time.Now(), Data: result})
+}
+
+func (n *NDJSONRenderer) write(ev ndjsonEvent) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.enc.Encode(ev)
+}
+
+// Tee fans every event out to all renderers in order.
+func Tee(renderers ...Renderer) Renderer {
+	return teeRenderer(renderers)
+}
+
+type teeRenderer []Renderer
+
+func (t teeRenderer) Render(ev Event) {
+	for _, r := range t {
+		r.Render(ev)
+	}
+}
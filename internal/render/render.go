@@ -28,10 +28,33 @@ type Event struct {
 	Kind  EventKind
 	Label string
 	Value string
+	Data  any
 	Time  time.Time
 	done  chan struct{}
 }
 
+// Progress is the numeric payload attached to KindProgress events.
+type Progress struct {
+	// Key is a stable, unlocalised name for the transfer, such as
+	// "download"; the event Label carries the localised one.
+	Key     string
+	Bytes   int64
+	Elapsed time.Duration
+	Mbps    float64
+	// Conns holds the cumulative bytes of each connection in the round.
+	Conns []int64
+	// LoadedMs holds the loaded latency samples collected so far.
+	LoadedMs []float64
+}
+
+// Candidate is the payload of the endpoint list and selection events.
+type Candidate struct {
+	IP       string  `json:"ip"`
+	Label    string  `json:"label,omitempty"`
+	RTTMs    float64 `json:"rtt_ms,omitempty"`
+	Selected bool    `json:"selected,omitempty"`
+}
+
 type Bus struct {
 	ch   chan Event
 	wg   sync.WaitGroup
@@ -72,6 +95,17 @@ func (b *Bus) KV(k, v string)           { b.Send(Event{Kind: KindKV, Label: k, V
 func (b *Bus) Line()                    { b.Send(Event{Kind: KindLine}) }
 func (b *Bus) Fatal(v string)           { b.Send(Event{Kind: KindFatal, Value: v}) }
 func (b *Bus) Progress(label, v string) { b.Send(Event{Kind: KindProgress, Label: label, Value: v}) }
+
+// Phase starts a new section; id is a stable identifier for machine-readable
+// renderers, title is what humans see.
+func (b *Bus) Phase(id, title string) { b.Send(Event{Kind: KindHeader, Label: id, Value: title}) }
+
+func (b *Bus) InfoData(v string, data any)   { b.Send(Event{Kind: KindInfo, Value: v, Data: data}) }
+func (b *Bus) ResultData(v string, data any) { b.Send(Event{Kind: KindResult, Value: v, Data: data}) }
+
+func (b *Bus) ProgressData(label, v string, p Progress) {
+	b.Send(Event{Kind: KindProgress, Label: label, Value: v, Data: p})
+}
 func (b *Bus) Flush() {
 	done := make(chan struct{})
 	b.Send(Event{Kind: KindSync, done: done})
@@ -2,10 +2,13 @@ package render
 
 import (
 	"bytes"
+	"encoding/json"
 	"strings"
 	"sync"
 	"testing"
 	"time"
+
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/i18n"
 )
 
 func TestPlainRendererAllKinds(t *testing.T) {
@@ -115,8 +118,129 @@ func TestBusFlushWaitsForRender(t *testing.T) {
 	}
 }
 
+func TestNDJSONRendererEvents(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewNDJSONRenderer(&buf)
+	bus := NewBus(r)
+	bus.Phase("download_single", "Download (single thread)")
+	bus.ProgressData("下载", "80.0 Mbps  10 MiB  1.0s", Progress{Key: "download", Bytes: 10 << 20, Elapsed: 1500 * time.Millisecond, Mbps: 80})
+	bus.Line()
+	bus.ResultData("80 Mbps", map[string]int{"threads": 1})
+	bus.Close()
+	if err := r.Finish(map[string]int{"exit_code": 0}); err != nil {
+		t.Fatal(err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected 4 lines (line events skipped), got %d:\n%s", len(lines), buf.String())
+	}
+	var events []map[string]any
+	for _, line := range lines {
+		var ev map[string]any
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatalf("invalid JSON line %q: %v", line, err)
+		}
+		events = append(events, ev)
+	}
+	if events[0]["type"] != "phase" || events[0]["phase"] != "download_single" {
+		t.Errorf("unexpected phase event: %v", events[0])
+	}
+	progress, _ := events[1]["data"].(map[string]any)
+	if events[1]["type"] != "progress" || progress["bytes"] != float64(10<<20) || progress["elapsed_ms"] != float64(1500) || progress["mbps"] != float64(80) {
+		t.Errorf("unexpected progress event: %v", events[1])
+	}
+	if events[1]["label"] != "download" || events[1]["message"] != "下载" {
+		t.Errorf("progress event should carry the stable key as label and the localised name as message: %v", events[1])
+	}
+	if events[2]["type"] != "result" {
+		t.Errorf("unexpected result event: %v", events[2])
+	}
+	if events[3]["type"] != "run_result" {
+		t.Errorf("expected run_result last, got %v", events[3])
+	}
+}
+
+func TestTeeRendersToAll(t *testing.T) {
+	var a, b bytes.Buffer
+	r := Tee(NewPlainRenderer(&a), NewPlainRenderer(&b))
+	r.Render(Event{Kind: KindInfo, Value: "hello"})
+	if !strings.Contains(a.String(), "hello") || !strings.Contains(b.String(), "hello") {
+		t.Fatalf("tee did not reach both renderers: %q / %q", a.String(), b.String())
+	}
+}
+
 type capRenderer struct {
 	fn func(Event)
 }
 
 func (c *capRenderer) Render(ev Event) { c.fn(ev) }
+
+func TestDashboardRendererDrawsPanels(t *testing.T) {
+	oldLang := i18n.Lang()
+	defer i18n.Set(oldLang)
+	i18n.Set("en")
+
+	var buf bytes.Buffer
+	d := &DashboardRenderer{w: &buf, size: func() (int, int) { return 100, 30 }}
+
+	d.Render(Event{Kind: KindHeader, Label: "endpoint_selection", Value: "Endpoint Selection"})
+	d.Render(Event{Kind: KindInfo, Value: "Available endpoints:", Data: []Candidate{
+		{IP: "17.253.85.205", Label: "AS714"},
+		{IP: "17.253.85.206", Label: "AS714"},
+	}})
+	d.Render(Event{Kind: KindInfo, Value: "Selected endpoint", Data: Candidate{IP: "17.253.85.206", Selected: true}})
+	d.Render(Event{Kind: KindHeader, Label: "download_multi", Value: "Download (multi-thread)"})
+	d.Render(Event{Kind: KindProgress, Label: "download", Data: Progress{
+		Bytes: 1 << 20, Elapsed: 500 * time.Millisecond, Conns: []int64{1 << 19, 1 << 19},
+	}})
+	buf.Reset()
+	d.Render(Event{Kind: KindProgress, Label: "download", Data: Progress{
+		Bytes: 4 << 20, Elapsed: time.Second, Mbps: 33.5, Conns: []int64{3 << 20, 1 << 20}, LoadedMs: []float64{20, 40, 30},
+	}})
+
+	out := buf.String()
+	for _, want := range []string{
+		"Download (multi-thread)",
+		"▶",
+		"17.253.85.206",
+		"avg 33.5 Mbps",
+		"#1",
+		"#2",
+		"3.0 MiB",
+		"median 30.00 ms",
+		"█",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("dashboard missing %q\n%s", want, out)
+		}
+	}
+	if n := strings.Count(out, "\r\n"); n > 29 {
+		t.Errorf("dashboard drew %d lines on a 30-line screen", n)
+	}
+
+	buf.Reset()
+	d.Close()
+	out = buf.String()
+	if !strings.HasPrefix(out, "\033[?1049l") || !strings.Contains(out, "Available endpoints:") {
+		t.Errorf("Close should leave the alternate screen and replay the log, got %q", out)
+	}
+}
+
+func TestSparkline(t *testing.T) {
+	if got := sparkline([]float64{0, 50, 100}, 10); got != "▁▅█" {
+		t.Errorf("sparkline = %q", got)
+	}
+	if got := sparkline([]float64{1, 2, 3, 4}, 2); len([]rune(got)) != 2 {
+		t.Errorf("sparkline should keep the last width values, got %q", got)
+	}
+}
+
+func TestTruncateWideRunes(t *testing.T) {
+	if got := truncate("下载 abc", 4); got != "下载"+cReset {
+		t.Errorf("truncate = %q", got)
+	}
+	if got := truncate(cBold+"ab"+cReset, 5); got != cBold+"ab"+cReset {
+		t.Errorf("truncate should keep escapes, got %q", got)
+	}
+}
@@ -0,0 +1,5 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package render
+
+func termSize(fd uintptr) (int, int) { return 0, 0 }
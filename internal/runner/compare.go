@@ -0,0 +1,177 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/config"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/endpoint"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/i18n"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/netx"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/render"
+)
+
+// comparisonTargets keeps the healthy candidates, or all that were not
+// excluded when none answered the probe, so a blocked probe URL does not
+// skip the comparison.
+func comparisonTargets(candidates []endpoint.Candidate) []endpoint.Candidate {
+	var healthy, allowed []endpoint.Candidate
+	for _, candidate := range candidates {
+		if candidate.Status == "ok" {
+			healthy = append(healthy, candidate)
+		}
+		if candidate.Status != "excluded" {
+			allowed = append(allowed, candidate)
+		}
+	}
+	if len(healthy) == 0 {
+		return allowed
+	}
+	return healthy
+}
+
+// compareEndpoints runs the full measurement against each candidate with
+// the client pinned to it, ranks the results and reports the best one as
+// the selected endpoint.
+func compareEndpoints(ctx context.Context, cfg *config.Config, opts netx.Options, bus *render.Bus, result *RunResult, host string, candidates []endpoint.Candidate) {
+	entries := make([]EndpointResult, 0, len(candidates))
+	for i, candidate := range candidates {
+		if interrupted(ctx) {
+			break
+		}
+		if bus != nil {
+			bus.Phase(fmt.Sprintf("compare_endpoint_%d", i+1), fmt.Sprintf(i18n.Text("Endpoint %d/%d: %s", "节点 %d/%d: %s"), i+1, len(candidates), candidate.IP))
+			if candidate.Desc != "" {
+				bus.Info(candidate.Desc)
+			}
+		}
+		tracker := netx.NewConnTracker()
+		clientOpts := opts
+		clientOpts.PinHost = host
+		clientOpts.PinIP = candidate.IP
+		clientOpts.Timeout = time.Duration(cfg.Timeout+5) * time.Second
+		clientOpts.Network = familyNetwork(cfg.Family)
+		clientOpts.Tracker = tracker
+		client := netx.NewClient(clientOpts)
+		var measured RunResult
+		measure(ctx, cfg, client, bus, &measured)
+		result.TotalBytes += measured.TotalBytes
+		for _, warning := range measured.Warnings {
+			addWarning(result, warning.Code, candidate.IP+": "+warning.Message)
+		}
+		if interrupted(ctx) {
+			break
+		}
+		entries = append(entries, EndpointResult{
+			Endpoint:     selectedEndpoint(endpoint.Endpoint{IP: candidate.IP, Desc: candidate.Desc, RTTMs: candidate.RTTMs, Source: candidate.Source, Status: candidate.Status}),
+			IdleLatency:  measured.IdleLatency,
+			Rounds:       measured.Rounds,
+			DownloadMbps: bestMbps(measured.Rounds, "download"),
+			UploadMbps:   bestMbps(measured.Rounds, "upload"),
+			TotalBytes:   measured.TotalBytes,
+			Degraded:     measured.Degraded,
+			Connections:  connectionDetails(tracker.Connections()),
+		})
+	}
+
+	rankEndpoints(entries)
+	result.Comparison = entries
+	if len(entries) == 0 {
+		return
+	}
+	best := entries[0]
+	result.SelectedEndpoint = best.Endpoint
+	result.IdleLatency = best.IdleLatency
+	result.Rounds = best.Rounds
+	if best.Degraded {
+		result.Degraded = true
+	}
+	if bus != nil {
+		renderComparison(bus, entries)
+	}
+}
+
+func bestMbps(rounds []RoundResult, direction string) float64 {
+	best := 0.0
+	for _, round := range rounds {
+		if round.Direction == direction && round.Status != "failed" && round.Mbps > best {
+			best = round.Mbps
+		}
+	}
+	return best
+}
+
+// rankEndpoints orders by download, then upload throughput, then idle
+// latency, and numbers the entries from 1.
+func rankEndpoints(entries []EndpointResult) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.DownloadMbps != b.DownloadMbps {
+			return a.DownloadMbps > b.DownloadMbps
+		}
+		if a.UploadMbps != b.UploadMbps {
+			return a.UploadMbps > b.UploadMbps
+		}
+		aOK, bOK := a.IdleLatency.MedianMs != nil, b.IdleLatency.MedianMs != nil
+		if aOK != bOK {
+			return aOK
+		}
+		return aOK && *a.IdleLatency.MedianMs < *b.IdleLatency.MedianMs
+	})
+	for i := range entries {
+		entries[i].Rank = i + 1
+	}
+}
+
+func renderComparison(bus *render.Bus, entries []EndpointResult) {
+	bus.Phase("endpoint_comparison", i18n.Text("Endpoint Comparison", "节点对比"))
+	ipWidth := len("Endpoint")
+	for _, entry := range entries {
+		ipWidth = max(ipWidth, len(entry.Endpoint.IP))
+	}
+	bus.Info(fmt.Sprintf("%-3s %-*s  %10s  %10s  %10s  %10s  %s", "#", ipWidth,
+		i18n.Text("Endpoint", "节点"),
+		i18n.Text("Idle", "空载延迟"),
+		i18n.Text("Download", "下载"),
+		i18n.Text("Upload", "上传"),
+		i18n.Text("Loaded", "负载延迟"),
+		i18n.Text("Location", "位置")))
+	for _, entry := range entries {
+		row := fmt.Sprintf("%-3d %-*s  %10s  %10s  %10s  %10s  %s", entry.Rank, ipWidth, entry.Endpoint.IP,
+			msCell(entry.IdleLatency.MedianMs),
+			fmt.Sprintf("%.0f Mbps", entry.DownloadMbps),
+			fmt.Sprintf("%.0f Mbps", entry.UploadMbps),
+			msCell(worstLoaded(entry.Rounds)),
+			entry.Endpoint.Description)
+		if entry.Degraded {
+			bus.Warn(strings.TrimRight(row, " "))
+		} else {
+			bus.Info(strings.TrimRight(row, " "))
+		}
+	}
+	best := entries[0]
+	bus.ResultData(fmt.Sprintf(i18n.Text("Best endpoint: %s (%.0f / %.0f Mbps)", "最佳节点: %s (%.0f / %.0f Mbps)"),
+		best.Endpoint.IP, best.DownloadMbps, best.UploadMbps), entries)
+}
+
+// worstLoaded returns the highest loaded latency median across rounds,
+// which is what bufferbloat shows up as.
+func worstLoaded(rounds []RoundResult) *float64 {
+	var worst *float64
+	for _, round := range rounds {
+		if m := round.LoadedLatency.MedianMs; m != nil && (worst == nil || *m > *worst) {
+			worst = m
+		}
+	}
+	return worst
+}
+
+func msCell(v *float64) string {
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f ms", *v)
+}
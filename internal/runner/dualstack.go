@@ -0,0 +1,140 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/config"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/i18n"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/netx"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/render"
+)
+
+// runDualStack runs the whole plan once over IPv4 and once over IPv6. The
+// top-level fields describe the IPv4 run, dual_stack holds both and their
+// difference, and warnings raised by either run are kept with a family
+// prefix.
+func runDualStack(ctx context.Context, cfg *config.Config, opts netx.Options, bus *render.Bus, isTTY bool, started time.Time, base RunResult) RunResult {
+	var runs []RunResult
+	for _, family := range []int{4, 6} {
+		if bus != nil {
+			bus.Line()
+			bus.Banner(fmt.Sprintf(i18n.Text("IPv%d test plan", "IPv%d 测速"), family))
+		}
+		familyCfg := *cfg
+		familyCfg.Family = family
+		familyCfg.DualStack = false
+		familyBase := base
+		familyBase.Warnings = slices.Clip(base.Warnings)
+		run := runPlan(ctx, &familyCfg, opts, bus, isTTY, time.Now(), familyBase)
+		runs = append(runs, run)
+		if run.ExitCode == 130 {
+			break
+		}
+	}
+
+	result := runs[0]
+	result.Config = base.Config
+	result.StartedAt = base.StartedAt
+	result.Warnings = base.Warnings
+	result.TotalBytes = 0
+	result.Degraded = false
+	families := make([]FamilyResult, 0, len(runs))
+	exitCode := 0
+	for i, run := range runs {
+		family := 4 + 2*i
+		for _, warning := range run.Warnings[len(base.Warnings):] {
+			addWarning(&result, warning.Code, fmt.Sprintf("IPv%d: %s", family, warning.Message))
+		}
+		result.TotalBytes += run.TotalBytes
+		result.Degraded = result.Degraded || run.Degraded
+		exitCode = max(exitCode, run.ExitCode)
+		families = append(families, FamilyResult{
+			Family:       family,
+			Endpoint:     run.SelectedEndpoint,
+			IdleLatency:  run.IdleLatency,
+			Rounds:       run.Rounds,
+			DownloadMbps: bestMbps(run.Rounds, "download"),
+			UploadMbps:   bestMbps(run.Rounds, "upload"),
+			TotalBytes:   run.TotalBytes,
+			Degraded:     run.Degraded,
+			Client:       run.ConnectionInfo.Client,
+			Server:       run.ConnectionInfo.Server,
+		})
+	}
+	result.DualStack = dualStackResult(families)
+	if bus != nil && exitCode != 130 {
+		renderDualStack(bus, result.DualStack)
+	}
+	result.ExitCode = exitCode
+	result.DurationMs = time.Since(started).Milliseconds()
+	return result
+}
+
+func dualStackResult(families []FamilyResult) *DualStackResult {
+	out := &DualStackResult{Families: families}
+	if len(families) != 2 {
+		return out
+	}
+	v4, v6 := families[0], families[1]
+	if v4.DownloadMbps > 0 && v6.DownloadMbps > 0 {
+		out.DownloadDeltaMbps = floatPtr(v6.DownloadMbps - v4.DownloadMbps)
+	}
+	if v4.UploadMbps > 0 && v6.UploadMbps > 0 {
+		out.UploadDeltaMbps = floatPtr(v6.UploadMbps - v4.UploadMbps)
+	}
+	if v4.IdleLatency.MedianMs != nil && v6.IdleLatency.MedianMs != nil {
+		out.IdleLatencyDeltaMs = floatPtr(*v6.IdleLatency.MedianMs - *v4.IdleLatency.MedianMs)
+	}
+	return out
+}
+
+func renderDualStack(bus *render.Bus, ds *DualStackResult) {
+	bus.Phase("dual_stack", i18n.Text("Dual-Stack Comparison", "双栈对比"))
+	bus.Info(fmt.Sprintf("%-6s %-39s  %10s  %10s  %10s", i18n.Text("Family", "协议"),
+		i18n.Text("Endpoint", "节点"),
+		i18n.Text("Idle", "空载延迟"),
+		i18n.Text("Download", "下载"),
+		i18n.Text("Upload", "上传")))
+	for _, f := range ds.Families {
+		bus.Info(fmt.Sprintf("%-6s %-39s  %10s  %10s  %10s", fmt.Sprintf("IPv%d", f.Family),
+			orFallback(f.Endpoint.IP, "-"),
+			msCell(f.IdleLatency.MedianMs),
+			fmt.Sprintf("%.0f Mbps", f.DownloadMbps),
+			fmt.Sprintf("%.0f Mbps", f.UploadMbps)))
+	}
+	if ds.DownloadDeltaMbps == nil && ds.UploadDeltaMbps == nil && ds.IdleLatencyDeltaMs == nil {
+		bus.Warn(i18n.Text("No comparable results for both families.", "两个协议族没有可对比的结果。"))
+		return
+	}
+	v4 := ds.Families[0]
+	if ds.DownloadDeltaMbps != nil {
+		bus.ResultData(fmt.Sprintf(i18n.Text("IPv6 vs IPv4 download: %s", "IPv6 相对 IPv4 下载: %s"), deltaCell(*ds.DownloadDeltaMbps, v4.DownloadMbps)), *ds.DownloadDeltaMbps)
+	}
+	if ds.UploadDeltaMbps != nil {
+		bus.ResultData(fmt.Sprintf(i18n.Text("IPv6 vs IPv4 upload: %s", "IPv6 相对 IPv4 上传: %s"), deltaCell(*ds.UploadDeltaMbps, v4.UploadMbps)), *ds.UploadDeltaMbps)
+	}
+	if ds.IdleLatencyDeltaMs != nil {
+		bus.ResultData(fmt.Sprintf(i18n.Text("IPv6 vs IPv4 idle latency: %+.2f ms", "IPv6 相对 IPv4 空载延迟: %+.2f 毫秒"), *ds.IdleLatencyDeltaMs), *ds.IdleLatencyDeltaMs)
+	}
+}
+
+func deltaCell(delta, baseline float64) string {
+	if baseline <= 0 {
+		return fmt.Sprintf("%+.0f Mbps", delta)
+	}
+	return fmt.Sprintf("%+.0f Mbps (%+.1f%%)", delta, delta/baseline*100)
+}
+
+// familyNetwork maps -4/-6 to the dial network.
+func familyNetwork(family int) string {
+	switch family {
+	case 4:
+		return "tcp4"
+	case 6:
+		return "tcp6"
+	}
+	return ""
+}
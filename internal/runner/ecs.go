@@ -0,0 +1,68 @@
+package runner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/config"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/endpoint"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/i18n"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/render"
+)
+
+// mapSubnets resolves host for every --ecs-map subnet and records which
+// endpoints each one is mapped to.
+func mapSubnets(ctx context.Context, cfg *config.Config, bus *render.Bus, result *RunResult, host string) {
+	if bus != nil {
+		bus.Phase("ecs_mapping", i18n.Text("ECS Mapping", "ECS 映射"))
+	}
+	mappings := endpoint.MapClientSubnets(ctx, host, cfg.Resolvers, cfg.ECSMap, !cfg.NoMetadata)
+	result.ECSMapping = subnetMappingResults(mappings)
+	if bus != nil {
+		renderSubnetMapping(bus, result.ECSMapping)
+	}
+}
+
+func subnetMappingResults(mappings []endpoint.SubnetMapping) []SubnetMappingResult {
+	out := make([]SubnetMappingResult, 0, len(mappings))
+	for _, mapping := range mappings {
+		entry := SubnetMappingResult{
+			Subnet: mapping.Subnet,
+			Status: "ok",
+			Error:  mapping.Error,
+		}
+		if mapping.Scope >= 0 {
+			entry.ScopePrefix = intPtr(mapping.Scope)
+		}
+		for _, ep := range mapping.Endpoints {
+			entry.Endpoints = append(entry.Endpoints, MappedEndpoint{IP: ep.IP, Description: ep.Desc})
+		}
+		if len(entry.Endpoints) == 0 {
+			entry.Status = "failed"
+		}
+		out = append(out, entry)
+	}
+	return out
+}
+
+func renderSubnetMapping(bus *render.Bus, mappings []SubnetMappingResult) {
+	for _, mapping := range mappings {
+		if mapping.Status != "ok" {
+			bus.Warn(fmt.Sprintf(i18n.Text("%s: no answer (%s)", "%s: 无应答（%s）"), mapping.Subnet, orFallback(mapping.Error, "-")))
+			continue
+		}
+		scope := i18n.Text("ECS not honoured", "未采用 ECS")
+		if mapping.ScopePrefix != nil {
+			scope = fmt.Sprintf(i18n.Text("scope /%d", "作用域 /%d"), *mapping.ScopePrefix)
+		}
+		bus.KV(mapping.Subnet, scope)
+		for _, ep := range mapping.Endpoints {
+			bus.Info(strings.TrimSpace(fmt.Sprintf("  %s  %s", ep.IP, ep.Description)))
+		}
+	}
+}
+
+func intPtr(v int) *int {
+	return &v
+}
@@ -18,15 +18,45 @@ type RunConfig struct {
 	NonInteractive bool   `json:"non_interactive"`
 	EndpointIP     string `json:"endpoint_ip,omitempty"`
 	Metadata       bool   `json:"metadata"`
+
+	EndpointIPs      []string `json:"endpoint_ips,omitempty"`
+	CompareEndpoints bool     `json:"compare_endpoints,omitempty"`
+	Resolvers        []string `json:"resolvers,omitempty"`
+	ECS              string   `json:"ecs,omitempty"`
+	ECSMap           []string `json:"ecs_map,omitempty"`
+	Family           int      `json:"family,omitempty"`
+	DualStack        bool     `json:"dual_stack,omitempty"`
+	Interface        string   `json:"interface,omitempty"`
+	Source           string   `json:"source,omitempty"`
+	CAFile           string   `json:"ca_file,omitempty"`
+	ClientCert       string   `json:"client_cert,omitempty"`
+	TLSMin           string   `json:"tls_min,omitempty"`
+	TLSMax           string   `json:"tls_max,omitempty"`
+	TLSCiphers       []string `json:"tls_ciphers,omitempty"`
+	KeyLogFile       string   `json:"keylog_file,omitempty"`
+	DSCP             string   `json:"dscp,omitempty"`
+	RcvBuf           int      `json:"rcvbuf,omitempty"`
+	SndBuf           int      `json:"sndbuf,omitempty"`
+	NotSentLowat     int      `json:"notsent_lowat,omitempty"`
+	TCPNoDelay       string   `json:"tcp_nodelay,omitempty"`
+	MPTCP            bool     `json:"mptcp,omitempty"`
+	MetadataProvider string   `json:"metadata_provider,omitempty"`
+	DiscoveryTTL     string   `json:"discovery_ttl,omitempty"`
 }
 
 type CandidateResult struct {
 	IP          string   `json:"ip"`
 	Description string   `json:"description,omitempty"`
+	ASN         int      `json:"asn,omitempty"`
+	Country     string   `json:"country,omitempty"`
 	RTTMs       *float64 `json:"rtt_ms,omitempty"`
+	MinRTTMs    *float64 `json:"min_rtt_ms,omitempty"`
+	RTTSamples  int      `json:"rtt_samples,omitempty"`
+	Loss        *float64 `json:"loss,omitempty"`
 	Source      string   `json:"source,omitempty"`
 	Status      string   `json:"status"`
 	Error       string   `json:"error,omitempty"`
+	Preferred   bool     `json:"preferred,omitempty"`
 }
 
 type SelectedEndpoint struct {
@@ -35,6 +65,9 @@ type SelectedEndpoint struct {
 	RTTMs       *float64 `json:"rtt_ms,omitempty"`
 	Source      string   `json:"source,omitempty"`
 	Status      string   `json:"status"`
+	// DiscoveredAt is when the discovery that chose a reused ("cache")
+	// endpoint ran.
+	DiscoveredAt string `json:"discovered_at,omitempty"`
 }
 
 type PeerInfo struct {
@@ -43,6 +76,8 @@ type PeerInfo struct {
 	ISP      string `json:"isp,omitempty"`
 	ASN      string `json:"asn,omitempty"`
 	Location string `json:"location,omitempty"`
+	// Error explains an unavailable peer when the reason is known.
+	Error string `json:"error,omitempty"`
 }
 
 type ConnectionInfo struct {
@@ -51,46 +86,152 @@ type ConnectionInfo struct {
 	Host            string   `json:"host,omitempty"`
 	Client          PeerInfo `json:"client"`
 	Server          PeerInfo `json:"server"`
+	// Connections lists the connections the measurement ran over.
+	Connections []ConnectionDetail `json:"connections,omitempty"`
+}
+
+// ConnectionDetail is one measurement connection: the HTTP protocol, the
+// negotiated TLS parameters and server certificate, and how many requests
+// used it, of which reused_requests found it already open. An unexpected
+// certificate issuer usually means a middlebox is intercepting TLS. Socket
+// holds the TCP options the kernel applied, which may differ from the
+// requested --rcvbuf and --sndbuf.
+type ConnectionDetail struct {
+	RemoteAddr     string      `json:"remote_addr"`
+	Proto          string      `json:"proto,omitempty"`
+	TLSVersion     string      `json:"tls_version,omitempty"`
+	CipherSuite    string      `json:"cipher_suite,omitempty"`
+	ALPN           string      `json:"alpn,omitempty"`
+	CertSubject    string      `json:"cert_subject,omitempty"`
+	CertIssuer     string      `json:"cert_issuer,omitempty"`
+	Requests       int         `json:"requests"`
+	ReusedRequests int         `json:"reused_requests"`
+	Socket         *SocketInfo `json:"socket,omitempty"`
+}
+
+// SocketInfo is the effective TCP socket configuration of a connection.
+// Linux reports twice the requested buffer sizes, capped by
+// net.core.rmem_max and wmem_max; notsent_lowat is 0 when unset.
+type SocketInfo struct {
+	RcvBufBytes       int  `json:"rcvbuf_bytes"`
+	SndBufBytes       int  `json:"sndbuf_bytes"`
+	NoDelay           bool `json:"nodelay"`
+	NotSentLowatBytes int  `json:"notsent_lowat_bytes"`
+	MPTCP             bool `json:"mptcp"`
 }
 
 type LatencyResult struct {
-	Status   string   `json:"status"`
-	Samples  int      `json:"samples"`
-	MinMs    *float64 `json:"min_ms,omitempty"`
-	AvgMs    *float64 `json:"avg_ms,omitempty"`
-	MedianMs *float64 `json:"median_ms,omitempty"`
-	MaxMs    *float64 `json:"max_ms,omitempty"`
-	JitterMs *float64 `json:"jitter_ms,omitempty"`
-	Error    string   `json:"error,omitempty"`
+	Status    string    `json:"status"`
+	Samples   int       `json:"samples"`
+	MinMs     *float64  `json:"min_ms,omitempty"`
+	AvgMs     *float64  `json:"avg_ms,omitempty"`
+	MedianMs  *float64  `json:"median_ms,omitempty"`
+	MaxMs     *float64  `json:"max_ms,omitempty"`
+	JitterMs  *float64  `json:"jitter_ms,omitempty"`
+	SamplesMs []float64 `json:"samples_ms,omitempty"`
+	Error     string    `json:"error,omitempty"`
 }
 
 type RoundResult struct {
-	Name          string        `json:"name"`
-	Direction     string        `json:"direction"`
-	Threads       int           `json:"threads"`
-	Status        string        `json:"status"`
-	URL           string        `json:"url"`
-	TotalBytes    int64         `json:"total_bytes"`
-	DurationMs    int64         `json:"duration_ms"`
-	Mbps          float64       `json:"mbps"`
-	FaultCount    int           `json:"fault_count"`
-	HadFault      bool          `json:"had_fault"`
-	LoadedLatency LatencyResult `json:"loaded_latency"`
-	Error         string        `json:"error,omitempty"`
+	Name          string             `json:"name"`
+	Direction     string             `json:"direction"`
+	Threads       int                `json:"threads"`
+	Status        string             `json:"status"`
+	URL           string             `json:"url"`
+	StartedAt     string             `json:"started_at,omitempty"`
+	TotalBytes    int64              `json:"total_bytes"`
+	DurationMs    int64              `json:"duration_ms"`
+	Mbps          float64            `json:"mbps"`
+	FaultCount    int                `json:"fault_count"`
+	HadFault      bool               `json:"had_fault"`
+	LoadedLatency LatencyResult      `json:"loaded_latency"`
+	Timeline      []ThroughputSample `json:"timeline,omitempty"`
+	Error         string             `json:"error,omitempty"`
+}
+
+type ThroughputSample struct {
+	ElapsedMs int64   `json:"elapsed_ms"`
+	Bytes     int64   `json:"bytes"`
+	Mbps      float64 `json:"mbps"`
 }
 
 type RunResult struct {
-	SchemaVersion    int               `json:"schema_version"`
-	Config           RunConfig         `json:"config"`
-	Candidates       []CandidateResult `json:"candidates"`
-	SelectedEndpoint SelectedEndpoint  `json:"selected_endpoint"`
-	ConnectionInfo   ConnectionInfo    `json:"connection_info"`
-	IdleLatency      LatencyResult     `json:"idle_latency"`
-	Rounds           []RoundResult     `json:"rounds"`
-	TotalBytes       int64             `json:"total_bytes"`
-	Warnings         []Warning         `json:"warnings"`
-	Degraded         bool              `json:"degraded"`
-	ExitCode         int               `json:"exit_code"`
-	StartedAt        string            `json:"started_at"`
-	DurationMs       int64             `json:"duration_ms"`
+	SchemaVersion    int                   `json:"schema_version"`
+	Config           RunConfig             `json:"config"`
+	Candidates       []CandidateResult     `json:"candidates"`
+	SelectedEndpoint SelectedEndpoint      `json:"selected_endpoint"`
+	ConnectionInfo   ConnectionInfo        `json:"connection_info"`
+	Proxy            *ProxyResult          `json:"proxy,omitempty"`
+	IdleLatency      LatencyResult         `json:"idle_latency"`
+	Rounds           []RoundResult         `json:"rounds"`
+	Comparison       []EndpointResult      `json:"comparison,omitempty"`
+	ECSMapping       []SubnetMappingResult `json:"ecs_mapping,omitempty"`
+	DualStack        *DualStackResult      `json:"dual_stack,omitempty"`
+	TotalBytes       int64                 `json:"total_bytes"`
+	Warnings         []Warning             `json:"warnings"`
+	Degraded         bool                  `json:"degraded"`
+	ExitCode         int                   `json:"exit_code"`
+	StartedAt        string                `json:"started_at"`
+	DurationMs       int64                 `json:"duration_ms"`
+}
+
+// EndpointResult is one endpoint measured by --compare-endpoints, ranked
+// by throughput.
+type EndpointResult struct {
+	Rank         int              `json:"rank"`
+	Endpoint     SelectedEndpoint `json:"endpoint"`
+	IdleLatency  LatencyResult    `json:"idle_latency"`
+	Rounds       []RoundResult    `json:"rounds"`
+	DownloadMbps float64          `json:"download_mbps"`
+	UploadMbps   float64          `json:"upload_mbps"`
+	TotalBytes   int64            `json:"total_bytes"`
+	Degraded     bool             `json:"degraded"`
+
+	Connections []ConnectionDetail `json:"connections,omitempty"`
+}
+
+// SubnetMappingResult lists the endpoints discovery returned for one
+// --ecs-map subnet. ScopePrefix is the ECS scope the resolver echoed back
+// and is absent when the option was ignored.
+type SubnetMappingResult struct {
+	Subnet      string           `json:"subnet"`
+	Endpoints   []MappedEndpoint `json:"endpoints"`
+	ScopePrefix *int             `json:"scope_prefix,omitempty"`
+	Status      string           `json:"status"`
+	Error       string           `json:"error,omitempty"`
+}
+
+type MappedEndpoint struct {
+	IP          string `json:"ip"`
+	Description string `json:"description,omitempty"`
+}
+
+// ProxyResult lists the proxies traffic went through, with passwords
+// redacted. Measurement results then describe the path via the proxy.
+type ProxyResult struct {
+	Metadata    string `json:"metadata,omitempty"`
+	Measurement string `json:"measurement,omitempty"`
+}
+
+// DualStackResult holds both runs of a --dual-stack test. The deltas are
+// IPv6 minus IPv4 and are absent when either family has no value.
+type DualStackResult struct {
+	Families           []FamilyResult `json:"families"`
+	DownloadDeltaMbps  *float64       `json:"download_delta_mbps,omitempty"`
+	UploadDeltaMbps    *float64       `json:"upload_delta_mbps,omitempty"`
+	IdleLatencyDeltaMs *float64       `json:"idle_latency_delta_ms,omitempty"`
+}
+
+type FamilyResult struct {
+	Family       int              `json:"family"`
+	Endpoint     SelectedEndpoint `json:"endpoint"`
+	IdleLatency  LatencyResult    `json:"idle_latency"`
+	Rounds       []RoundResult    `json:"rounds"`
+	DownloadMbps float64          `json:"download_mbps"`
+	UploadMbps   float64          `json:"upload_mbps"`
+	TotalBytes   int64            `json:"total_bytes"`
+	Degraded     bool             `json:"degraded"`
+	// Client and Server are the peers as seen over this family.
+	Client PeerInfo `json:"client"`
+	Server PeerInfo `json:"server"`
 }
@@ -2,7 +2,14 @@ package runner
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/tsosunchia/iNetSpeed-CLI/internal/config"
@@ -14,23 +21,44 @@ import (
 	"github.com/tsosunchia/iNetSpeed-CLI/internal/transfer"
 )
 
-func Run(ctx context.Context, cfg *config.Config, bus *render.Bus, isTTY bool) RunResult {
+func Run(ctx context.Context, cfg *config.Config, opts netx.Options, bus *render.Bus, isTTY bool) RunResult {
 	started := time.Now()
 	result := RunResult{
 		SchemaVersion: 1,
 		Config: RunConfig{
-			DLURL:          cfg.DLURL,
-			ULURL:          cfg.ULURL,
-			LatencyURL:     cfg.LatencyURL,
-			Max:            cfg.Max,
-			MaxBytes:       cfg.MaxBytes,
-			TimeoutSeconds: cfg.Timeout,
-			Threads:        cfg.Threads,
-			LatencyCount:   cfg.LatencyCount,
-			JSON:           cfg.OutputJSON,
-			NonInteractive: cfg.NonInteractive,
-			EndpointIP:     cfg.EndpointIP,
-			Metadata:       !cfg.NoMetadata,
+			DLURL:            cfg.DLURL,
+			ULURL:            cfg.ULURL,
+			LatencyURL:       cfg.LatencyURL,
+			Max:              cfg.Max,
+			MaxBytes:         cfg.MaxBytes,
+			TimeoutSeconds:   cfg.Timeout,
+			Threads:          cfg.Threads,
+			LatencyCount:     cfg.LatencyCount,
+			JSON:             cfg.OutputJSON,
+			NonInteractive:   cfg.NonInteractive,
+			EndpointIP:       cfg.EndpointIP,
+			Metadata:         !cfg.NoMetadata,
+			EndpointIPs:      cfg.EndpointIPs,
+			CompareEndpoints: cfg.CompareEndpoints,
+			Resolvers:        cfg.Resolvers,
+			ECS:              cfg.ECS,
+			ECSMap:           cfg.ECSMap,
+			Family:           cfg.Family,
+			DualStack:        cfg.DualStack,
+			Interface:        cfg.Interface,
+			Source:           cfg.Source,
+			CAFile:           cfg.CAFile,
+			ClientCert:       cfg.CertFile,
+			TLSMin:           tlsVersionName(cfg.TLSMin),
+			TLSMax:           tlsVersionName(cfg.TLSMax),
+			TLSCiphers:       cipherNames(cfg.TLSCiphers),
+			KeyLogFile:       cfg.KeyLogFile,
+			DSCP:             cfg.DSCP,
+			RcvBuf:           cfg.RcvBuf,
+			SndBuf:           cfg.SndBuf,
+			NotSentLowat:     cfg.NotSentLowat,
+			TCPNoDelay:       cfg.TCPNoDelay,
+			MPTCP:            cfg.MPTCP,
 		},
 		SelectedEndpoint: SelectedEndpoint{Status: "unavailable"},
 		ConnectionInfo: ConnectionInfo{
@@ -48,19 +76,81 @@ func Run(ctx context.Context, cfg *config.Config, bus *render.Bus, isTTY bool) R
 		bus.Banner("\u26a1 iNetSpeed-CLI")
 		bus.Info(i18n.Text("Config:  ", "配置:  ") + cfg.Summary())
 		bus.Line()
-		bus.Header(i18n.Text("Environment Check", "环境检查"))
+		bus.Phase("environment", i18n.Text("Environment Check", "环境检查"))
 		bus.Info(i18n.Text("Go binary — no external dependencies required.", "Go 二进制程序 — 无需外部依赖。"))
+		if cfg.Interface != "" {
+			bus.KV(i18n.Text("Interface", "网卡"), cfg.Interface)
+		}
+		if cfg.Source != "" {
+			bus.KV(i18n.Text("Source", "源地址"), cfg.Source)
+		}
+		if cfg.DSCP != "" {
+			bus.KV("DSCP", fmt.Sprintf("%s (%d)", cfg.DSCP, cfg.DSCPValue))
+		}
+		if tuning := socketTuning(cfg); tuning != "" {
+			bus.KV(i18n.Text("Socket", "套接字"), tuning)
+		}
+	}
+	if !cfg.NoMetadata {
+		result.Config.MetadataProvider = endpoint.CurrentProvider().Name()
+	}
+	if cfg.DiscoveryTTL > 0 {
+		result.Config.DiscoveryTTL = cfg.DiscoveryTTL.String()
+	}
+	if cfg.NotSentLowat > 0 && !netx.SetsNotSentLowat() {
+		addWarning(&result, "notsent_lowat_unsupported", i18n.Text(
+			"--notsent-lowat has no effect on this platform.",
+			"当前平台不支持 --notsent-lowat。"))
+	}
+	if cfg.DSCP != "" && !netx.MarksDSCP() {
+		addWarning(&result, "dscp_unsupported", i18n.Text(
+			"--dscp has no effect on this platform; traffic is sent unmarked.",
+			"当前平台不支持 --dscp，流量未被标记。"))
+	}
+	if cfg.MetadataProxy != "" || cfg.MeasureProxy != "" {
+		result.Proxy = &ProxyResult{
+			Metadata:    redactURL(cfg.MetadataProxy),
+			Measurement: redactURL(cfg.MeasureProxy),
+		}
+		if bus != nil {
+			bus.KV(i18n.Text("Proxy", "代理"), fmt.Sprintf(i18n.Text("metadata %s, measurement %s", "元数据 %s，测速 %s"),
+				orFallback(result.Proxy.Metadata, i18n.Text("direct", "直连")),
+				orFallback(result.Proxy.Measurement, i18n.Text("direct", "直连"))))
+		}
+	}
+	if cfg.KeyLogFile != "" {
+		msg := fmt.Sprintf(i18n.Text(
+			"TLS session secrets are written to %s; anyone with this file can decrypt captured traffic.",
+			"TLS 会话密钥正写入 %s，持有该文件即可解密抓包流量。"), cfg.KeyLogFile)
+		addWarning(&result, "tls_keylog", msg)
+		if bus != nil {
+			bus.Warn(msg)
+		}
+	}
+	if cfg.MeasureProxy != "" {
+		addWarning(&result, "proxy_in_path", i18n.Text(
+			"Measurement traffic goes through a proxy; results describe the proxy path.",
+			"测速流量经过代理，结果反映的是代理链路。"))
 	}
 
 	if interrupted(ctx) {
 		return finalizeResult(started, result, 130)
 	}
+	if cfg.DualStack {
+		return runDualStack(ctx, cfg, opts, bus, isTTY, started, result)
+	}
+	return runPlan(ctx, cfg, opts, bus, isTTY, started, result)
+}
 
+// runPlan discovers and selects an endpoint, then measures it, or every
+// candidate in comparison mode, and renders the summary.
+func runPlan(ctx context.Context, cfg *config.Config, opts netx.Options, bus *render.Bus, isTTY bool, started time.Time, result RunResult) RunResult {
 	dlHost := endpoint.HostFromURL(cfg.DLURL)
 	ulHost := endpoint.HostFromURL(cfg.ULURL)
 	latencyHost := endpoint.HostFromURL(cfg.LatencyURL)
 	hostsConsistent := dlHost != "" && dlHost == ulHost && dlHost == latencyHost
 
+	prompt := bus != nil && isTTY && !cfg.NonInteractive && !cfg.StdoutOutput() && !cfg.CompareEndpoints && !cfg.DualStack
 	discovery := endpoint.DiscoveryResult{
 		Host:       dlHost,
 		Selected:   endpoint.Endpoint{Source: "default_dns", Status: "degraded"},
@@ -68,9 +158,18 @@ func Run(ctx context.Context, cfg *config.Config, bus *render.Bus, isTTY bool) R
 	}
 	if hostsConsistent {
 		discovery = endpoint.Discover(ctx, dlHost, endpoint.DiscoveryOptions{
-			ProbeURL:   cfg.LatencyURL,
-			EndpointIP: cfg.EndpointIP,
-			Metadata:   !cfg.NoMetadata,
+			ProbeURL:     cfg.LatencyURL,
+			EndpointIP:   cfg.EndpointIP,
+			EndpointIPs:  cfg.EndpointIPs,
+			Metadata:     !cfg.NoMetadata,
+			Resolvers:    cfg.Resolvers,
+			ClientSubnet: cfg.ECS,
+			Prefer:       cfg.Prefer,
+			Exclude:      cfg.Exclude,
+			Family:       cfg.Family,
+			// A user picking from the prompt or comparing every candidate
+			// needs the full candidate list.
+			Sticky: !prompt && !cfg.CompareEndpoints,
 		})
 	} else {
 		result.Degraded = true
@@ -95,21 +194,68 @@ func Run(ctx context.Context, cfg *config.Config, bus *render.Bus, isTTY bool) R
 	}
 
 	if bus != nil {
-		renderSelection(bus, ctx, &discovery, isTTY && !cfg.NonInteractive && !cfg.OutputJSON)
+		renderSelection(bus, ctx, &discovery, prompt)
 		result.SelectedEndpoint = selectedEndpoint(discovery.Selected)
 	}
+	if discovery.Cached {
+		result.SelectedEndpoint.DiscoveredAt = discovery.DiscoveredAt.UTC().Format(time.RFC3339)
+	}
 	if interrupted(ctx) {
 		return finalizeResult(started, result, 130)
 	}
+	// A candidate picked at the prompt overrides the rules, as with
+	// --endpoint; otherwise there is nothing the rules allow to measure.
+	if discovery.Error != "" && discovery.Selected.IP == "" {
+		addWarning(&result, "no_eligible_endpoint", discovery.Error)
+		if bus != nil {
+			bus.Warn(discovery.Error)
+		}
+		result.Degraded = true
+		return finalizeResult(started, result, 1)
+	}
+
+	if len(cfg.ECSMap) > 0 && dlHost != "" {
+		mapSubnets(ctx, cfg, bus, &result, dlHost)
+		if interrupted(ctx) {
+			return finalizeResult(started, result, 130)
+		}
+	}
 
-	clientOpts := netx.Options{Timeout: time.Duration(cfg.Timeout+5) * time.Second}
+	if cfg.CompareEndpoints && (!hostsConsistent || discovery.DefaultDNS || len(discovery.Candidates) == 0) {
+		addWarning(&result, "compare_unavailable", i18n.Text(
+			"Endpoint comparison needs pinnable endpoint candidates; measuring a single endpoint.",
+			"节点对比需要可固定的候选节点，改为只测试单个节点。",
+		))
+	} else if cfg.CompareEndpoints {
+		compareEndpoints(ctx, cfg, opts, bus, &result, dlHost, comparisonTargets(discovery.Candidates))
+		if interrupted(ctx) {
+			return finalizeResult(started, result, 130)
+		}
+		result.ConnectionInfo = gatherInfo(ctx, !cfg.NoMetadata, dlHost, endpoint.Endpoint{IP: result.SelectedEndpoint.IP}, cfg.Family)
+		if len(result.Comparison) > 0 {
+			result.ConnectionInfo.Connections = result.Comparison[0].Connections
+		}
+		if !cfg.NoMetadata && result.ConnectionInfo.Status != "ok" {
+			result.Degraded = true
+		}
+		if bus != nil {
+			renderConnectionInfo(bus, result.ConnectionInfo, !cfg.NoMetadata)
+		}
+		return summarize(ctx, bus, started, result)
+	}
+
+	clientOpts := opts
+	clientOpts.Timeout = time.Duration(cfg.Timeout+5) * time.Second
+	clientOpts.Network = familyNetwork(cfg.Family)
 	if hostsConsistent && discovery.Selected.IP != "" && !discovery.DefaultDNS {
 		clientOpts.PinHost = dlHost
 		clientOpts.PinIP = discovery.Selected.IP
 	}
+	tracker := netx.NewConnTracker()
+	clientOpts.Tracker = tracker
 	client := netx.NewClient(clientOpts)
 
-	result.ConnectionInfo = gatherInfo(ctx, !cfg.NoMetadata, dlHost, discovery.Selected)
+	result.ConnectionInfo = gatherInfo(ctx, !cfg.NoMetadata, dlHost, discovery.Selected, cfg.Family)
 	if !cfg.NoMetadata && result.ConnectionInfo.Status != "ok" {
 		result.Degraded = true
 	}
@@ -120,8 +266,34 @@ func Run(ctx context.Context, cfg *config.Config, bus *render.Bus, isTTY bool) R
 		return finalizeResult(started, result, 130)
 	}
 
+	measure(ctx, cfg, client, bus, &result)
+	result.ConnectionInfo.Connections = connectionDetails(tracker.Connections())
+
+	return summarize(ctx, bus, started, result)
+}
+
+// summarize renders the summary and sets the exit code of a run that was
+// not cut short.
+func summarize(ctx context.Context, bus *render.Bus, started time.Time, result RunResult) RunResult {
+	if interrupted(ctx) {
+		return finalizeResult(started, result, 130)
+	}
+
+	if bus != nil {
+		renderSummary(bus, result)
+	}
+	exitCode := 0
+	if result.Degraded {
+		exitCode = 2
+	}
+	return finalizeResult(started, result, exitCode)
+}
+
+// measure runs idle latency and every transfer round against client and
+// records them on result.
+func measure(ctx context.Context, cfg *config.Config, client *http.Client, bus *render.Bus, result *RunResult) {
 	if bus != nil {
-		bus.Header(i18n.Text("Idle Latency", "空载延迟"))
+		bus.Phase("idle_latency", i18n.Text("Idle Latency", "空载延迟"))
 		bus.Info(fmt.Sprintf(i18n.Text("Samples: %d", "采样: %d"), cfg.LatencyCount))
 	}
 	idleStats := latency.MeasureIdle(ctx, client, cfg.LatencyURL, cfg.LatencyCount)
@@ -138,13 +310,14 @@ func Run(ctx context.Context, cfg *config.Config, bus *render.Bus, isTTY bool) R
 			return
 		}
 		if bus != nil {
-			bus.Header(name)
+			bus.Phase(roundPhase(dir, threads), name)
 			bus.Info(fmt.Sprintf(i18n.Text("Threads: %d", "线程: %d"), threads))
 			bus.Info(fmt.Sprintf(i18n.Text("Limit: %s / %ds per thread", "上限: %s / 每线程 %ds"), cfg.Max, cfg.Timeout))
 		}
 
+		roundStarted := time.Now()
 		loadedProbe := latency.StartLoaded(ctx, client, cfg.LatencyURL)
-		res := transfer.Run(ctx, client, cfg, dir, threads, url, bus)
+		res := transfer.Run(ctx, client, cfg, dir, threads, url, loadedProbe, bus)
 		loadedStats := loadedProbe.Stop()
 
 		round := RoundResult{
@@ -153,12 +326,14 @@ func Run(ctx context.Context, cfg *config.Config, bus *render.Bus, isTTY bool) R
 			Threads:       threads,
 			Status:        "ok",
 			URL:           url,
+			StartedAt:     roundStarted.UTC().Format(time.RFC3339Nano),
 			TotalBytes:    res.TotalBytes,
 			DurationMs:    res.Duration.Milliseconds(),
 			Mbps:          res.Mbps,
 			FaultCount:    res.FaultCount,
 			HadFault:      res.HadFault,
 			LoadedLatency: latencyResult(loadedStats, i18n.Text("No loaded latency samples collected.", "未采集到负载延迟样本。")),
+			Timeline:      timeline(res.Timeline),
 		}
 		if res.HadFault {
 			round.Status = "degraded"
@@ -177,6 +352,10 @@ func Run(ctx context.Context, cfg *config.Config, bus *render.Bus, isTTY bool) R
 			result.Degraded = true
 		}
 
+		if round.Status == "failed" || res.HadFault {
+			addWarning(result, "round_"+round.Status, name+": "+round.Error)
+		}
+
 		result.TotalBytes += res.TotalBytes
 		result.Rounds = append(result.Rounds, round)
 		if bus != nil {
@@ -192,19 +371,6 @@ func Run(ctx context.Context, cfg *config.Config, bus *render.Bus, isTTY bool) R
 	if cfg.Threads > 1 {
 		runRound(transfer.Upload, cfg.Threads, i18n.Text("Upload (multi-thread)", "上传（多线程）"), cfg.ULURL)
 	}
-
-	if interrupted(ctx) {
-		return finalizeResult(started, result, 130)
-	}
-
-	if bus != nil {
-		renderSummary(bus, result)
-	}
-	exitCode := 0
-	if result.Degraded {
-		exitCode = 2
-	}
-	return finalizeResult(started, result, exitCode)
 }
 
 func finalizeResult(started time.Time, result RunResult, exitCode int) RunResult {
@@ -218,21 +384,29 @@ func finalizeResult(started time.Time, result RunResult, exitCode int) RunResult
 }
 
 func renderSelection(bus *render.Bus, ctx context.Context, discovery *endpoint.DiscoveryResult, allowPrompt bool) {
-	bus.Header(i18n.Text("Endpoint Selection", "节点选择"))
+	bus.Phase("endpoint_selection", i18n.Text("Endpoint Selection", "节点选择"))
 	if discovery.Host != "" {
 		bus.Info(i18n.Text("Host: ", "主机: ") + discovery.Host)
 	}
+	if discovery.Cached {
+		bus.Info(fmt.Sprintf(i18n.Text("Reusing the endpoint discovered at %s; it still probes healthy.", "沿用 %s 发现的节点，健康探测正常。"),
+			discovery.DiscoveredAt.Local().Format("2006-01-02 15:04:05")))
+	}
 	for _, warning := range discovery.Warnings {
 		bus.Warn(warning.Message)
 	}
 	if len(discovery.Candidates) == 0 {
-		if discovery.Selected.IP == "" {
+		if discovery.Selected.IP == "" && discovery.Error == "" {
 			bus.Warn(i18n.Text("Using default DNS without endpoint pinning.", "未固定节点，继续使用默认 DNS。"))
 		}
 		return
 	}
 
-	bus.Info(i18n.Text("Available endpoints:", "可用节点:"))
+	rows := make([]render.Candidate, 0, len(discovery.Candidates))
+	for _, candidate := range discovery.Candidates {
+		rows = append(rows, render.Candidate{IP: candidate.IP, Label: endpoint.CandidateLabel(candidate), RTTMs: candidate.RTTMs})
+	}
+	bus.InfoData(i18n.Text("Available endpoints:", "可用节点:"), rows)
 	for i, candidate := range discovery.Candidates {
 		bus.Info(fmt.Sprintf("  %d) %s  %s", i+1, candidate.IP, endpoint.CandidateLabel(candidate)))
 	}
@@ -254,12 +428,13 @@ func renderSelection(bus *render.Bus, ctx context.Context, discovery *endpoint.D
 		}
 	}
 	if discovery.Selected.IP != "" {
-		bus.Info(fmt.Sprintf(i18n.Text("Selected endpoint: %s (%s)", "已选择节点: %s (%s)"), discovery.Selected.IP, selectedDesc(discovery.Selected)))
+		bus.InfoData(fmt.Sprintf(i18n.Text("Selected endpoint: %s (%s)", "已选择节点: %s (%s)"), discovery.Selected.IP, selectedDesc(discovery.Selected)),
+			render.Candidate{IP: discovery.Selected.IP, Label: selectedDesc(discovery.Selected), RTTMs: discovery.Selected.RTTMs, Selected: true})
 	}
 }
 
 func renderConnectionInfo(bus *render.Bus, info ConnectionInfo, metadata bool) {
-	bus.Header(i18n.Text("Connection Information", "连接信息"))
+	bus.Phase("connection_info", i18n.Text("Connection Information", "连接信息"))
 	if !metadata {
 		bus.Info(i18n.Text("Metadata lookup disabled.", "已禁用元数据查询。"))
 		return
@@ -268,7 +443,133 @@ func renderConnectionInfo(bus *render.Bus, info ConnectionInfo, metadata bool) {
 	renderPeer(bus, i18n.Text("Server", "服务端"), info.Server)
 }
 
+func connectionDetails(conns []netx.ConnDetail) []ConnectionDetail {
+	var out []ConnectionDetail
+	for _, c := range conns {
+		out = append(out, ConnectionDetail{
+			RemoteAddr:     c.RemoteAddr,
+			Proto:          c.Proto,
+			TLSVersion:     c.TLSVersion,
+			CipherSuite:    c.CipherSuite,
+			ALPN:           c.ALPN,
+			CertSubject:    c.CertSubject,
+			CertIssuer:     c.CertIssuer,
+			Requests:       c.Requests,
+			ReusedRequests: c.Reused,
+			Socket:         socketInfo(c.Socket),
+		})
+	}
+	return out
+}
+
+func socketInfo(s *netx.SocketState) *SocketInfo {
+	if s == nil {
+		return nil
+	}
+	return &SocketInfo{
+		RcvBufBytes:       s.RcvBuf,
+		SndBufBytes:       s.SndBuf,
+		NoDelay:           s.NoDelay,
+		NotSentLowatBytes: s.NotSentLowat,
+		MPTCP:             s.MPTCP,
+	}
+}
+
+// socketTuning describes the requested socket options, or returns "" when
+// none were given.
+func socketTuning(cfg *config.Config) string {
+	var parts []string
+	if cfg.RcvBuf > 0 {
+		parts = append(parts, "rcvbuf "+config.HumanBytes(int64(cfg.RcvBuf)))
+	}
+	if cfg.SndBuf > 0 {
+		parts = append(parts, "sndbuf "+config.HumanBytes(int64(cfg.SndBuf)))
+	}
+	if cfg.NotSentLowat > 0 {
+		parts = append(parts, "notsent_lowat "+config.HumanBytes(int64(cfg.NotSentLowat)))
+	}
+	if cfg.TCPNoDelay != "" {
+		parts = append(parts, "nodelay "+cfg.TCPNoDelay)
+	}
+	if cfg.MPTCP {
+		parts = append(parts, "MPTCP")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// socketSummary describes the effective options of one connection.
+func socketSummary(s *SocketInfo) string {
+	noDelay := "off"
+	if s.NoDelay {
+		noDelay = "on"
+	}
+	parts := []string{
+		"rcvbuf " + config.HumanBytes(int64(s.RcvBufBytes)),
+		"sndbuf " + config.HumanBytes(int64(s.SndBufBytes)),
+		"nodelay " + noDelay,
+	}
+	if s.NotSentLowatBytes > 0 {
+		parts = append(parts, "notsent_lowat "+config.HumanBytes(int64(s.NotSentLowatBytes)))
+	}
+	if s.MPTCP {
+		parts = append(parts, "MPTCP")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// renderConnections prints each distinct protocol / TLS combination, server
+// certificate and socket configuration once, with the number of
+// connections that used it.
+func renderConnections(bus *render.Bus, conns []ConnectionDetail) {
+	var protocols, certs, sockets []string
+	counts := map[string]int{}
+	socketCounts := map[string]int{}
+	for _, c := range conns {
+		if c.Socket != nil {
+			socket := socketSummary(c.Socket)
+			if socketCounts[socket] == 0 {
+				sockets = append(sockets, socket)
+			}
+			socketCounts[socket]++
+		}
+		protocol := strings.Join(nonEmpty(c.Proto, c.TLSVersion, c.CipherSuite), ", ")
+		if counts[protocol] == 0 {
+			protocols = append(protocols, protocol)
+		}
+		counts[protocol]++
+		if c.CertSubject != "" {
+			cert := fmt.Sprintf(i18n.Text("%s (issuer %s)", "%s（签发者 %s）"), c.CertSubject, c.CertIssuer)
+			if !slices.Contains(certs, cert) {
+				certs = append(certs, cert)
+			}
+		}
+	}
+	for _, protocol := range protocols {
+		bus.KV(i18n.Text("Protocol", "协议"), fmt.Sprintf(i18n.Text("%s  (%d connections)", "%s  (%d 个连接)"), protocol, counts[protocol]))
+	}
+	for _, cert := range certs {
+		bus.KV(i18n.Text("Certificate", "证书"), cert)
+	}
+	for _, socket := range sockets {
+		bus.KV(i18n.Text("Socket", "套接字"), fmt.Sprintf(i18n.Text("%s  (%d connections)", "%s  (%d 个连接)"), socket, socketCounts[socket]))
+	}
+}
+
+func nonEmpty(values ...string) []string {
+	var out []string
+	for _, v := range values {
+		if v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
 func renderPeer(bus *render.Bus, label string, peer PeerInfo) {
+	if peer.Error != "" {
+		bus.KV(label, peer.Error)
+		return
+	}
 	bus.KV(label, fmt.Sprintf("%s  (%s)", fallback(peer.IP), fallback(peer.ISP)))
 	bus.KV("  ASN", fallback(peer.ASN))
 	bus.KV(i18n.Text("  Location", "  位置"), fallback(peer.Location))
@@ -279,19 +580,19 @@ func renderLatency(bus *render.Bus, result LatencyResult) {
 		bus.Warn(orFallback(result.Error, i18n.Text("Latency unavailable.", "延迟不可用。")))
 		return
 	}
-	bus.Result(fmt.Sprintf(i18n.Text(
+	bus.ResultData(fmt.Sprintf(i18n.Text(
 		"%.2f ms median  (min %.2f / avg %.2f / max %.2f)  jitter %.2f ms",
 		"%.2f 毫秒 中位数  (最小 %.2f / 平均 %.2f / 最大 %.2f)  抖动 %.2f 毫秒"),
-		value(result.MedianMs), value(result.MinMs), value(result.AvgMs), value(result.MaxMs), value(result.JitterMs)))
+		value(result.MedianMs), value(result.MinMs), value(result.AvgMs), value(result.MaxMs), value(result.JitterMs)), result)
 }
 
 func renderRound(bus *render.Bus, round RoundResult) {
 	if round.Threads <= 1 {
-		bus.Result(fmt.Sprintf(i18n.Text("%.0f Mbps  (%s in %.1fs)", "%.0f Mbps  (%s，耗时 %.1fs)"),
-			round.Mbps, config.HumanBytes(round.TotalBytes), float64(round.DurationMs)/1000))
+		bus.ResultData(fmt.Sprintf(i18n.Text("%.0f Mbps  (%s in %.1fs)", "%.0f Mbps  (%s，耗时 %.1fs)"),
+			round.Mbps, config.HumanBytes(round.TotalBytes), float64(round.DurationMs)/1000), round)
 	} else {
-		bus.Result(fmt.Sprintf(i18n.Text("%.0f Mbps  (%s in %.1fs, %d threads)", "%.0f Mbps  (%s，耗时 %.1fs，%d 线程)"),
-			round.Mbps, config.HumanBytes(round.TotalBytes), float64(round.DurationMs)/1000, round.Threads))
+		bus.ResultData(fmt.Sprintf(i18n.Text("%.0f Mbps  (%s in %.1fs, %d threads)", "%.0f Mbps  (%s，耗时 %.1fs，%d 线程)"),
+			round.Mbps, config.HumanBytes(round.TotalBytes), float64(round.DurationMs)/1000, round.Threads), round)
 	}
 	if round.Error != "" {
 		bus.Warn(round.Error)
@@ -315,6 +616,7 @@ func renderSummary(bus *render.Bus, result RunResult) {
 		bus.KV(i18n.Text("Idle Latency", "空载延迟"), i18n.Text("unavailable", "不可用"))
 	}
 	bus.KV(i18n.Text("Data Used", "消耗流量"), config.HumanBytes(result.TotalBytes))
+	renderConnections(bus, result.ConnectionInfo.Connections)
 	bus.Line()
 	if result.Degraded {
 		bus.Warn(i18n.Text("Completed with degraded results.", "测速完成，但结果存在降级。"))
@@ -324,7 +626,7 @@ func renderSummary(bus *render.Bus, result RunResult) {
 	bus.Line()
 }
 
-func gatherInfo(ctx context.Context, metadata bool, host string, selected endpoint.Endpoint) ConnectionInfo {
+func gatherInfo(ctx context.Context, metadata bool, host string, selected endpoint.Endpoint, family int) ConnectionInfo {
 	info := ConnectionInfo{
 		Status:          "ok",
 		MetadataEnabled: metadata,
@@ -337,15 +639,19 @@ func gatherInfo(ctx context.Context, metadata bool, host string, selected endpoi
 		return info
 	}
 
-	clientInfo := endpoint.FetchInfo(ctx, "")
+	clientInfo, err := endpoint.FetchClientInfo(ctx, family)
 	info.Client = peerFromInfo(clientInfo)
+	var noPublic *endpoint.NoPublicAddrError
+	if errors.As(err, &noPublic) {
+		info.Client.Error = err.Error()
+	}
 	if info.Client.Status != "ok" {
 		info.Status = "degraded"
 	}
 
 	serverIP := selected.IP
 	if serverIP == "" && host != "" {
-		serverIP = endpoint.ResolveHost(host)
+		serverIP = endpoint.ResolveHost(host, family)
 	}
 	if serverIP != "" {
 		serverInfo := endpoint.FetchInfo(ctx, serverIP)
@@ -385,27 +691,60 @@ func latencyResult(stats latency.Stats, errMsg string) LatencyResult {
 		return LatencyResult{Status: "unavailable", Error: errMsg}
 	}
 	return LatencyResult{
-		Status:   "ok",
-		Samples:  stats.N,
-		MinMs:    floatPtr(stats.Min),
-		AvgMs:    floatPtr(stats.Avg),
-		MedianMs: floatPtr(stats.Median),
-		MaxMs:    floatPtr(stats.Max),
-		JitterMs: floatPtr(stats.Jitter),
+		Status:    "ok",
+		Samples:   stats.N,
+		MinMs:     floatPtr(stats.Min),
+		AvgMs:     floatPtr(stats.Avg),
+		MedianMs:  floatPtr(stats.Median),
+		MaxMs:     floatPtr(stats.Max),
+		JitterMs:  floatPtr(stats.Jitter),
+		SamplesMs: roundSamples(stats.Samples),
+	}
+}
+
+func roundSamples(samples []float64) []float64 {
+	out := make([]float64, 0, len(samples))
+	for _, sample := range samples {
+		out = append(out, math.Round(sample*100)/100)
 	}
+	return out
+}
+
+func timeline(samples []transfer.Sample) []ThroughputSample {
+	if len(samples) == 0 {
+		return nil
+	}
+	out := make([]ThroughputSample, 0, len(samples))
+	for _, sample := range samples {
+		out = append(out, ThroughputSample{
+			ElapsedMs: sample.Elapsed.Milliseconds(),
+			Bytes:     sample.Bytes,
+			Mbps:      math.Round(sample.Mbps*100) / 100,
+		})
+	}
+	return out
 }
 
 func candidateResults(candidates []endpoint.Candidate) []CandidateResult {
 	out := make([]CandidateResult, 0, len(candidates))
 	for _, candidate := range candidates {
-		out = append(out, CandidateResult{
+		cr := CandidateResult{
 			IP:          candidate.IP,
 			Description: candidate.Desc,
+			ASN:         candidate.ASN,
+			Country:     candidate.Country,
 			RTTMs:       floatPtrOrNil(candidate.RTTMs),
+			MinRTTMs:    floatPtrOrNil(candidate.MinRTTMs),
+			RTTSamples:  candidate.Samples,
 			Source:      candidate.Source,
 			Status:      candidate.Status,
 			Error:       candidate.Error,
-		})
+			Preferred:   candidate.Preferred,
+		}
+		if candidate.Samples > 0 {
+			cr.Loss = floatPtr(candidate.Loss)
+		}
+		out = append(out, cr)
 	}
 	return out
 }
@@ -420,6 +759,30 @@ func selectedEndpoint(selected endpoint.Endpoint) SelectedEndpoint {
 	}
 }
 
+func tlsVersionName(v uint16) string {
+	if v == 0 {
+		return ""
+	}
+	return tls.VersionName(v)
+}
+
+func cipherNames(ids []uint16) []string {
+	var out []string
+	for _, id := range ids {
+		out = append(out, tls.CipherSuiteName(id))
+	}
+	return out
+}
+
+// redactURL hides the password of a proxy URL.
+func redactURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	return u.Redacted()
+}
+
 func addWarning(result *RunResult, code, message string) {
 	result.Warnings = append(result.Warnings, Warning{Code: code, Message: message})
 }
@@ -428,6 +791,13 @@ func interrupted(ctx context.Context) bool {
 	return ctx.Err() != nil
 }
 
+func roundPhase(direction transfer.Direction, threads int) string {
+	if threads <= 1 {
+		return directionName(direction) + "_single"
+	}
+	return directionName(direction) + "_multi"
+}
+
 func directionName(direction transfer.Direction) string {
 	if direction == transfer.Download {
 		return "download"
@@ -3,14 +3,17 @@ package runner
 import (
 	"context"
 	"encoding/json"
+	"encoding/pem"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 
 	"github.com/tsosunchia/iNetSpeed-CLI/internal/config"
 	"github.com/tsosunchia/iNetSpeed-CLI/internal/endpoint"
+	"github.com/tsosunchia/iNetSpeed-CLI/internal/netx"
 	"github.com/tsosunchia/iNetSpeed-CLI/internal/render"
 	"testing"
 )
@@ -58,7 +61,7 @@ func TestRunSkipsDuplicateRoundsWhenThreadsIsOne(t *testing.T) {
 	bus := render.NewBus(render.NewPlainRenderer(&strings.Builder{}))
 	defer bus.Close()
 
-	result := Run(context.Background(), cfg, bus, false)
+	result := Run(context.Background(), cfg, netx.Options{}, bus, false)
 	if len(result.Rounds) != 2 {
 		t.Fatalf("expected 2 rounds, got %d", len(result.Rounds))
 	}
@@ -69,6 +72,200 @@ func TestRunSkipsDuplicateRoundsWhenThreadsIsOne(t *testing.T) {
 	}
 }
 
+func TestRunComparesEndpoints(t *testing.T) {
+	srv := mockRunnerServer()
+	defer srv.Close()
+
+	cfg := &config.Config{
+		DLURL:            srv.URL + "/large",
+		ULURL:            srv.URL + "/slurp",
+		LatencyURL:       srv.URL + "/small",
+		Max:              "256K",
+		MaxBytes:         256 * 1024,
+		Timeout:          2,
+		Threads:          1,
+		LatencyCount:     1,
+		EndpointIPs:      []string{"127.0.0.2", "127.0.0.1"},
+		CompareEndpoints: true,
+		NoMetadata:       true,
+		NonInteractive:   true,
+	}
+
+	bus := render.NewBus(render.NewPlainRenderer(&strings.Builder{}))
+	defer bus.Close()
+
+	result := Run(context.Background(), cfg, netx.Options{}, bus, false)
+	if len(result.Comparison) != 1 {
+		t.Fatalf("expected the unreachable candidate to be skipped, got %+v", result.Comparison)
+	}
+	best := result.Comparison[0]
+	if best.Rank != 1 || best.Endpoint.IP != "127.0.0.1" || best.DownloadMbps <= 0 {
+		t.Fatalf("unexpected comparison entry %+v", best)
+	}
+	if result.SelectedEndpoint.IP != "127.0.0.1" || len(result.Rounds) != len(best.Rounds) {
+		t.Fatalf("top-level result should describe the best endpoint, got %+v", result.SelectedEndpoint)
+	}
+	if result.TotalBytes != best.TotalBytes {
+		t.Fatalf("TotalBytes = %d, want %d", result.TotalBytes, best.TotalBytes)
+	}
+}
+
+func TestRunComparesEndpointsKeepsWarnings(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.Handle("/", mockRunnerHandler())
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	cfg := &config.Config{
+		DLURL:            srv.URL + "/large",
+		ULURL:            srv.URL + "/broken",
+		LatencyURL:       srv.URL + "/small",
+		Max:              "256K",
+		MaxBytes:         256 * 1024,
+		Timeout:          2,
+		Threads:          1,
+		LatencyCount:     1,
+		EndpointIPs:      []string{"127.0.0.1", "127.0.0.1"},
+		CompareEndpoints: true,
+		NoMetadata:       true,
+		NonInteractive:   true,
+	}
+
+	var out strings.Builder
+	bus := render.NewBus(render.NewNDJSONRenderer(&out))
+	result := Run(context.Background(), cfg, netx.Options{}, bus, false)
+	bus.Close()
+
+	failed := 0
+	for _, warning := range result.Warnings {
+		if warning.Code == "round_failed" && strings.HasPrefix(warning.Message, "127.0.0.1: ") {
+			failed++
+		}
+	}
+	if failed != 2 {
+		t.Fatalf("expected a round_failed warning per endpoint, got %+v", result.Warnings)
+	}
+	phases := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var ev struct{ Type, Phase string }
+		if err := json.Unmarshal([]byte(line), &ev); err != nil {
+			t.Fatal(err)
+		}
+		if ev.Type == "phase" {
+			phases[ev.Phase] = true
+		}
+	}
+	if !phases["compare_endpoint_1"] || !phases["compare_endpoint_2"] {
+		t.Fatalf("expected one phase per endpoint, got %v", phases)
+	}
+}
+
+func TestRunRecordsConnections(t *testing.T) {
+	srv := httptest.NewUnstartedServer(mockRunnerHandler())
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tlsCfg, _, err := netx.LoadTLS(netx.TLS{CAFile: caFile})
+	if err != nil {
+		t.Fatalf("LoadTLS: %v", err)
+	}
+
+	cfg := &config.Config{
+		DLURL:          srv.URL + "/large",
+		ULURL:          srv.URL + "/slurp",
+		LatencyURL:     srv.URL + "/small",
+		Max:            "256K",
+		MaxBytes:       256 * 1024,
+		Timeout:        2,
+		Threads:        1,
+		LatencyCount:   3,
+		EndpointIP:     "127.0.0.1",
+		NoMetadata:     true,
+		NonInteractive: true,
+	}
+	bus := render.NewBus(render.NewPlainRenderer(&strings.Builder{}))
+	defer bus.Close()
+
+	result := Run(context.Background(), cfg, netx.Options{TLS: tlsCfg}, bus, false)
+	conns := result.ConnectionInfo.Connections
+	if len(conns) == 0 {
+		t.Fatalf("expected measurement connections, got none (rounds %+v)", result.Rounds)
+	}
+	c := conns[0]
+	if c.Proto != "HTTP/2.0" || c.ALPN != "h2" || c.TLSVersion != "TLS 1.3" || c.CipherSuite == "" {
+		t.Fatalf("unexpected negotiated parameters %+v", c)
+	}
+	if c.CertSubject != "O=Acme Co" || c.CertIssuer != "O=Acme Co" {
+		t.Fatalf("unexpected certificate %q issued by %q", c.CertSubject, c.CertIssuer)
+	}
+	if c.Requests < cfg.LatencyCount || c.ReusedRequests != c.Requests-1 {
+		t.Fatalf("expected the idle latency samples to reuse the connection, got %+v", c)
+	}
+}
+
+func TestRunRecordsSocketOptions(t *testing.T) {
+	srv := mockRunnerServer()
+	defer srv.Close()
+	noDelay := false
+	opts := netx.Options{Socket: netx.SocketOptions{RcvBuf: 64 << 10, NoDelay: &noDelay}}
+
+	cfg := &config.Config{
+		DLURL:          srv.URL + "/large",
+		ULURL:          srv.URL + "/slurp",
+		LatencyURL:     srv.URL + "/small",
+		Max:            "256K",
+		MaxBytes:       256 * 1024,
+		Timeout:        2,
+		Threads:        1,
+		LatencyCount:   2,
+		EndpointIP:     "127.0.0.1",
+		NoMetadata:     true,
+		NonInteractive: true,
+	}
+	bus := render.NewBus(render.NewPlainRenderer(&strings.Builder{}))
+	defer bus.Close()
+
+	result := Run(context.Background(), cfg, opts, bus, false)
+	conns := result.ConnectionInfo.Connections
+	if len(conns) == 0 {
+		t.Fatalf("expected measurement connections, got none (rounds %+v)", result.Rounds)
+	}
+	for _, c := range conns {
+		if c.Socket == nil || c.Socket.NoDelay || c.Socket.RcvBufBytes < 64<<10 || c.Socket.SndBufBytes <= 0 {
+			t.Fatalf("unexpected socket state for %s: %+v", c.RemoteAddr, c.Socket)
+		}
+	}
+}
+
+func TestRankEndpoints(t *testing.T) {
+	ms := func(v float64) *float64 { return &v }
+	entries := []EndpointResult{
+		{Endpoint: SelectedEndpoint{IP: "a"}, DownloadMbps: 100, UploadMbps: 10, IdleLatency: LatencyResult{MedianMs: ms(20)}},
+		{Endpoint: SelectedEndpoint{IP: "b"}, DownloadMbps: 200},
+		{Endpoint: SelectedEndpoint{IP: "c"}, DownloadMbps: 100, UploadMbps: 10, IdleLatency: LatencyResult{MedianMs: ms(10)}},
+		{Endpoint: SelectedEndpoint{IP: "d"}, DownloadMbps: 100, UploadMbps: 50},
+	}
+	rankEndpoints(entries)
+	var got []string
+	for i, entry := range entries {
+		if entry.Rank != i+1 {
+			t.Fatalf("entry %d has rank %d", i, entry.Rank)
+		}
+		got = append(got, entry.Endpoint.IP)
+	}
+	if strings.Join(got, ",") != "b,d,c,a" {
+		t.Fatalf("rank order = %v, want b,d,c,a", got)
+	}
+}
+
 func TestRunWarnsOnMixedHosts(t *testing.T) {
 	srv := mockRunnerServer()
 	defer srv.Close()
@@ -90,7 +287,7 @@ func TestRunWarnsOnMixedHosts(t *testing.T) {
 	bus := render.NewBus(render.NewPlainRenderer(&strings.Builder{}))
 	defer bus.Close()
 
-	result := Run(context.Background(), cfg, bus, false)
+	result := Run(context.Background(), cfg, netx.Options{}, bus, false)
 	if !result.Degraded {
 		t.Fatal("expected degraded result for mixed hosts")
 	}
@@ -206,6 +403,10 @@ func normalizeGolden(data []byte) string {
 }
 
 func mockRunnerServer() *httptest.Server {
+	return httptest.NewServer(mockRunnerHandler())
+}
+
+func mockRunnerHandler() http.Handler {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/small", func(w http.ResponseWriter, r *http.Request) {
 		_, _ = w.Write([]byte("ok"))
@@ -217,5 +418,40 @@ func mockRunnerServer() *httptest.Server {
 		_, _ = io.Copy(io.Discard, r.Body)
 		_, _ = w.Write([]byte("ok"))
 	})
-	return httptest.NewServer(mux)
+	return mux
+}
+
+func TestSubnetMappingResults(t *testing.T) {
+	got := subnetMappingResults([]endpoint.SubnetMapping{
+		{Subnet: "203.0.113.0/24", Scope: 24, Endpoints: []endpoint.Endpoint{{IP: "17.253.85.205", Desc: "Tokyo"}}},
+		{Subnet: "198.51.100.0/24", Scope: -1, Error: "timeout"},
+	})
+	if len(got) != 2 {
+		t.Fatalf("expected 2 entries, got %+v", got)
+	}
+	if got[0].Status != "ok" || got[0].ScopePrefix == nil || *got[0].ScopePrefix != 24 || got[0].Endpoints[0].Description != "Tokyo" {
+		t.Fatalf("unexpected first entry %+v", got[0])
+	}
+	if got[1].Status != "failed" || got[1].ScopePrefix != nil || got[1].Error != "timeout" {
+		t.Fatalf("unexpected second entry %+v", got[1])
+	}
+}
+
+func TestDualStackResultDeltas(t *testing.T) {
+	ds := dualStackResult([]FamilyResult{
+		{Family: 4, DownloadMbps: 800, UploadMbps: 200, IdleLatency: LatencyResult{MedianMs: floatPtr(12)}},
+		{Family: 6, DownloadMbps: 600, UploadMbps: 0, IdleLatency: LatencyResult{MedianMs: floatPtr(15.5)}},
+	})
+	if ds.DownloadDeltaMbps == nil || *ds.DownloadDeltaMbps != -200 {
+		t.Fatalf("download delta = %v, want -200", ds.DownloadDeltaMbps)
+	}
+	if ds.UploadDeltaMbps != nil {
+		t.Fatalf("expected no upload delta without an IPv6 upload, got %v", *ds.UploadDeltaMbps)
+	}
+	if ds.IdleLatencyDeltaMs == nil || *ds.IdleLatencyDeltaMs != 3.5 {
+		t.Fatalf("idle latency delta = %v, want 3.5", ds.IdleLatencyDeltaMs)
+	}
+	if got := deltaCell(-200, 800); got != "-200 Mbps (-25.0%)" {
+		t.Fatalf("deltaCell = %q", got)
+	}
 }
@@ -29,6 +29,14 @@ func (d Direction) String() string {
 	return i18n.Text("Upload", "上传")
 }
 
+// Key is the direction's stable name for machine-readable output.
+func (d Direction) Key() string {
+	if d == Download {
+		return "download"
+	}
+	return "upload"
+}
+
 type Result struct {
 	Direction  Direction
 	Threads    int
@@ -37,15 +45,31 @@ type Result struct {
 	Mbps       float64
 	FaultCount int
 	HadFault   bool
+	Timeline   []Sample
+}
+
+// Sample is one progress tick: cumulative bytes at Elapsed and the rate
+// over the interval since the previous tick.
+type Sample struct {
+	Elapsed time.Duration
+	Bytes   int64
+	Mbps    float64
+}
+
+// LoadedSampler reports the loaded latency samples collected so far, so
+// progress events can carry them alongside throughput.
+type LoadedSampler interface {
+	Samples() []float64
 }
 
 func Run(ctx context.Context, client *http.Client, cfg *config.Config,
-	dir Direction, threads int, url string, bus *render.Bus) Result {
+	dir Direction, threads int, url string, loaded LoadedSampler, bus *render.Bus) Result {
 
 	maxBytes := cfg.MaxBytes
 	timeout := time.Duration(cfg.Timeout) * time.Second
 
 	var totalBytes int64
+	connBytes := make([]int64, threads)
 	var faultCount atomic.Int32
 	var wg sync.WaitGroup
 
@@ -54,21 +78,39 @@ func Run(ctx context.Context, client *http.Client, cfg *config.Config,
 
 	start := time.Now()
 
+	var timeline []Sample
 	progressDone := make(chan struct{})
 	go func() {
 		defer close(progressDone)
 		ticker := time.NewTicker(500 * time.Millisecond)
 		defer ticker.Stop()
+		var prev Sample
 		for {
 			select {
 			case <-ticker.C:
 				cur := atomic.LoadInt64(&totalBytes)
-				elapsed := time.Since(start).Seconds()
+				elapsedDur := time.Since(start)
+				elapsed := elapsedDur.Seconds()
+				if interval := (elapsedDur - prev.Elapsed).Seconds(); interval > 0 {
+					prev = Sample{
+						Elapsed: elapsedDur,
+						Bytes:   cur,
+						Mbps:    float64(cur-prev.Bytes) * 8 / (interval * 1_000_000),
+					}
+					timeline = append(timeline, prev)
+				}
 				if elapsed > 0 {
 					mbps := float64(cur) * 8 / (elapsed * 1_000_000)
-					bus.Progress(dir.String(),
+					p := render.Progress{Key: dir.Key(), Bytes: cur, Elapsed: elapsedDur, Mbps: mbps, Conns: make([]int64, threads)}
+					for i := range connBytes {
+						p.Conns[i] = atomic.LoadInt64(&connBytes[i])
+					}
+					if loaded != nil {
+						p.LoadedMs = loaded.Samples()
+					}
+					bus.ProgressData(dir.String(),
 						fmt.Sprintf("%.1f Mbps  %s  %.1fs",
-							mbps, config.HumanBytes(cur), elapsed))
+							mbps, config.HumanBytes(cur), elapsed), p)
 				}
 			case <-ctx2.Done():
 				return
@@ -82,9 +124,9 @@ func Run(ctx context.Context, client *http.Client, cfg *config.Config,
 			defer wg.Done()
 			var fault bool
 			if dir == Download {
-				_, fault = doDownload(ctx2, client, url, maxBytes, timeout, &totalBytes)
+				_, fault = doDownload(ctx2, client, url, maxBytes, timeout, &totalBytes, &connBytes[i])
 			} else {
-				_, fault = doUpload(ctx2, client, url, maxBytes, timeout, &totalBytes)
+				_, fault = doUpload(ctx2, client, url, maxBytes, timeout, &totalBytes, &connBytes[i])
 			}
 			if fault {
 				faultCount.Add(1)
@@ -113,10 +155,11 @@ func Run(ctx context.Context, client *http.Client, cfg *config.Config,
 		Mbps:       mbps,
 		FaultCount: fc,
 		HadFault:   fc > 0,
+		Timeline:   timeline,
 	}
 }
 
-func doDownload(ctx context.Context, client *http.Client, url string, maxBytes int64, timeout time.Duration, shared *int64) (int64, bool) {
+func doDownload(ctx context.Context, client *http.Client, url string, maxBytes int64, timeout time.Duration, shared, conn *int64) (int64, bool) {
 	ctx2, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
@@ -146,6 +189,7 @@ func doDownload(ctx context.Context, client *http.Client, url string, maxBytes i
 		if n > 0 {
 			total += int64(n)
 			atomic.AddInt64(shared, int64(n))
+			atomic.AddInt64(conn, int64(n))
 		}
 		if total >= maxBytes {
 			break
@@ -183,6 +227,7 @@ type countingReader struct {
 	r      io.Reader
 	count  atomic.Int64
 	shared *int64 // shared counter updated atomically during transfer
+	conn   *int64 // per-connection counter, also updated atomically
 }
 
 func (c *countingReader) Read(p []byte) (int, error) {
@@ -192,17 +237,21 @@ func (c *countingReader) Read(p []byte) (int, error) {
 		if c.shared != nil {
 			atomic.AddInt64(c.shared, int64(n))
 		}
+		if c.conn != nil {
+			atomic.AddInt64(c.conn, int64(n))
+		}
 	}
 	return n, err
 }
 
-func doUpload(ctx context.Context, client *http.Client, url string, maxBytes int64, timeout time.Duration, shared *int64) (int64, bool) {
+func doUpload(ctx context.Context, client *http.Client, url string, maxBytes int64, timeout time.Duration, shared, conn *int64) (int64, bool) {
 	ctx2, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	cr := &countingReader{
 		r:      &zeroReader{remaining: maxBytes},
 		shared: shared,
+		conn:   conn,
 	}
 
 	req, err := http.NewRequestWithContext(ctx2, http.MethodPut, url, cr)
@@ -63,7 +63,7 @@ func TestDownloadIntegration(t *testing.T) {
 	defer bus.Close()
 	client := srv.Client()
 
-	res := Run(context.Background(), client, cfg, Download, 1, srv.URL, bus)
+	res := Run(context.Background(), client, cfg, Download, 1, srv.URL, nil, bus)
 	if res.TotalBytes == 0 {
 		t.Error("downloaded 0 bytes")
 	}
@@ -96,7 +96,7 @@ func TestUploadIntegration(t *testing.T) {
 	defer bus.Close()
 	client := srv.Client()
 
-	res := Run(context.Background(), client, cfg, Upload, 1, srv.URL, bus)
+	res := Run(context.Background(), client, cfg, Upload, 1, srv.URL, nil, bus)
 	if res.TotalBytes == 0 {
 		t.Error("uploaded 0 bytes")
 	}
@@ -124,7 +124,7 @@ func TestMultiThreadDownload(t *testing.T) {
 	defer bus.Close()
 	client := srv.Client()
 
-	res := Run(context.Background(), client, cfg, Download, 4, srv.URL, bus)
+	res := Run(context.Background(), client, cfg, Download, 4, srv.URL, nil, bus)
 	if res.TotalBytes == 0 {
 		t.Error("downloaded 0 bytes with 4 threads")
 	}
@@ -161,7 +161,7 @@ func TestDownloadTimeout(t *testing.T) {
 	client := srv.Client()
 
 	start := time.Now()
-	Run(context.Background(), client, cfg, Download, 1, srv.URL, bus)
+	Run(context.Background(), client, cfg, Download, 1, srv.URL, nil, bus)
 	elapsed := time.Since(start)
 
 	if elapsed > 5*time.Second {
@@ -194,7 +194,7 @@ func TestUploadBadStatusMarksFault(t *testing.T) {
 	defer bus.Close()
 	client := srv.Client()
 
-	res := Run(context.Background(), client, cfg, Upload, 1, srv.URL, bus)
+	res := Run(context.Background(), client, cfg, Upload, 1, srv.URL, nil, bus)
 	if !res.HadFault {
 		t.Fatal("expected fault on HTTP 403 upload")
 	}